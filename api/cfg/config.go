@@ -30,12 +30,25 @@ type DatabaseConfig struct {
 }
 
 type IndividualDBConfig struct {
-	URI         string        `env:"INDIVIDUAL_DB_URI, required"`
-	MaxPoolSize uint64        `yaml:"max_pool_size"`
-	MinPoolSize uint64        `yaml:"min_pool_size"`
-	MaxIdletime time.Duration `yaml:"max_idle_time"`
-	Database    string        `yaml:"database"`
-	Collection  string        `yaml:"collection"`
+	URI         string         `env:"INDIVIDUAL_DB_URI, required"`
+	MaxPoolSize uint64         `yaml:"max_pool_size"`
+	MinPoolSize uint64         `yaml:"min_pool_size"`
+	MaxIdletime time.Duration  `yaml:"max_idle_time"`
+	Database    string         `yaml:"database"`
+	Collection  string         `yaml:"collection"`
+	Matching    MatchingConfig `yaml:"matching"`
+}
+
+type MatchingConfig struct {
+	Mode            string  `yaml:"mode"`             // exact or nearest
+	AgeTolerance    int     `yaml:"age_tolerance"`    // years
+	HeightTolerance int     `yaml:"height_tolerance"` // cm
+	WeightTolerance int     `yaml:"weight_tolerance"` // kg
+	AgeWeight       float64 `yaml:"age_weight"`
+	HeightWeight    float64 `yaml:"height_weight"`
+	WeightWeight    float64 `yaml:"weight_weight"`
+	BMIWeight       float64 `yaml:"bmi_weight"`
+	UnknownSex      string  `yaml:"unknown_sex"` // female, male or any
 }
 
 type ServerConfig struct {
@@ -43,9 +56,28 @@ type ServerConfig struct {
 	IdleTimeout      time.Duration `yaml:"idle_timeout"`
 	MaxBodySize      ByteSize      `yaml:"max_body_size"`
 	Address          string        `yaml:"address"`
+	IdempotencyTTL   time.Duration `yaml:"idempotency_ttl"`     // how long Idempotency-Keys of submissions are kept
+	MaxBatchSize     int           `yaml:"max_batch_size"`      // max. patients of a batch submission
+	MaxBatchBodySize ByteSize      `yaml:"max_batch_body_size"` // replaces max_body_size for batch submissions if set
 	TrustedProxies   string        `env:"TRUSTED_PROXIES, required"`
 }
 
+type BlobStoreConfig struct {
+	Backend   string `yaml:"backend"`    // local or s3
+	LocalPath string `yaml:"local_path"` // root folder of the local backend
+	Endpoint  string `yaml:"endpoint"`   // S3 endpoint, e.g. s3.amazonaws.com or 127.0.0.1:9000 (MinIO)
+	Bucket    string `yaml:"bucket"`
+	Region    string `yaml:"region"`
+	UseSSL    bool   `yaml:"use_ssl"`
+	AccessKey string `env:"BLOBSTORE_ACCESS_KEY"`
+	SecretKey string `env:"BLOBSTORE_SECRET_KEY"`
+}
+
+type MetricsConfig struct {
+	Enabled     bool   `yaml:"enabled"`
+	ScrapeToken string `env:"METRICS_SCRAPE_TOKEN"` // if empty, only admins can scrape
+}
+
 type MetaConfig struct {
 	Name        string `yaml:"api_name" json:"api"`
 	Description string `yaml:"api_description" json:"description"`
@@ -76,15 +108,85 @@ type RConfig struct {
 }
 
 type AuthTokenConfig struct {
-	Secret                Bytes         `env:"JWT_SECRET, required"`
-	AccessExpirationTime  time.Duration `yaml:"access_expiration_time"`
-	RefreshExpirationTime time.Duration `yaml:"refresh_expiration_time"`
-	Issuer                string        `yaml:"issuer"`
+	Secret                Bytes               `env:"JWT_SECRET, required"`
+	SigningMethod         string              `yaml:"signing_method"`    // HS256 (shared secret), RS256 or EdDSA
+	SigningKey            string              `yaml:"signing_key"`       // PEM private key file (RS256, EdDSA)
+	VerificationKeys      []string            `yaml:"verification_keys"` // PEM files of previous keys, still accepted
+	AccessExpirationTime  time.Duration       `yaml:"access_expiration_time"`
+	RefreshExpirationTime time.Duration       `yaml:"refresh_expiration_time"`
+	ResetExpirationTime   time.Duration       `yaml:"reset_expiration_time"`  // password reset links
+	InviteExpirationTime  time.Duration       `yaml:"invite_expiration_time"` // account setup links of invited users
+	APIKeyCacheTTL        time.Duration       `yaml:"api_key_cache_ttl"`      // verified API keys are cached
+	SessionCacheTTL       time.Duration       `yaml:"session_cache_ttl"`      // until other instances apply revocations
+	Issuer                string              `yaml:"issuer"`
+	LoginLockout          LockoutConfig       `yaml:"login_lockout"`
+	ResetThrottle         ResetThrottleConfig `yaml:"reset_throttle"`
+}
+
+// LockoutConfig is the policy against brute-force logins. Failed logins within Window
+// count: after FreeAttempts each further attempt must wait BaseDelay, doubled per failure.
+// MaxAttempts (per account) or MaxAttemptsIP (per client IP) lock logins for LockoutDuration.
+type LockoutConfig struct {
+	FreeAttempts    int           `yaml:"free_attempts"`
+	BaseDelay       time.Duration `yaml:"base_delay"`
+	MaxAttempts     int           `yaml:"max_attempts"`
+	MaxAttemptsIP   int           `yaml:"max_attempts_ip"`
+	Window          time.Duration `yaml:"window"`
+	LockoutDuration time.Duration `yaml:"lockout_duration"`
+}
+
+// ResetThrottleConfig limits password reset requests within Window to MaxPerEmail
+// per email and MaxPerIP per client IP, 0 disables a limit.
+type ResetThrottleConfig struct {
+	MaxPerEmail int           `yaml:"max_per_email"`
+	MaxPerIP    int           `yaml:"max_per_ip"`
+	Window      time.Duration `yaml:"window"`
+}
+
+type MailConfig struct {
+	Backend  string `yaml:"backend"` // log or smtp
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	From     string `yaml:"from"`
+	ResetURL string `yaml:"reset_url"` // link in the mails, the token is appended as query parameter
+	Username string `env:"SMTP_USERNAME"`
+	Password string `env:"SMTP_PASSWORD"`
+}
+
+// OIDCConfig enables login via an external OpenID Connect identity provider.
+// IdP claims are mapped to local users; unknown users are created if JITProvisioning is set.
+type OIDCConfig struct {
+	Enabled              bool              `yaml:"enabled"`
+	IssuerURL            string            `yaml:"issuer_url"`
+	ClientID             string            `yaml:"client_id"`
+	RedirectURL          string            `yaml:"redirect_url"` // callback, /user/oidc/callback or a frontend forwarding code and state
+	Scopes               []string          `yaml:"scopes"`
+	StateTTL             time.Duration     `yaml:"state_ttl"` // max. time between login redirect and callback
+	Claims               OIDCClaimsConfig  `yaml:"claims"`
+	RoleMapping          map[string]string `yaml:"role_mapping"` // IdP role -> local role (admin, debug, user)
+	DefaultRole          string            `yaml:"default_role"` // role of provisioned users without mapped role, empty denies
+	JITProvisioning      bool              `yaml:"jit_provisioning"`
+	RequireVerifiedEmail bool              `yaml:"require_verified_email"`
+	ServiceAudience      string            `yaml:"service_audience"` // audience of client credentials tokens, empty disables
+	ServiceClients       map[string]string `yaml:"service_clients"`  // IdP client ID -> email of the local service user
+	ClientSecret         string            `env:"OIDC_CLIENT_SECRET"`
+}
+
+// OIDCClaimsConfig names the claims of the ID token, nested claims as path (e.g. realm_access.roles).
+type OIDCClaimsConfig struct {
+	Email        string `yaml:"email"`
+	FirstName    string `yaml:"first_name"`
+	LastName     string `yaml:"last_name"`
+	Organization string `yaml:"organization"`
+	Roles        string `yaml:"roles"`
 }
 
 type MedInfoConfig struct {
 	URL             string        `yaml:"url"`
 	ExpiryThreshold time.Duration `yaml:"expiry_threshold"`
+	CacheSize       int           `yaml:"cache_size"` // 0 disables the cache
+	CacheTTL        time.Duration `yaml:"cache_ttl"`
+	StaleTTL        time.Duration `yaml:"stale_ttl"` // serve expired entries if MedInfo is down
 	Login           string        `env:"MEDINFO_LOGIN, required"`
 	Password        string        `env:"MEDINFO_PASSWORD, required"`
 }
@@ -107,6 +209,19 @@ type MMCConfig struct {
 	Password        string        `env:"MMC_PASSWORD, required"`
 }
 
+type WebhookConfig struct {
+	Interval   time.Duration `yaml:"fetch_interval"`
+	BatchSize  int           `yaml:"batch_size"`
+	MaxRetries int           `yaml:"max_retries"`
+	Timeout    time.Duration `yaml:"timeout"`
+	Secret     Bytes         `env:"WEBHOOK_SECRET, required"`
+}
+
+// CleanupConfig is how often expired records (e.g. idempotency keys) are purged.
+type CleanupConfig struct {
+	Interval time.Duration `yaml:"interval"`
+}
+
 type JobRunnerConfig struct {
 	Interval time.Duration `yaml:"fetch_interval"`
 	Timeout  time.Duration `yaml:"timeout"`
@@ -174,6 +289,12 @@ type APIConfig struct {
 	Schema       SchemaConfig       `yaml:"schema"`
 	Models       Models             `yaml:"models"`
 	MMCAPI       MMCConfig          `yaml:"mmc"`
+	Webhook      WebhookConfig      `yaml:"webhook"`
+	Cleanup      CleanupConfig      `yaml:"cleanup"`
+	Metrics      MetricsConfig      `yaml:"metrics"`
+	BlobStore    BlobStoreConfig    `yaml:"blob_store"`
+	Mail         MailConfig         `yaml:"mail"`
+	OIDC         OIDCConfig         `yaml:"oidc"`
 }
 
 // Read reads the configuration file and environment variables
@@ -221,9 +342,10 @@ func MustParseEnvFile(envFile *string) {
 }
 
 type CmdLineArgs struct {
-	DebugMode  bool
-	ConfigFile string
-	EnvFile    string
+	DebugMode    bool
+	ConfigFile   string
+	EnvFile      string
+	MigrateBlobs bool
 }
 
 func ParseCmdLineArgs() CmdLineArgs {
@@ -231,6 +353,7 @@ func ParseCmdLineArgs() CmdLineArgs {
 	flag.BoolVar(&args.DebugMode, "debug", false, "Enable debug mode")
 	flag.StringVar(&args.ConfigFile, "config", "config.yml", "Config file path")
 	flag.StringVar(&args.EnvFile, "env", "", ".env file path (if not set, will use .env if exists)")
+	flag.BoolVar(&args.MigrateBlobs, "migrate-blobs", false, "Move result PDFs from the database to the blob store and exit")
 	flag.Parse()
 
 	return args
@@ -0,0 +1,194 @@
+package apikey
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"precisiondosing-api-go/internal/model"
+	"precisiondosing-api-go/internal/utils/log"
+	"precisiondosing-api-go/internal/utils/tokens"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var ErrInvalidKey = errors.New("invalid API key")
+
+// Identity is the user an API key acts for.
+type Identity struct {
+	KeyID  uint
+	UserID uint
+	Email  string
+	Role   string
+	OrgID  uint // organization (tenant) of the user, 0 if none
+	Scopes []string
+	// permissions of the user's role, loaded with the key
+	Permissions []string
+}
+
+type cachedKey struct {
+	identity  Identity
+	expiresAt *time.Time
+	cachedAt  time.Time
+}
+
+// Authenticator verifies API keys. Verifying the argon2 hash is expensive,
+// verified keys are cached for cacheTTL (also the delay until changes of the user,
+// e.g. deactivation, apply). Revoking a key drops it from the cache immediately.
+type Authenticator struct {
+	db       *gorm.DB
+	cacheTTL time.Duration
+	mutex    sync.Mutex
+	cache    map[[sha256.Size]byte]cachedKey
+	logger   log.Logger
+}
+
+func New(db *gorm.DB, cacheTTL time.Duration) *Authenticator {
+	return &Authenticator{
+		db:       db,
+		cacheTTL: cacheTTL,
+		cache:    make(map[[sha256.Size]byte]cachedKey),
+		logger:   log.WithComponent("apikey"),
+	}
+}
+
+func (a *Authenticator) Authenticate(ctx context.Context, key string) (*Identity, error) {
+	now := time.Now()
+	digest := sha256.Sum256([]byte(key))
+
+	a.mutex.Lock()
+	cached, ok := a.cache[digest]
+	if ok && now.Sub(cached.cachedAt) < a.cacheTTL &&
+		(cached.expiresAt == nil || now.Before(*cached.expiresAt)) {
+		a.mutex.Unlock()
+		return &cached.identity, nil
+	}
+	delete(a.cache, digest)
+	a.mutex.Unlock()
+
+	prefix, secret, err := tokens.SplitAPIKey(key)
+	if err != nil {
+		return nil, ErrInvalidKey
+	}
+
+	var apiKey model.APIKey
+	if err = a.db.WithContext(ctx).Joins("User").
+		Where(&model.APIKey{Prefix: prefix}).First(&apiKey).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidKey
+		}
+		return nil, err
+	}
+
+	if !tokens.CheckAPIKeySecret(apiKey.KeyHash, secret) || apiKey.Expired(now) {
+		return nil, ErrInvalidKey
+	}
+
+	// the user is left joined, it is empty if deleted
+	if apiKey.User.ID == 0 || apiKey.User.DeletedAt.Valid || apiKey.User.Status != "active" {
+		return nil, ErrInvalidKey
+	}
+
+	var permissions []string
+	role, err := model.GetRole(a.db.WithContext(ctx), apiKey.User.Role)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	if role != nil {
+		permissions = role.Permissions
+	}
+
+	// last usage is tracked with the granularity of the cache
+	if err = a.db.WithContext(ctx).Model(&apiKey).UpdateColumn("last_used_at", now).Error; err != nil {
+		a.logger.Warn("updating last usage", log.Str("prefix", prefix), log.Err(err))
+	}
+
+	identity := Identity{
+		KeyID:       apiKey.ID,
+		UserID:      apiKey.UserID,
+		Email:       apiKey.User.Email,
+		Role:        apiKey.User.Role,
+		OrgID:       apiKey.User.OrgID(),
+		Scopes:      apiKey.Scopes,
+		Permissions: permissions,
+	}
+
+	a.mutex.Lock()
+	a.cache[digest] = cachedKey{identity: identity, expiresAt: apiKey.ExpiresAt, cachedAt: now}
+	a.mutex.Unlock()
+
+	return &identity, nil
+}
+
+// Create stores a new key for the user and returns it with the key to hand out.
+// The key itself is not stored and cannot be shown again.
+func Create(db *gorm.DB, userID uint, name string, scopes []string, expiresAt *time.Time) (*model.APIKey, string, error) {
+	generated, err := tokens.CreateAPIKey()
+	if err != nil {
+		return nil, "", err
+	}
+
+	apiKey := &model.APIKey{
+		UserID:    userID,
+		Name:      name,
+		Prefix:    generated.Prefix,
+		KeyHash:   generated.KeyHash,
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+	}
+
+	if err = db.Create(apiKey).Error; err != nil {
+		return nil, "", fmt.Errorf("cannot store API key: %w", err)
+	}
+
+	return apiKey, generated.Key, nil
+}
+
+// Revoke deletes the key of the user. Returns gorm.ErrRecordNotFound for unknown keys.
+func (a *Authenticator) Revoke(userID uint, prefix string) error {
+	var apiKey model.APIKey
+	if err := a.db.Where(&model.APIKey{UserID: userID, Prefix: prefix}).First(&apiKey).Error; err != nil {
+		return err
+	}
+
+	if err := a.db.Delete(&apiKey).Error; err != nil {
+		return err
+	}
+
+	a.mutex.Lock()
+	for digest, cached := range a.cache {
+		if cached.identity.KeyID == apiKey.ID {
+			delete(a.cache, digest)
+		}
+	}
+	a.mutex.Unlock()
+
+	return nil
+}
+
+// CreateRequest is the body to create an API key.
+type CreateRequest struct {
+	Name string `json:"name" binding:"required,min=2,max=255" example:"EHR integration"`
+	// Optional, the key has all permissions of the user if not set
+	Scopes []string `json:"scopes" binding:"omitempty,dive,oneof=dose orders:read models:read account admin"`
+	// Optional, the key never expires if not set
+	ExpiresAt *time.Time `json:"expires_at" example:"2026-01-01T00:00:00Z"`
+} //	@name	CreateAPIKeyRequest
+
+// Validate checks the request. The scopes only limit a key, the permissions
+// of the user's role still apply.
+func (r *CreateRequest) Validate() error {
+	if r.ExpiresAt != nil && !r.ExpiresAt.After(time.Now()) {
+		return errors.New("expiry must be in the future")
+	}
+
+	return nil
+}
+
+// CreateResponse holds the new key, which is only shown once.
+type CreateResponse struct {
+	model.APIKey
+	Key string `json:"key" example:"pdk_0a1b2c3d4e5f_secret"`
+} //	@name	CreateAPIKeyResponse
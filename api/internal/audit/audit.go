@@ -0,0 +1,121 @@
+// Package audit writes the append-only audit trail of administrative and
+// data-access actions (compliance requirement for access to health data).
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"precisiondosing-api-go/internal/middleware"
+	"precisiondosing-api-go/internal/model"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Actions
+const (
+	OrderRequeue          = "order.requeue"
+	OrderResend           = "order.resend"
+	OrderDelete           = "order.delete"
+	OrderCancel           = "order.cancel"
+	OrderDownload         = "order.download"
+	OrderPDFDownload      = "order.pdf_download"
+	OrderPrecheckDownload = "order.precheck_download"
+
+	UserCreate         = "user.create"
+	UserUpdate         = "user.update"
+	UserDelete         = "user.delete"
+	UserInvite         = "user.invite"
+	UserSessionsRevoke = "user.sessions_revoke"
+	UserLockoutClear   = "user.lockout_clear"
+
+	APIKeyCreate = "api_key.create"
+	APIKeyRevoke = "api_key.revoke"
+
+	RoleCreate = "role.create"
+	RoleUpdate = "role.update"
+	RoleDelete = "role.delete"
+
+	OrganizationCreate = "organization.create"
+	OrganizationUpdate = "organization.update"
+	OrganizationDelete = "organization.delete"
+
+	MedInfoCacheFlush = "medinfo.cache_flush"
+)
+
+const maxUserAgentLength = 512
+
+// Entry is an action on a target. Before and After are stored as JSON,
+// nil values are left empty.
+type Entry struct {
+	Action     string
+	TargetType string
+	TargetID   string
+	Before     any
+	After      any
+	Actor      *model.User // replaces the caller if the request is not authenticated yet, e.g. a login
+}
+
+// Record writes the entry for the caller of the request.
+// Pass a transaction to make the entry part of the change.
+func Record(db *gorm.DB, c *gin.Context, entry Entry) error {
+	before, err := marshal(entry.Before)
+	if err != nil {
+		return err
+	}
+
+	after, err := marshal(entry.After)
+	if err != nil {
+		return err
+	}
+
+	userAgent := c.Request.UserAgent()
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+
+	log := model.AuditLog{
+		ActorID:    middleware.UserID(c),
+		ActorEmail: middleware.UserMail(c),
+		ActorRole:  middleware.UserRole(c),
+		Action:     entry.Action,
+		TargetType: entry.TargetType,
+		TargetID:   entry.TargetID,
+		IP:         c.ClientIP(),
+		UserAgent:  userAgent,
+		Before:     before,
+		After:      after,
+	}
+
+	if keyID := middleware.APIKeyID(c); keyID != 0 {
+		log.APIKeyID = &keyID
+	}
+	if orgID := middleware.OrganizationID(c); orgID != 0 {
+		log.OrganizationID = &orgID
+	}
+
+	if entry.Actor != nil {
+		log.ActorID = entry.Actor.ID
+		log.ActorEmail = entry.Actor.Email
+		log.ActorRole = entry.Actor.Role
+		log.OrganizationID = entry.Actor.OrganizationID
+	}
+
+	if err = db.Create(&log).Error; err != nil {
+		return fmt.Errorf("cannot write audit log: %w", err)
+	}
+
+	return nil
+}
+
+func marshal(value any) (json.RawMessage, error) {
+	if value == nil {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("cannot marshal audit value: %w", err)
+	}
+	return data, nil
+}
@@ -0,0 +1,41 @@
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"precisiondosing-api-go/cfg"
+	"time"
+)
+
+const (
+	BackendLocal = "local"
+	BackendS3    = "s3"
+)
+
+var ErrNotFound = errors.New("blob not found")
+
+// Object is an opened blob. It supports seeking for range requests.
+type Object struct {
+	io.ReadSeekCloser
+	Size    int64
+	ModTime time.Time
+}
+
+type Store interface {
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	Get(ctx context.Context, key string) (*Object, error)
+	Delete(ctx context.Context, key string) error
+}
+
+func New(config cfg.BlobStoreConfig) (Store, error) {
+	switch config.Backend {
+	case BackendLocal:
+		return NewLocal(config.LocalPath)
+	case BackendS3:
+		return NewS3(config)
+	default:
+		return nil, fmt.Errorf("unknown blob store backend %q", config.Backend)
+	}
+}
@@ -0,0 +1,154 @@
+package blobstore
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"precisiondosing-api-go/internal/model"
+	"precisiondosing-api-go/internal/utils/log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const pdfContentType = "application/pdf"
+
+// PDFKey returns the blob key of the result PDF of an order.
+func PDFKey(orderID string) string {
+	return "pdfs/" + orderID + ".pdf"
+}
+
+// IngestPDF moves the base64 PDF written by R into the blob store. The key, hash
+// and size are saved on the order and the staging column is cleared.
+// Returns false if the order has no staged PDF.
+func IngestPDF(ctx context.Context, store Store, db *gorm.DB, order *model.Order) (bool, error) {
+	var staged model.Order
+	if err := db.WithContext(ctx).Select("id", "process_result_pdf").
+		First(&staged, order.ID).Error; err != nil {
+		return false, fmt.Errorf("cannot load staged PDF: %w", err)
+	}
+
+	if staged.ProcessResultPDF == nil {
+		return false, nil
+	}
+
+	pdfBytes, err := base64.StdEncoding.DecodeString(*staged.ProcessResultPDF)
+	if err != nil {
+		return false, fmt.Errorf("cannot decode PDF: %w", err)
+	}
+
+	sum := sha256.Sum256(pdfBytes)
+	key := PDFKey(order.OrderID)
+	hash := hex.EncodeToString(sum[:])
+	size := int64(len(pdfBytes))
+
+	if err = store.Put(ctx, key, bytes.NewReader(pdfBytes), size, pdfContentType); err != nil {
+		return false, err
+	}
+
+	if err = db.WithContext(ctx).Model(&model.Order{}).
+		Where("id = ?", order.ID).
+		Updates(map[string]interface{}{
+			"result_pdf_key":     key,
+			"result_pdf_hash":    hash,
+			"result_pdf_size":    size,
+			"process_result_pdf": nil,
+		}).Error; err != nil {
+		return false, fmt.Errorf("cannot save PDF reference: %w", err)
+	}
+
+	order.ResultPDFKey = &key
+	order.ResultPDFHash = &hash
+	order.ResultPDFSize = &size
+	order.ProcessResultPDF = nil
+	return true, nil
+}
+
+// OpenPDF opens the result PDF of an order. Orders that were not migrated yet
+// are served from the legacy base64 column.
+// The order must have the result_pdf_key and process_result_pdf fields loaded.
+func OpenPDF(ctx context.Context, store Store, order *model.Order) (*Object, error) {
+	if order.ResultPDFKey != nil {
+		return store.Get(ctx, *order.ResultPDFKey)
+	}
+
+	if order.ProcessResultPDF == nil {
+		return nil, ErrNotFound
+	}
+
+	pdfBytes, err := base64.StdEncoding.DecodeString(*order.ProcessResultPDF)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode PDF: %w", err)
+	}
+
+	return &Object{
+		ReadSeekCloser: nopCloser{bytes.NewReader(pdfBytes)},
+		Size:           int64(len(pdfBytes)),
+		ModTime:        order.UpdatedAt,
+	}, nil
+}
+
+// ReadPDF returns the complete result PDF of an order.
+func ReadPDF(ctx context.Context, store Store, order *model.Order) ([]byte, error) {
+	obj, err := OpenPDF(ctx, store, order)
+	if err != nil {
+		return nil, err
+	}
+	defer obj.Close()
+
+	return io.ReadAll(obj)
+}
+
+// MigrateOrders moves all PDFs still stored in the database into the blob store.
+// Orders in processing are skipped, R might still write to them.
+// Returns the number of migrated orders.
+func MigrateOrders(ctx context.Context, store Store, db *gorm.DB, batchSize int) (int, error) {
+	logger := log.WithComponent("blobstore")
+
+	migrated := 0
+	lastID := uint(0)
+	for {
+		var orders []model.Order
+		if err := db.WithContext(ctx).Select("id", "order_id").
+			Where("id > ? AND process_result_pdf IS NOT NULL AND status <> ?", lastID, model.StatusProcessing).
+			Order("id").
+			Limit(batchSize).
+			Find(&orders).Error; err != nil {
+			return migrated, fmt.Errorf("cannot fetch orders: %w", err)
+		}
+
+		if len(orders) == 0 {
+			return migrated, nil
+		}
+
+		for i := range orders {
+			order := &orders[i]
+			lastID = order.ID
+
+			start := time.Now()
+			if _, err := IngestPDF(ctx, store, db, order); err != nil {
+				if errors.Is(err, context.Canceled) {
+					return migrated, err
+				}
+				logger.Error("migrating PDF", log.Str("orderID", order.OrderID), log.Err(err))
+				continue
+			}
+
+			migrated++
+			logger.Debug("migrated PDF", log.Str("orderID", order.OrderID), log.Str("took", time.Since(start).String()))
+		}
+
+		logger.Info("migrated PDFs", log.Int("count", migrated))
+	}
+}
+
+type nopCloser struct {
+	io.ReadSeeker
+}
+
+func (nopCloser) Close() error { return nil }
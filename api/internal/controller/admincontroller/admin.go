@@ -1,11 +1,20 @@
 package admincontroller
 
 import (
-	"errors"
+	"context"
 	"fmt"
+	"precisiondosing-api-go/cfg"
+	"precisiondosing-api-go/internal/apikey"
+	"precisiondosing-api-go/internal/audit"
 	"precisiondosing-api-go/internal/handle"
+	"precisiondosing-api-go/internal/loginguard"
+	"precisiondosing-api-go/internal/middleware"
 	"precisiondosing-api-go/internal/model"
+	"precisiondosing-api-go/internal/services/mailer"
+	"precisiondosing-api-go/internal/services/medinfo"
+	"precisiondosing-api-go/internal/session"
 	"precisiondosing-api-go/internal/utils/hash"
+	"precisiondosing-api-go/internal/utils/log"
 	"precisiondosing-api-go/internal/utils/validate"
 
 	"github.com/gin-gonic/gin"
@@ -13,19 +22,37 @@ import (
 )
 
 type AdminController struct {
-	DB *gorm.DB
+	DB         *gorm.DB
+	MedInfo    *medinfo.API
+	AuthCfg    cfg.AuthTokenConfig
+	MailCfg    cfg.MailConfig
+	Mailer     mailer.Mailer
+	APIKeys    *apikey.Authenticator
+	Sessions   *session.Store
+	LoginGuard *loginguard.Guard
+	logger     log.Logger
 }
 
 func New(resourceHandle *handle.ResourceHandle) *AdminController {
 	return &AdminController{
-		DB: resourceHandle.Databases.GormDB,
+		DB:         resourceHandle.Databases.GormDB,
+		MedInfo:    resourceHandle.Prechecker.MedInfoAPI,
+		AuthCfg:    resourceHandle.AuthCfg,
+		MailCfg:    resourceHandle.MailCfg,
+		Mailer:     resourceHandle.Mailer,
+		APIKeys:    resourceHandle.APIKeys,
+		Sessions:   resourceHandle.Sessions,
+		LoginGuard: resourceHandle.LoginGuard,
+		logger:     log.WithComponent("admincontroller"),
 	}
 }
 
 // @Summary		Create a new service user
-// @Description	__Admin role required__
+// @Description	__Permission `users:manage` required__
 // @Description	Create a new service user for the API.
-// @Description	You can create users with the following roles: `admin`, `user`, `debug`.
+// @Description	The role must exist and be covered by the caller's role (see `/admin/roles`).
+// @Description	Callers with `tenant:all` assign the `organization` (created if missing), others create users of their organization.
+// @Description	Without `password` the user is invited: a mail with a single-use link to set the password is sent.
 // @Tags			Admin
 // @Produce		json
 // @Param			request	body		CreateServiceUserQuery							true	"Request body"
@@ -44,9 +71,13 @@ func (ac *AdminController) CreateServiceUser(c *gin.Context) {
 		Email     string `json:"email" binding:"required,email,min=2,max=255" example:"joe@gmail.com"`
 		FirstName string `json:"first_name" binding:"required,min=2,max=255" example:"Joe"`
 		LastName  string `json:"last_name" binding:"required,min=2,max=255" example:"Doe"`
-		Org       string `json:"organization" binding:"required,min=2,max=255" example:"ACME"`
-		Role      string `json:"role" binding:"required,oneof=admin user debug"`
-		Password  string `json:"password" binding:"required" example:"password123"`
+		// Required with tenant:all, otherwise users of the own organization are created
+		Org  string `json:"organization" binding:"omitempty,min=2,max=255" example:"ACME"`
+		Role string `json:"role" binding:"required,max=50" example:"user"`
+		// Optional, invites the user by mail if not set
+		Password *string `json:"password" example:"password123"`
+		// Optional default webhook for the status changes of the user's orders
+		CallbackURL *string `json:"callback_url" example:"https://ehr.example.org/hooks/doseadjust"`
 	} //	@name	CreateServiceUserQuery
 
 	var query Query
@@ -69,20 +100,32 @@ func (ac *AdminController) CreateServiceUser(c *gin.Context) {
 		return
 	}
 
-	if err := validate.Organization(query.Org); err != nil {
-		handle.BadRequestError(c, fmt.Sprintf("Invalid organization: %s", err))
+	if query.Org != "" {
+		if err := validate.Organization(query.Org); err != nil {
+			handle.BadRequestError(c, fmt.Sprintf("Invalid organization: %s", err))
+			return
+		}
+	} else if middleware.AllTenants(c) {
+		handle.BadRequestError(c, "Organization is required")
 		return
 	}
 
-	if err := validate.Password(query.Password); err != nil {
-		handle.BadRequestError(c, "Invalid password")
+	if !ac.coversRole(c, query.Role, "Cannot create users with a higher role") {
 		return
 	}
 
-	hashedPwd, err := hash.Create(query.Password)
-	if err != nil {
-		handle.ServerError(c, err)
-		return
+	if query.Password != nil {
+		if err := validate.Password(*query.Password); err != nil {
+			handle.BadRequestError(c, "Invalid password")
+			return
+		}
+	}
+
+	if query.CallbackURL != nil {
+		if err := validate.CallbackURL(*query.CallbackURL); err != nil {
+			handle.BadRequestError(c, fmt.Sprintf("Invalid callback URL: %s", err))
+			return
+		}
 	}
 
 	// create user
@@ -90,14 +133,23 @@ func (ac *AdminController) CreateServiceUser(c *gin.Context) {
 		Email:     query.Email,
 		FirstName: query.FirstName,
 		LastName:  query.LastName,
-		Org:       query.Org,
 		Role:      query.Role,
 		Status:    "active",
-		PwdHash:   &hashedPwd,
+
+		CallbackURL: query.CallbackURL,
+	}
+
+	if query.Password != nil {
+		hashedPwd, err := hash.Create(*query.Password)
+		if err != nil {
+			handle.ServerError(c, err)
+			return
+		}
+		user.PwdHash = &hashedPwd
 	}
 
 	// check if email is available and create a user +
-	if err = ac.DB.Transaction(func(tx *gorm.DB) error {
+	if err := ac.DB.Transaction(func(tx *gorm.DB) error {
 		mailAvailable, mailErr := model.IsEmailAvailable(query.Email, tx, 0)
 		if mailErr != nil {
 			handle.ServerError(c, mailErr)
@@ -109,24 +161,128 @@ func (ac *AdminController) CreateServiceUser(c *gin.Context) {
 			return gorm.ErrInvalidTransaction
 		}
 
+		org, orgErr := ac.userOrganization(c, tx, query.Org)
+		if orgErr != nil {
+			return orgErr
+		}
+		user.OrganizationID = &org.ID
+		user.Org = org.Name
+
 		if createErr := tx.Create(&user).Error; createErr != nil {
 			handle.ServerError(c, createErr)
 			return gorm.ErrInvalidTransaction
 		}
 
+		if auditErr := audit.Record(tx, c, audit.Entry{
+			Action:     audit.UserCreate,
+			TargetType: model.TargetUser,
+			TargetID:   user.Email,
+			After:      user,
+		}); auditErr != nil {
+			handle.ServerError(c, auditErr)
+			return gorm.ErrInvalidTransaction
+		}
+
 		return nil
 	}); err != nil {
 		return
 	}
 
-	handle.Success(c, gin.H{"message": "Service user created"})
+	if user.PwdHash != nil {
+		handle.Success(c, gin.H{"message": "Service user created"})
+		return
+	}
+
+	if err := ac.sendInvite(c.Request.Context(), &user); err != nil {
+		ac.logger.Error("inviting user", log.Str("email", user.Email), log.Err(err))
+		handle.Success(c, gin.H{"message": "Service user created, invitation could not be sent"})
+		return
+	}
+
+	handle.Success(c, gin.H{"message": "Service user created and invited"})
+}
+
+// @Summary		Resend the invitation of a user
+// @Description	__Permission `users:manage` required__
+// @Description	Sends a new account setup link to a user without password. Older links become invalid.
+// @Tags			Admin
+// @Produce		json
+// @Param			email	path		string										true	"User email"
+// @Success		200		{object}	handle.jsendSuccess[map[string]string]		"Invitation sent"
+// @Failure		400		{object}	handle.jsendFailure[handle.errorResponse]	"User has already set a password"
+// @Failure		401		{object}	handle.jsendFailure[handle.errorResponse]	"Unauthorized"
+// @Failure		403		{object}	handle.jsendFailure[handle.errorResponse]	"Non-admin user"
+// @Failure		404		{object}	handle.jsendFailure[handle.errorResponse]	"User not found"
+// @Failure		500		{object}	handle.jSendError							"Internal server error"
+//
+// @Security		Bearer
+//
+// @Router			/admin/users/{email}/invite [post]
+func (ac *AdminController) ResendInvite(c *gin.Context) {
+	user, ok := ac.tenantUser(c)
+	if !ok {
+		return
+	}
+
+	if user.PwdHash != nil {
+		handle.BadRequestError(c, "User has already set a password")
+		return
+	}
+
+	if err := ac.sendInvite(c.Request.Context(), user); err != nil {
+		handle.ServerError(c, err)
+		return
+	}
+
+	ac.record(c, audit.Entry{Action: audit.UserInvite, TargetType: model.TargetUser, TargetID: user.Email})
+	handle.Success(c, gin.H{"message": "Invitation sent"})
+}
+
+// userOrganization returns the organization of a new user: the named one for callers
+// with tenant:all (created if missing), otherwise the own one.
+// On failure the error response is written.
+func (ac *AdminController) userOrganization(c *gin.Context, tx *gorm.DB, name string) (*model.Organization, error) {
+	if middleware.AllTenants(c) {
+		org, err := model.FindOrCreateOrganization(tx, name)
+		if err != nil {
+			handle.ServerError(c, err)
+			return nil, gorm.ErrInvalidTransaction
+		}
+		return org, nil
+	}
+
+	org, err := model.GetOrganization(tx, middleware.OrganizationID(c))
+	if err != nil {
+		handle.ForbiddenError(c, "No organization assigned")
+		return nil, gorm.ErrInvalidTransaction
+	}
+
+	if name != "" && name != org.Name {
+		handle.ForbiddenError(c, "Cannot create users of another organization")
+		return nil, gorm.ErrInvalidTransaction
+	}
+
+	return org, nil
+}
+
+func (ac *AdminController) sendInvite(ctx context.Context, user *model.User) error {
+	validFor := ac.AuthCfg.InviteExpirationTime
+	token, err := model.IssueUserToken(ac.DB, user.ID, model.TokenPurposeInvite, validFor)
+	if err != nil {
+		return err
+	}
+
+	return ac.Mailer.Send(ctx, mailer.InviteMail(user.Email, ac.MailCfg.ResetURL, token, validFor))
 }
 
 // @Summary		Get all users
-// @Description	__Admin role required__
-// @Description	List all users for the API.
+// @Description	__Permission `users:manage` required__
+// @Description	List all users for the API. Callers without `tenant:all` see the users of their organization.
 // @Tags			Admin
 // @Produce		json
+// @Param			role			query		string										false	"Filter by role"
+// @Param			status			query		string										false	"Filter by status"
+// @Param			organization_id	query		int											false	"Filter by organization"
 // @Success		200	{object}	handle.jsendSuccess[map[string]string]		"User created"
 // @Failure		400	{object}	handle.jsendFailure[handle.errorResponse]	"Bad request"
 // @Failure		401	{object}	handle.jsendFailure[handle.errorResponse]	"Unauthorized"
@@ -138,15 +294,19 @@ func (ac *AdminController) CreateServiceUser(c *gin.Context) {
 // @Router			/admin/users [get]
 func (ac *AdminController) GetUsers(c *gin.Context) {
 	var query struct {
-		Role   string `form:"role" binding:"omitempty,oneof=admin user debug"`
-		Status string `form:"status" binding:"omitempty,oneof=active inactive"`
+		Role           string `form:"role" binding:"omitempty,max=50"`
+		Status         string `form:"status" binding:"omitempty,oneof=active inactive"`
+		OrganizationID uint   `form:"organization_id"`
 	}
 
 	if !handle.QueryBind(c, &query) {
 		return
 	}
 
-	db := ac.DB
+	db := ac.DB.Scopes(middleware.TenantScope(c, "users"))
+	if query.OrganizationID != 0 {
+		db = db.Scopes(model.OrgScope("users", query.OrganizationID))
+	}
 	if query.Role != "" {
 		db = db.Where(&model.User{Role: query.Role})
 	}
@@ -170,7 +330,7 @@ func (ac *AdminController) GetUsers(c *gin.Context) {
 }
 
 // @Summary		Get user by email
-// @Description	__Admin role required__
+// @Description	__Permission `users:manage` required__
 // @Description	Retrieve a single user by their email address.
 // @Tags			Admin
 // @Produce		json
@@ -184,14 +344,8 @@ func (ac *AdminController) GetUsers(c *gin.Context) {
 // @Security		Bearer
 // @Router			/admin/users/{email} [get]
 func (ac *AdminController) GetUserByEmail(c *gin.Context) {
-	user, err := model.GetUserByEmail(ac.DB, c.Param("email"))
-	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			handle.NotFoundError(c, "User not found")
-			return
-		}
-
-		handle.ServerError(c, err)
+	user, ok := ac.tenantUser(c)
+	if !ok {
 		return
 	}
 
@@ -199,8 +353,9 @@ func (ac *AdminController) GetUserByEmail(c *gin.Context) {
 }
 
 // @Summary		Delete user by email
-// @Description	__Admin role required__
+// @Description	__Permission `users:manage` required__
 // @Description	Delete a user by their email address. Cannot delete own account.
+// @Description	All sessions of the user are revoked.
 // @Tags			Admin
 // @Produce		json
 // @Param			email	path		string										true	"User email"
@@ -221,23 +376,37 @@ func (ac *AdminController) DeleteUserByEmail(c *gin.Context) {
 		return
 	}
 
-	user, err := model.GetUserByEmail(ac.DB, emailToDelete)
-	if err != nil {
-		handle.NotFoundError(c, "User not found")
+	user, ok := ac.tenantUser(c)
+	if !ok {
 		return
 	}
 
-	if err = ac.DB.Delete(&user).Error; err != nil {
+	if err := ac.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&user).Error; err != nil {
+			return err
+		}
+
+		return audit.Record(tx, c, audit.Entry{
+			Action:     audit.UserDelete,
+			TargetType: model.TargetUser,
+			TargetID:   user.Email,
+			Before:     user,
+		})
+	}); err != nil {
 		handle.ServerError(c, err)
 		return
 	}
 
+	ac.revokeSessions(c, user.ID, session.ReasonUserDeleted)
 	handle.Success(c, gin.H{"message": "User deleted"})
 }
 
 // @Summary		Change user profile
-// @Description	__Admin role required__
-// @Description	Update a user's role or status. Cannot change own role or status.
+// @Description	__Permission `users:manage` required__
+// @Description	Update a user's role, status or default callback URL. Cannot change own role or status.
+// @Description	An empty `callback_url` removes the default callback.
+// @Description	Only roles covered by the caller's role can be assigned. Only callers with `tenant:all` move users to another organization.
+// @Description	Deactivating a user or changing the organization revokes all sessions.
 // @Tags			Admin
 // @Accept			json
 // @Produce		json
@@ -253,8 +422,12 @@ func (ac *AdminController) DeleteUserByEmail(c *gin.Context) {
 // @Router			/admin/users/{email} [patch]
 func (ac *AdminController) ChangeUserProfile(c *gin.Context) {
 	type Query struct {
-		Role   string `json:"role" binding:"omitempty,oneof=admin user debug" example:"user"`
+		Role   string `json:"role" binding:"omitempty,max=50" example:"user"`
 		Status string `json:"status" binding:"omitempty,oneof=active inactive" example:"inactive"`
+		// Default webhook for the user's orders (empty string removes it)
+		CallbackURL *string `json:"callback_url" example:"https://ehr.example.org/hooks/doseadjust"`
+		// Moves the user to another organization (requires tenant:all)
+		OrganizationID *uint `json:"organization_id" example:"1"`
 	} //	@name	ChangeUserProfileQuery
 	adminID := c.GetUint("user_id")
 
@@ -263,18 +436,34 @@ func (ac *AdminController) ChangeUserProfile(c *gin.Context) {
 		return
 	}
 
-	user, err := model.GetUserByEmail(ac.DB, c.Param("email"))
-	if err != nil {
-		handle.NotFoundError(c, "User not found")
+	user, ok := ac.tenantUser(c)
+	if !ok {
 		return
 	}
 
-	if query.Role == "" && query.Status == "" {
+	if query.Role == "" && query.Status == "" && query.CallbackURL == nil && query.OrganizationID == nil {
 		handle.BadRequestError(c, "No changes requested")
 		return
 	}
 
-	if user.ID == adminID {
+	if query.Role != "" && !ac.coversRole(c, query.Role, "Cannot assign a higher role") {
+		return
+	}
+
+	if query.OrganizationID != nil && !middleware.AllTenants(c) {
+		handle.ForbiddenError(c, "Cannot change the organization")
+		return
+	}
+
+	var err error
+	if query.CallbackURL != nil && *query.CallbackURL != "" {
+		if err = validate.CallbackURL(*query.CallbackURL); err != nil {
+			handle.BadRequestError(c, fmt.Sprintf("Invalid callback URL: %s", err))
+			return
+		}
+	}
+
+	if user.ID == adminID && (query.Role != "" || query.Status != "") {
 		adminCount, adminErr := model.CountActiveAdmins(ac.DB)
 		if adminErr != nil {
 			handle.ServerError(c, err)
@@ -290,6 +479,7 @@ func (ac *AdminController) ChangeUserProfile(c *gin.Context) {
 		return
 	}
 
+	before := *user
 	if query.Role != "" {
 		user.Role = query.Role
 	}
@@ -298,10 +488,104 @@ func (ac *AdminController) ChangeUserProfile(c *gin.Context) {
 		user.Status = query.Status
 	}
 
-	if err = ac.DB.Save(&user).Error; err != nil {
+	if query.CallbackURL != nil {
+		user.CallbackURL = query.CallbackURL
+		if *query.CallbackURL == "" {
+			user.CallbackURL = nil
+		}
+	}
+
+	orgChanged := query.OrganizationID != nil && *query.OrganizationID != user.OrgID()
+	if orgChanged {
+		org, orgErr := model.GetOrganization(ac.DB, *query.OrganizationID)
+		if orgErr != nil {
+			handle.NotFoundError(c, "Organization not found")
+			return
+		}
+		user.OrganizationID = &org.ID
+		user.Org = org.Name
+	}
+
+	if user.OrganizationID == nil {
+		role, roleErr := model.GetRole(ac.DB, user.Role)
+		if roleErr != nil {
+			handle.ServerError(c, roleErr)
+			return
+		}
+
+		if role.NeedsOrganization() {
+			handle.BadRequestError(c, "Role requires an organization")
+			return
+		}
+	}
+
+	if err = ac.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&user).Error; err != nil {
+			return err
+		}
+
+		return audit.Record(tx, c, audit.Entry{
+			Action:     audit.UserUpdate,
+			TargetType: model.TargetUser,
+			TargetID:   user.Email,
+			Before:     before,
+			After:      user,
+		})
+	}); err != nil {
 		handle.ServerError(c, err)
 		return
 	}
 
+	if query.Status == "inactive" {
+		ac.revokeSessions(c, user.ID, session.ReasonUserInactive)
+	} else if orgChanged {
+		// the tokens carry the organization
+		ac.revokeSessions(c, user.ID, session.ReasonAdmin)
+	}
+
 	handle.Success(c, gin.H{"message": "User profile updated"})
 }
+
+// @Summary		Revoke all sessions of a user
+// @Description	__Permission `users:manage` required__
+// @Description	Ends all sessions of a user. Access and refresh tokens stop working, API keys are not affected.
+// @Tags			Admin
+// @Produce		json
+// @Param			email	path		string										true	"User email"
+// @Success		200		{object}	handle.jsendSuccess[map[string]any]			"Sessions revoked"
+// @Failure		401		{object}	handle.jsendFailure[handle.errorResponse]	"Unauthorized"
+// @Failure		403		{object}	handle.jsendFailure[handle.errorResponse]	"Non-admin user"
+// @Failure		404		{object}	handle.jsendFailure[handle.errorResponse]	"User not found"
+// @Failure		500		{object}	handle.jSendError							"Internal server error"
+//
+// @Security		Bearer
+//
+// @Router			/admin/users/{email}/sessions [delete]
+func (ac *AdminController) RevokeUserSessions(c *gin.Context) {
+	user, ok := ac.tenantUser(c)
+	if !ok {
+		return
+	}
+
+	revoked, err := ac.Sessions.RevokeUser(c.Request.Context(), user.ID, session.ReasonAdmin)
+	if err != nil {
+		handle.ServerError(c, err)
+		return
+	}
+
+	ac.record(c, audit.Entry{
+		Action:     audit.UserSessionsRevoke,
+		TargetType: model.TargetUser,
+		TargetID:   user.Email,
+		After:      gin.H{"revoked": revoked},
+	})
+	handle.Success(c, gin.H{"message": "Sessions revoked", "revoked": revoked})
+}
+
+// revokeSessions ends the sessions of a changed user. The change itself is done,
+// a failure is only logged, the sessions end with the expiry of the tokens.
+func (ac *AdminController) revokeSessions(c *gin.Context, userID uint, reason string) {
+	if _, err := ac.Sessions.RevokeUser(c.Request.Context(), userID, reason); err != nil {
+		ac.logger.Error("revoking sessions", log.Int("userID", int(userID)), log.Err(err))
+	}
+}
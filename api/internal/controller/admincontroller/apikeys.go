@@ -0,0 +1,130 @@
+package admincontroller
+
+import (
+	"errors"
+	"precisiondosing-api-go/internal/apikey"
+	"precisiondosing-api-go/internal/audit"
+	"precisiondosing-api-go/internal/handle"
+	"precisiondosing-api-go/internal/model"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// @Summary		List API keys of a user
+// @Description	__Permission `users:manage` required__
+// @Description	Lists the API keys of a user. The keys themselves are not shown.
+// @Tags			Admin
+// @Produce		json
+// @Param			email	path		string										true	"User email"
+// @Success		200		{object}	handle.jsendSuccess[[]model.APIKey]			"API keys"
+// @Failure		401		{object}	handle.jsendFailure[handle.errorResponse]	"Unauthorized"
+// @Failure		403		{object}	handle.jsendFailure[handle.errorResponse]	"Non-admin user"
+// @Failure		404		{object}	handle.jsendFailure[handle.errorResponse]	"User not found"
+// @Failure		500		{object}	handle.jSendError							"Internal server error"
+//
+// @Security		Bearer
+//
+// @Router			/admin/users/{email}/api-keys [get]
+func (ac *AdminController) GetAPIKeys(c *gin.Context) {
+	user, ok := ac.tenantUser(c)
+	if !ok {
+		return
+	}
+
+	keys, err := model.GetAPIKeys(ac.DB, user.ID)
+	if err != nil {
+		handle.ServerError(c, err)
+		return
+	}
+
+	handle.Success(c, keys)
+}
+
+// @Summary		Create an API key for a user
+// @Description	__Permission `users:manage` required__
+// @Description	Creates an API key for a user, e.g. a service account. The key is only returned once.
+// @Tags			Admin
+// @Produce		json
+// @Param			email	path		string											true	"User email"
+// @Param			request	body		apikey.CreateRequest							true	"Request body"
+// @Success		200		{object}	handle.jsendSuccess[apikey.CreateResponse]		"New API key"
+// @Failure		400		{object}	handle.jsendFailure[handle.errorResponse]		"Bad request"
+// @Failure		401		{object}	handle.jsendFailure[handle.errorResponse]		"Unauthorized"
+// @Failure		403		{object}	handle.jsendFailure[handle.errorResponse]		"Non-admin user"
+// @Failure		404		{object}	handle.jsendFailure[handle.errorResponse]		"User not found"
+// @Failure		422		{object}	handle.jsendFailure[handle.validationResponse]	"Bad query format"
+// @Failure		500		{object}	handle.jSendError								"Internal server error"
+//
+// @Security		Bearer
+//
+// @Router			/admin/users/{email}/api-keys [post]
+func (ac *AdminController) CreateAPIKey(c *gin.Context) {
+	var query apikey.CreateRequest
+	if !handle.JSONBind(c, &query) {
+		return
+	}
+
+	user, ok := ac.tenantUser(c)
+	if !ok {
+		return
+	}
+
+	if err := query.Validate(); err != nil {
+		handle.BadRequestError(c, err.Error())
+		return
+	}
+
+	key, secret, err := apikey.Create(ac.DB, user.ID, query.Name, query.Scopes, query.ExpiresAt)
+	if err != nil {
+		handle.ServerError(c, err)
+		return
+	}
+
+	ac.record(c, audit.Entry{
+		Action:     audit.APIKeyCreate,
+		TargetType: model.TargetAPIKey,
+		TargetID:   key.Prefix,
+		After:      gin.H{"user": user.Email, "key": key},
+	})
+	handle.Success(c, apikey.CreateResponse{APIKey: *key, Key: secret})
+}
+
+// @Summary		Revoke an API key of a user
+// @Description	__Permission `users:manage` required__
+// @Tags			Admin
+// @Produce		json
+// @Param			email	path		string										true	"User email"
+// @Param			prefix	path		string										true	"Key prefix"
+// @Success		200		{object}	handle.jsendSuccess[map[string]string]		"API key revoked"
+// @Failure		401		{object}	handle.jsendFailure[handle.errorResponse]	"Unauthorized"
+// @Failure		403		{object}	handle.jsendFailure[handle.errorResponse]	"Non-admin user"
+// @Failure		404		{object}	handle.jsendFailure[handle.errorResponse]	"User or API key not found"
+// @Failure		500		{object}	handle.jSendError							"Internal server error"
+//
+// @Security		Bearer
+//
+// @Router			/admin/users/{email}/api-keys/{prefix} [delete]
+func (ac *AdminController) RevokeAPIKey(c *gin.Context) {
+	user, ok := ac.tenantUser(c)
+	if !ok {
+		return
+	}
+
+	if err := ac.APIKeys.Revoke(user.ID, c.Param("prefix")); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			handle.NotFoundError(c, "API key not found")
+			return
+		}
+		handle.ServerError(c, err)
+		return
+	}
+
+	ac.record(c, audit.Entry{
+		Action:     audit.APIKeyRevoke,
+		TargetType: model.TargetAPIKey,
+		TargetID:   c.Param("prefix"),
+		Before:     gin.H{"user": user.Email},
+	})
+	handle.Success(c, gin.H{"message": "API key revoked"})
+}
@@ -0,0 +1,93 @@
+package admincontroller
+
+import (
+	"precisiondosing-api-go/internal/audit"
+	"precisiondosing-api-go/internal/handle"
+	"precisiondosing-api-go/internal/middleware"
+	"precisiondosing-api-go/internal/model"
+	"precisiondosing-api-go/internal/utils/log"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const defaultAuditLimit = 100
+
+// @Summary		Query the audit log
+// @Description	__Permission `audit:read` required__
+// @Description	Lists the administrative and data-access actions, newest first.
+// @Description	Callers without `tenant:all` see the actions of their organization.
+// @Tags			Admin
+// @Produce		json
+// @Param			actor		query		string										false	"Actor email"
+// @Param			action		query		string										false	"Action, e.g. order.requeue"
+// @Param			target_type	query		string										false	"Target type (order, user, role, organization, api_key, system)"
+// @Param			target_id	query		string										false	"Target, e.g. order ID or user email"
+// @Param			from		query		string										false	"Start time (RFC 3339)"
+// @Param			to			query		string										false	"End time (RFC 3339)"
+// @Param			limit		query		int											false	"Max. entries (default 100, max. 1000)"
+// @Success		200			{object}	handle.jsendSuccess[[]model.AuditLog]		"Audit log entries"
+// @Failure		400			{object}	handle.jsendFailure[handle.errorResponse]	"Bad request"
+// @Failure		401			{object}	handle.jsendFailure[handle.errorResponse]	"Unauthorized"
+// @Failure		403			{object}	handle.jsendFailure[handle.errorResponse]	"Missing permission"
+// @Failure		500			{object}	handle.jSendError							"Internal server error"
+//
+// @Security		Bearer
+//
+// @Router			/admin/audit [get]
+func (ac *AdminController) GetAuditLogs(c *gin.Context) {
+	var query struct {
+		Actor      string     `form:"actor" binding:"omitempty,max=255"`
+		Action     string     `form:"action" binding:"omitempty,max=64"`
+		TargetType string     `form:"target_type" binding:"omitempty,max=20"`
+		TargetID   string     `form:"target_id" binding:"omitempty,max=255"`
+		From       *time.Time `form:"from" time_format:"2006-01-02T15:04:05Z07:00"`
+		To         *time.Time `form:"to" time_format:"2006-01-02T15:04:05Z07:00"`
+		Limit      int        `form:"limit" binding:"omitempty,min=1,max=1000"`
+	}
+
+	if !handle.QueryBind(c, &query) {
+		return
+	}
+
+	db := ac.DB.Scopes(middleware.TenantScope(c, "audit_logs"))
+	if query.Actor != "" {
+		db = db.Where(&model.AuditLog{ActorEmail: query.Actor})
+	}
+	if query.Action != "" {
+		db = db.Where(&model.AuditLog{Action: query.Action})
+	}
+	if query.TargetType != "" {
+		db = db.Where(&model.AuditLog{TargetType: query.TargetType})
+	}
+	if query.TargetID != "" {
+		db = db.Where(&model.AuditLog{TargetID: query.TargetID})
+	}
+	if query.From != nil {
+		db = db.Where("created_at >= ?", *query.From)
+	}
+	if query.To != nil {
+		db = db.Where("created_at < ?", *query.To)
+	}
+
+	limit := query.Limit
+	if limit == 0 {
+		limit = defaultAuditLimit
+	}
+
+	logs := []model.AuditLog{}
+	if err := db.Order("id desc").Limit(limit).Find(&logs).Error; err != nil {
+		handle.ServerError(c, err)
+		return
+	}
+
+	handle.Success(c, logs)
+}
+
+// record audits an action that is already done outside of a transaction.
+// A failure is only logged, the action cannot be undone.
+func (ac *AdminController) record(c *gin.Context, entry audit.Entry) {
+	if err := audit.Record(ac.DB, c, entry); err != nil {
+		ac.logger.Error("writing audit log", log.Str("action", entry.Action), log.Err(err))
+	}
+}
@@ -0,0 +1,70 @@
+package admincontroller
+
+import (
+	"precisiondosing-api-go/internal/audit"
+	"precisiondosing-api-go/internal/handle"
+	"precisiondosing-api-go/internal/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// @Summary		Get the login lockout of a user
+// @Description	__Permission `users:manage` required__
+// @Description	Shows the recent failed logins of a user and whether logins are locked.
+// @Tags			Admin
+// @Produce		json
+// @Param			email	path		string										true	"User email"
+// @Success		200		{object}	handle.jsendSuccess[loginguard.Status]		"Lockout status"
+// @Failure		401		{object}	handle.jsendFailure[handle.errorResponse]	"Unauthorized"
+// @Failure		403		{object}	handle.jsendFailure[handle.errorResponse]	"Non-admin user"
+// @Failure		404		{object}	handle.jsendFailure[handle.errorResponse]	"User not found"
+// @Failure		500		{object}	handle.jSendError							"Internal server error"
+//
+// @Security		Bearer
+//
+// @Router			/admin/users/{email}/lockout [get]
+func (ac *AdminController) GetUserLockout(c *gin.Context) {
+	user, ok := ac.tenantUser(c)
+	if !ok {
+		return
+	}
+
+	status, err := ac.LoginGuard.Status(c.Request.Context(), user.Email)
+	if err != nil {
+		handle.ServerError(c, err)
+		return
+	}
+
+	handle.Success(c, status)
+}
+
+// @Summary		Clear the login lockout of a user
+// @Description	__Permission `users:manage` required__
+// @Description	Removes the failed logins of a user, which ends a lockout of the account.
+// @Description	Lockouts of client IPs expire on their own.
+// @Tags			Admin
+// @Produce		json
+// @Param			email	path		string										true	"User email"
+// @Success		200		{object}	handle.jsendSuccess[map[string]string]		"Lockout cleared"
+// @Failure		401		{object}	handle.jsendFailure[handle.errorResponse]	"Unauthorized"
+// @Failure		403		{object}	handle.jsendFailure[handle.errorResponse]	"Non-admin user"
+// @Failure		404		{object}	handle.jsendFailure[handle.errorResponse]	"User not found"
+// @Failure		500		{object}	handle.jSendError							"Internal server error"
+//
+// @Security		Bearer
+//
+// @Router			/admin/users/{email}/lockout [delete]
+func (ac *AdminController) ClearUserLockout(c *gin.Context) {
+	user, ok := ac.tenantUser(c)
+	if !ok {
+		return
+	}
+
+	if err := ac.LoginGuard.Clear(c.Request.Context(), user.Email); err != nil {
+		handle.ServerError(c, err)
+		return
+	}
+
+	ac.record(c, audit.Entry{Action: audit.UserLockoutClear, TargetType: model.TargetUser, TargetID: user.Email})
+	handle.Success(c, gin.H{"message": "Lockout cleared"})
+}
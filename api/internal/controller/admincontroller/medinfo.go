@@ -0,0 +1,43 @@
+package admincontroller
+
+import (
+	"precisiondosing-api-go/internal/audit"
+	"precisiondosing-api-go/internal/handle"
+	"precisiondosing-api-go/internal/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// @Summary		Get MedInfo cache statistics
+// @Description	__Permission `medinfo:manage` required__
+// @Description	Size, entries and hit/miss counters of the MedInfo synonym and interaction caches.
+// @Tags			Admin
+// @Produce		json
+// @Success		200	{object}	handle.jsendSuccess[medinfo.CacheStatistics]	"Cache statistics"
+// @Failure		401	{object}	handle.jsendFailure[handle.errorResponse]		"Unauthorized"
+// @Failure		403	{object}	handle.jsendFailure[handle.errorResponse]		"Non-admin user"
+//
+// @Security		Bearer
+//
+// @Router			/admin/medinfo/cache [get]
+func (ac *AdminController) GetMedInfoCache(c *gin.Context) {
+	handle.Success(c, ac.MedInfo.CacheStats())
+}
+
+// @Summary		Flush the MedInfo cache
+// @Description	__Permission `medinfo:manage` required__
+// @Description	Remove all entries from the MedInfo caches. The counters are kept.
+// @Tags			Admin
+// @Produce		json
+// @Success		200	{object}	handle.jsendSuccess[map[string]string]		"Cache flushed"
+// @Failure		401	{object}	handle.jsendFailure[handle.errorResponse]	"Unauthorized"
+// @Failure		403	{object}	handle.jsendFailure[handle.errorResponse]	"Non-admin user"
+//
+// @Security		Bearer
+//
+// @Router			/admin/medinfo/cache [delete]
+func (ac *AdminController) FlushMedInfoCache(c *gin.Context) {
+	ac.MedInfo.FlushCache()
+	ac.record(c, audit.Entry{Action: audit.MedInfoCacheFlush, TargetType: model.TargetSystem, TargetID: "medinfo_cache"})
+	handle.Success(c, gin.H{"message": "MedInfo cache flushed"})
+}
@@ -0,0 +1,279 @@
+package admincontroller
+
+import (
+	"errors"
+	"fmt"
+	"precisiondosing-api-go/internal/audit"
+	"precisiondosing-api-go/internal/handle"
+	"precisiondosing-api-go/internal/model"
+	"precisiondosing-api-go/internal/utils/validate"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// @Summary		List organizations
+// @Description	__Permission `orgs:manage` required__
+// @Tags			Admin
+// @Produce		json
+// @Success		200	{object}	handle.jsendSuccess[[]model.Organization]	"Organizations"
+// @Failure		401	{object}	handle.jsendFailure[handle.errorResponse]	"Unauthorized"
+// @Failure		403	{object}	handle.jsendFailure[handle.errorResponse]	"Non-admin user"
+// @Failure		500	{object}	handle.jSendError							"Internal server error"
+//
+// @Security		Bearer
+//
+// @Router			/admin/organizations [get]
+func (ac *AdminController) GetOrganizations(c *gin.Context) {
+	orgs := []model.Organization{}
+	if err := ac.DB.Order("name").Find(&orgs).Error; err != nil {
+		handle.ServerError(c, err)
+		return
+	}
+
+	handle.Success(c, orgs)
+}
+
+// @Summary		Get an organization
+// @Description	__Permission `orgs:manage` required__
+// @Tags			Admin
+// @Produce		json
+// @Param			id	path		int											true	"Organization ID"
+// @Success		200	{object}	handle.jsendSuccess[model.Organization]		"Organization"
+// @Failure		401	{object}	handle.jsendFailure[handle.errorResponse]	"Unauthorized"
+// @Failure		403	{object}	handle.jsendFailure[handle.errorResponse]	"Non-admin user"
+// @Failure		404	{object}	handle.jsendFailure[handle.errorResponse]	"Organization not found"
+// @Failure		500	{object}	handle.jSendError							"Internal server error"
+//
+// @Security		Bearer
+//
+// @Router			/admin/organizations/{id} [get]
+func (ac *AdminController) GetOrganization(c *gin.Context) {
+	org, ok := ac.fetchOrganization(c)
+	if !ok {
+		return
+	}
+
+	handle.Success(c, org)
+}
+
+// @Summary		Create an organization
+// @Description	__Permission `orgs:manage` required__
+// @Tags			Admin
+// @Produce		json
+// @Param			request	body		OrganizationQuery								true	"Request body"
+// @Success		200		{object}	handle.jsendSuccess[model.Organization]			"Organization created"
+// @Failure		400		{object}	handle.jsendFailure[handle.errorResponse]		"Bad request"
+// @Failure		401		{object}	handle.jsendFailure[handle.errorResponse]		"Unauthorized"
+// @Failure		403		{object}	handle.jsendFailure[handle.errorResponse]		"Non-admin user"
+// @Failure		422		{object}	handle.jsendFailure[handle.validationResponse]	"Bad query format"
+// @Failure		500		{object}	handle.jSendError								"Internal server error"
+//
+// @Security		Bearer
+//
+// @Router			/admin/organizations [post]
+func (ac *AdminController) CreateOrganization(c *gin.Context) {
+	var query organizationQuery
+	if !handle.JSONBind(c, &query) {
+		return
+	}
+
+	if query.Name == nil {
+		handle.BadRequestError(c, "Name is required")
+		return
+	}
+
+	org := model.Organization{}
+	if !ac.applyOrganization(c, &org, &query) {
+		return
+	}
+
+	handle.Success(c, org)
+}
+
+// @Summary		Update an organization
+// @Description	__Permission `orgs:manage` required__
+// @Description	Renames the organization or replaces its settings. Renaming updates the organization name of its users.
+// @Tags			Admin
+// @Produce		json
+// @Param			id		path		int												true	"Organization ID"
+// @Param			request	body		OrganizationQuery								true	"Request body"
+// @Success		200		{object}	handle.jsendSuccess[model.Organization]			"Organization updated"
+// @Failure		400		{object}	handle.jsendFailure[handle.errorResponse]		"Bad request"
+// @Failure		401		{object}	handle.jsendFailure[handle.errorResponse]		"Unauthorized"
+// @Failure		403		{object}	handle.jsendFailure[handle.errorResponse]		"Non-admin user"
+// @Failure		404		{object}	handle.jsendFailure[handle.errorResponse]		"Organization not found"
+// @Failure		422		{object}	handle.jsendFailure[handle.validationResponse]	"Bad query format"
+// @Failure		500		{object}	handle.jSendError								"Internal server error"
+//
+// @Security		Bearer
+//
+// @Router			/admin/organizations/{id} [patch]
+func (ac *AdminController) UpdateOrganization(c *gin.Context) {
+	var query organizationQuery
+	if !handle.JSONBind(c, &query) {
+		return
+	}
+
+	if query.Name == nil && query.Settings == nil {
+		handle.BadRequestError(c, "No changes requested")
+		return
+	}
+
+	org, ok := ac.fetchOrganization(c)
+	if !ok {
+		return
+	}
+
+	if !ac.applyOrganization(c, org, &query) {
+		return
+	}
+
+	handle.Success(c, org)
+}
+
+// @Summary		Delete an organization
+// @Description	__Permission `orgs:manage` required__
+// @Description	Only organizations without users can be deleted. Their orders are kept without organization.
+// @Tags			Admin
+// @Produce		json
+// @Param			id	path		int											true	"Organization ID"
+// @Success		200	{object}	handle.jsendSuccess[map[string]string]		"Organization deleted"
+// @Failure		400	{object}	handle.jsendFailure[handle.errorResponse]	"Organization has users"
+// @Failure		401	{object}	handle.jsendFailure[handle.errorResponse]	"Unauthorized"
+// @Failure		403	{object}	handle.jsendFailure[handle.errorResponse]	"Non-admin user"
+// @Failure		404	{object}	handle.jsendFailure[handle.errorResponse]	"Organization not found"
+// @Failure		500	{object}	handle.jSendError							"Internal server error"
+//
+// @Security		Bearer
+//
+// @Router			/admin/organizations/{id} [delete]
+func (ac *AdminController) DeleteOrganization(c *gin.Context) {
+	org, ok := ac.fetchOrganization(c)
+	if !ok {
+		return
+	}
+
+	var users int64
+	if err := ac.DB.Model(&model.User{}).Unscoped().
+		Where("organization_id = ?", org.ID).Count(&users).Error; err != nil {
+		handle.ServerError(c, err)
+		return
+	}
+
+	if users > 0 {
+		handle.BadRequestError(c, "Organization has users")
+		return
+	}
+
+	if err := ac.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(org).Error; err != nil {
+			return err
+		}
+
+		return audit.Record(tx, c, audit.Entry{
+			Action:     audit.OrganizationDelete,
+			TargetType: model.TargetOrganization,
+			TargetID:   strconv.FormatUint(uint64(org.ID), 10),
+			Before:     org,
+		})
+	}); err != nil {
+		handle.ServerError(c, err)
+		return
+	}
+
+	handle.Success(c, gin.H{"message": "Organization deleted"})
+}
+
+type organizationQuery struct {
+	Name     *string                     `json:"name" binding:"omitempty,min=2,max=255" example:"ACME Hospital"`
+	Settings *model.OrganizationSettings `json:"settings"`
+} //	@name	OrganizationQuery
+
+// applyOrganization validates and saves the changes of the query.
+// On failure the error response is written and false is returned.
+func (ac *AdminController) applyOrganization(c *gin.Context, org *model.Organization, query *organizationQuery) bool {
+	if query.Name != nil {
+		if err := validate.Organization(*query.Name); err != nil {
+			handle.BadRequestError(c, fmt.Sprintf("Invalid organization: %s", err))
+			return false
+		}
+	}
+
+	entry := audit.Entry{Action: audit.OrganizationCreate, TargetType: model.TargetOrganization}
+	if org.ID != 0 {
+		entry.Action = audit.OrganizationUpdate
+		entry.Before = *org
+	}
+
+	err := ac.DB.Transaction(func(tx *gorm.DB) error {
+		renamed := query.Name != nil && *query.Name != org.Name
+		if renamed {
+			var exists bool
+			if err := tx.Model(&model.Organization{}).Select("1").
+				Where("name = ? AND id != ?", *query.Name, org.ID).
+				Limit(1).Find(&exists).Error; err != nil {
+				handle.ServerError(c, err)
+				return err
+			}
+			if exists {
+				handle.BadRequestError(c, "Organization name already in use")
+				return gorm.ErrInvalidTransaction
+			}
+			org.Name = *query.Name
+		}
+
+		if query.Settings != nil {
+			org.Settings = *query.Settings
+		}
+
+		if err := tx.Save(org).Error; err != nil {
+			handle.ServerError(c, err)
+			return err
+		}
+
+		entry.TargetID = strconv.FormatUint(uint64(org.ID), 10)
+		entry.After = org
+		if err := audit.Record(tx, c, entry); err != nil {
+			handle.ServerError(c, err)
+			return err
+		}
+
+		// the users keep the name for display
+		if renamed {
+			if err := tx.Model(&model.User{}).Unscoped().
+				Where("organization_id = ?", org.ID).
+				Update("org", org.Name).Error; err != nil {
+				handle.ServerError(c, err)
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	return err == nil
+}
+
+// fetchOrganization loads the organization of the path.
+// On failure the error response is written and false is returned.
+func (ac *AdminController) fetchOrganization(c *gin.Context) (*model.Organization, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 0)
+	if err != nil {
+		handle.BadRequestError(c, "Invalid organization ID")
+		return nil, false
+	}
+
+	org, err := model.GetOrganization(ac.DB, uint(id))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		handle.NotFoundError(c, "Organization not found")
+		return nil, false
+	}
+	if err != nil {
+		handle.ServerError(c, err)
+		return nil, false
+	}
+
+	return org, true
+}
@@ -0,0 +1,297 @@
+package admincontroller
+
+import (
+	"errors"
+	"fmt"
+	"precisiondosing-api-go/internal/audit"
+	"precisiondosing-api-go/internal/handle"
+	"precisiondosing-api-go/internal/middleware"
+	"precisiondosing-api-go/internal/model"
+	"precisiondosing-api-go/internal/utils/validate"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// @Summary		List roles
+// @Description	__Permission `roles:manage` required__
+// @Tags			Admin
+// @Produce		json
+// @Success		200	{object}	handle.jsendSuccess[[]model.Role]			"Roles"
+// @Failure		401	{object}	handle.jsendFailure[handle.errorResponse]	"Unauthorized"
+// @Failure		403	{object}	handle.jsendFailure[handle.errorResponse]	"Missing permission"
+// @Failure		500	{object}	handle.jSendError							"Internal server error"
+//
+// @Security		Bearer
+//
+// @Router			/admin/roles [get]
+func (ac *AdminController) GetRoles(c *gin.Context) {
+	roles := []model.Role{}
+	if err := ac.DB.Order("name").Find(&roles).Error; err != nil {
+		handle.ServerError(c, err)
+		return
+	}
+
+	handle.Success(c, roles)
+}
+
+// @Summary		Get a role
+// @Description	__Permission `roles:manage` required__
+// @Tags			Admin
+// @Produce		json
+// @Param			name	path		string										true	"Role name"
+// @Success		200		{object}	handle.jsendSuccess[model.Role]				"Role"
+// @Failure		401		{object}	handle.jsendFailure[handle.errorResponse]	"Unauthorized"
+// @Failure		403		{object}	handle.jsendFailure[handle.errorResponse]	"Missing permission"
+// @Failure		404		{object}	handle.jsendFailure[handle.errorResponse]	"Role not found"
+// @Failure		500		{object}	handle.jSendError							"Internal server error"
+//
+// @Security		Bearer
+//
+// @Router			/admin/roles/{name} [get]
+func (ac *AdminController) GetRole(c *gin.Context) {
+	role, ok := ac.fetchRole(c)
+	if !ok {
+		return
+	}
+
+	handle.Success(c, role)
+}
+
+// @Summary		Create a role
+// @Description	__Permission `roles:manage` required__
+// @Description	Creates a role with a set of permissions. Only permissions of the caller's role can be granted.
+// @Description	Known permissions: `orders:read`, `orders:requeue`, `orders:delete`, `pdf:download`, `users:manage`,
+// @Description	`orgs:manage`, `roles:manage`, `models:read`, `sys:stats`, `medinfo:manage`, `audit:read`, `tenant:all`.
+// @Tags			Admin
+// @Produce		json
+// @Param			request	body		RoleQuery										true	"Request body"
+// @Success		200		{object}	handle.jsendSuccess[model.Role]					"Role created"
+// @Failure		400		{object}	handle.jsendFailure[handle.errorResponse]		"Bad request"
+// @Failure		401		{object}	handle.jsendFailure[handle.errorResponse]		"Unauthorized"
+// @Failure		403		{object}	handle.jsendFailure[handle.errorResponse]		"Missing permission"
+// @Failure		422		{object}	handle.jsendFailure[handle.validationResponse]	"Bad query format"
+// @Failure		500		{object}	handle.jSendError								"Internal server error"
+//
+// @Security		Bearer
+//
+// @Router			/admin/roles [post]
+func (ac *AdminController) CreateRole(c *gin.Context) {
+	var query roleQuery
+	if !handle.JSONBind(c, &query) {
+		return
+	}
+
+	if query.Name == nil || query.Permissions == nil {
+		handle.BadRequestError(c, "Name and permissions are required")
+		return
+	}
+
+	if err := validate.RoleName(*query.Name); err != nil {
+		handle.BadRequestError(c, fmt.Sprintf("Invalid role: %s", err))
+		return
+	}
+
+	_, err := model.GetRole(ac.DB, *query.Name)
+	if err == nil {
+		handle.BadRequestError(c, "Role already exists")
+		return
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		handle.ServerError(c, err)
+		return
+	}
+
+	role := model.Role{Name: *query.Name}
+	if !ac.applyRole(c, &role, &query) {
+		return
+	}
+
+	handle.Success(c, role)
+}
+
+// @Summary		Update a role
+// @Description	__Permission `roles:manage` required__
+// @Description	Replaces the description or permissions of a role. The admin role cannot be changed.
+// @Description	Users get the new permissions with their next login or token refresh.
+// @Tags			Admin
+// @Produce		json
+// @Param			name	path		string											true	"Role name"
+// @Param			request	body		RoleQuery										true	"Request body"
+// @Success		200		{object}	handle.jsendSuccess[model.Role]					"Role updated"
+// @Failure		400		{object}	handle.jsendFailure[handle.errorResponse]		"Bad request"
+// @Failure		401		{object}	handle.jsendFailure[handle.errorResponse]		"Unauthorized"
+// @Failure		403		{object}	handle.jsendFailure[handle.errorResponse]		"Missing permission"
+// @Failure		404		{object}	handle.jsendFailure[handle.errorResponse]		"Role not found"
+// @Failure		422		{object}	handle.jsendFailure[handle.validationResponse]	"Bad query format"
+// @Failure		500		{object}	handle.jSendError								"Internal server error"
+//
+// @Security		Bearer
+//
+// @Router			/admin/roles/{name} [patch]
+func (ac *AdminController) UpdateRole(c *gin.Context) {
+	var query roleQuery
+	if !handle.JSONBind(c, &query) {
+		return
+	}
+
+	if query.Name != nil {
+		handle.BadRequestError(c, "Roles cannot be renamed")
+		return
+	}
+
+	if query.Description == nil && query.Permissions == nil {
+		handle.BadRequestError(c, "No changes requested")
+		return
+	}
+
+	role, ok := ac.fetchRole(c)
+	if !ok {
+		return
+	}
+
+	if role.Name == model.RoleAdmin {
+		handle.ForbiddenError(c, "The admin role cannot be changed")
+		return
+	}
+
+	if !ac.applyRole(c, role, &query) {
+		return
+	}
+
+	handle.Success(c, role)
+}
+
+// @Summary		Delete a role
+// @Description	__Permission `roles:manage` required__
+// @Description	Only roles without users can be deleted, built-in roles are kept.
+// @Tags			Admin
+// @Produce		json
+// @Param			name	path		string										true	"Role name"
+// @Success		200		{object}	handle.jsendSuccess[map[string]string]		"Role deleted"
+// @Failure		400		{object}	handle.jsendFailure[handle.errorResponse]	"Role has users"
+// @Failure		401		{object}	handle.jsendFailure[handle.errorResponse]	"Unauthorized"
+// @Failure		403		{object}	handle.jsendFailure[handle.errorResponse]	"Built-in role"
+// @Failure		404		{object}	handle.jsendFailure[handle.errorResponse]	"Role not found"
+// @Failure		500		{object}	handle.jSendError							"Internal server error"
+//
+// @Security		Bearer
+//
+// @Router			/admin/roles/{name} [delete]
+func (ac *AdminController) DeleteRole(c *gin.Context) {
+	role, ok := ac.fetchRole(c)
+	if !ok {
+		return
+	}
+
+	if role.Builtin {
+		handle.ForbiddenError(c, "Built-in roles cannot be deleted")
+		return
+	}
+
+	var users int64
+	if err := ac.DB.Model(&model.User{}).Unscoped().
+		Where("role = ?", role.Name).Count(&users).Error; err != nil {
+		handle.ServerError(c, err)
+		return
+	}
+
+	if users > 0 {
+		handle.BadRequestError(c, "Role has users")
+		return
+	}
+
+	if err := ac.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(role).Error; err != nil {
+			return err
+		}
+
+		return audit.Record(tx, c, audit.Entry{
+			Action:     audit.RoleDelete,
+			TargetType: model.TargetRole,
+			TargetID:   role.Name,
+			Before:     role,
+		})
+	}); err != nil {
+		handle.ServerError(c, err)
+		return
+	}
+
+	handle.Success(c, gin.H{"message": "Role deleted"})
+}
+
+type roleQuery struct {
+	Name        *string   `json:"name" binding:"omitempty,max=50" example:"operations"`
+	Description *string   `json:"description" binding:"omitempty,max=255" example:"Requeues failed orders"`
+	Permissions *[]string `json:"permissions" example:"orders:read,orders:requeue"`
+} //	@name	RoleQuery
+
+// applyRole validates and saves the changes of the query.
+// On failure the error response is written and false is returned.
+func (ac *AdminController) applyRole(c *gin.Context, role *model.Role, query *roleQuery) bool {
+	entry := audit.Entry{Action: audit.RoleCreate, TargetType: model.TargetRole, TargetID: role.Name}
+	if role.ID != 0 {
+		entry.Action = audit.RoleUpdate
+		entry.Before = *role
+	}
+
+	if query.Description != nil {
+		role.Description = *query.Description
+	}
+
+	if query.Permissions != nil {
+		caller, err := model.GetRole(ac.DB, middleware.UserRole(c))
+		if err != nil {
+			handle.ForbiddenError(c, "Cannot grant permissions")
+			return false
+		}
+
+		permissions := slices.Clone(*query.Permissions)
+		slices.Sort(permissions)
+		permissions = slices.Compact(permissions)
+
+		for _, permission := range permissions {
+			if !slices.Contains(model.AllPermissions(), permission) {
+				handle.BadRequestError(c, fmt.Sprintf("Unknown permission: %s", permission))
+				return false
+			}
+			if !caller.Has(permission) {
+				handle.ForbiddenError(c, fmt.Sprintf("Cannot grant permission: %s", permission))
+				return false
+			}
+		}
+
+		role.Permissions = permissions
+	}
+
+	entry.After = role
+	if err := ac.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(role).Error; err != nil {
+			return err
+		}
+
+		return audit.Record(tx, c, entry)
+	}); err != nil {
+		handle.ServerError(c, err)
+		return false
+	}
+
+	return true
+}
+
+// fetchRole loads the role of the path.
+// On failure the error response is written and false is returned.
+func (ac *AdminController) fetchRole(c *gin.Context) (*model.Role, bool) {
+	role, err := model.GetRole(ac.DB, c.Param("name"))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		handle.NotFoundError(c, "Role not found")
+		return nil, false
+	}
+	if err != nil {
+		handle.ServerError(c, err)
+		return nil, false
+	}
+
+	return role, true
+}
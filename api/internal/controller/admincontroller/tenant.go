@@ -0,0 +1,63 @@
+package admincontroller
+
+import (
+	"errors"
+	"precisiondosing-api-go/internal/handle"
+	"precisiondosing-api-go/internal/middleware"
+	"precisiondosing-api-go/internal/model"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// tenantUser loads the user of the path. Callers without tenant:all only find users
+// of their organization, and nobody manages users whose role their own role does not cover.
+// On failure the error response is written and false is returned.
+func (ac *AdminController) tenantUser(c *gin.Context) (*model.User, bool) {
+	user, err := model.GetUserByEmail(ac.DB.Scopes(middleware.TenantScope(c, "users")), c.Param("email"))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		handle.NotFoundError(c, "User not found")
+		return nil, false
+	}
+	if err != nil {
+		handle.ServerError(c, err)
+		return nil, false
+	}
+
+	if !ac.coversRole(c, user.Role, "Cannot manage users with a higher role") {
+		return nil, false
+	}
+
+	return user, true
+}
+
+// coversRole checks that the role of the caller has all permissions of the role.
+// Unknown roles are a bad request. On failure the error response is written and false is returned.
+func (ac *AdminController) coversRole(c *gin.Context, role string, forbidden string) bool {
+	caller, err := model.GetRole(ac.DB, middleware.UserRole(c))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		handle.ForbiddenError(c, forbidden)
+		return false
+	}
+	if err != nil {
+		handle.ServerError(c, err)
+		return false
+	}
+
+	target, err := model.GetRole(ac.DB, role)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		handle.BadRequestError(c, "Unknown role")
+		return false
+	}
+	if err != nil {
+		handle.ServerError(c, err)
+		return false
+	}
+
+	if !caller.Covers(target) {
+		handle.ForbiddenError(c, forbidden)
+		return false
+	}
+
+	return true
+}
@@ -1,95 +1,137 @@
 package downloadcontroller
 
 import (
-	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
+	"precisiondosing-api-go/internal/audit"
+	"precisiondosing-api-go/internal/blobstore"
 	"precisiondosing-api-go/internal/handle"
+	"precisiondosing-api-go/internal/middleware"
 	"precisiondosing-api-go/internal/model"
-	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
 
 type DownloadController struct {
-	DB *gorm.DB
+	DB        *gorm.DB
+	BlobStore blobstore.Store
 }
 
 func New(resourceHandle *handle.ResourceHandle) *DownloadController {
 	return &DownloadController{
-		DB: resourceHandle.Databases.GormDB,
+		DB:        resourceHandle.Databases.GormDB,
+		BlobStore: resourceHandle.BlobStore,
 	}
 }
 
 func (ac *DownloadController) DownloadPDF(c *gin.Context) {
+	ac.sendPDF(c, ac.tenantScope(c))
+}
+
+func (ac *DownloadController) DownloadOrder(c *gin.Context) {
+	order, ok := ac.fetchOrder(c, ac.tenantScope(c), "order_id", "order_data")
+	if !ok || !ac.audit(c, audit.OrderDownload, order) {
+		return
+	}
+
+	handle.Success(c, order.OrderData)
+}
+
+func (ac *DownloadController) DownloadPrecheck(c *gin.Context) {
+	ac.sendPrecheck(c, ac.tenantScope(c))
+}
+
+// DownloadUserPDF sends the result PDF of an order submitted by the calling user.
+func (ac *DownloadController) DownloadUserPDF(c *gin.Context) {
+	ac.sendPDF(c, ac.userScope(c))
+}
+
+// DownloadUserPrecheck sends the precheck result of an order submitted by the calling user.
+func (ac *DownloadController) DownloadUserPrecheck(c *gin.Context) {
+	ac.sendPrecheck(c, ac.userScope(c))
+}
+
+func (ac *DownloadController) userScope(c *gin.Context) *gorm.DB {
+	return ac.DB.Where("user_id = ?", middleware.UserID(c))
+}
+
+// tenantScope limits organization admins to the orders of their organization.
+func (ac *DownloadController) tenantScope(c *gin.Context) *gorm.DB {
+	return ac.DB.Scopes(middleware.TenantScope(c, "orders"))
+}
+
+// fetchOrder loads the selected fields of the order in the path.
+// On failure the error response is written and false is returned.
+func (ac *DownloadController) fetchOrder(c *gin.Context, query *gorm.DB, fields ...string) (*model.Order, bool) {
 	orderID := c.Param("order_id")
 
 	var order model.Order
-	if err := ac.DB.
-		Select("order_id", "process_result_pdf").
+	if err := query.Select(fields).
 		Where("order_id = ?", orderID).First(&order).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			handle.NotFoundError(c, "Order not found")
-			return
+			return nil, false
 		}
 		handle.ServerError(c, err)
+		return nil, false
+	}
+
+	return &order, true
+}
+
+// audit records the access to the order before its data is sent, no data
+// leaves without an audit entry. On failure the error response is written and false is returned.
+func (ac *DownloadController) audit(c *gin.Context, action string, order *model.Order) bool {
+	if err := audit.Record(ac.DB, c, audit.Entry{
+		Action:     action,
+		TargetType: model.TargetOrder,
+		TargetID:   order.OrderID,
+	}); err != nil {
+		handle.ServerError(c, err)
+		return false
+	}
+
+	return true
+}
+
+// sendPDF streams the result PDF. Range and conditional requests are
+// handled by http.ServeContent, the ETag is the SHA-256 of the PDF.
+func (ac *DownloadController) sendPDF(c *gin.Context, query *gorm.DB) {
+	order, ok := ac.fetchOrder(c, query,
+		"order_id", "updated_at", "process_result_pdf", "result_pdf_key", "result_pdf_hash")
+	if !ok {
 		return
 	}
 
-	if order.ProcessResultPDF == nil {
+	pdf, err := blobstore.OpenPDF(c.Request.Context(), ac.BlobStore, order)
+	if errors.Is(err, blobstore.ErrNotFound) {
 		handle.NotFoundError(c, "No PDF attached for this order")
 		return
 	}
-
-	pdfBytes, err := base64.StdEncoding.DecodeString(*order.ProcessResultPDF)
 	if err != nil {
-		handle.ServerError(c, fmt.Errorf("failed to decode PDF: %w", err))
+		handle.ServerError(c, fmt.Errorf("failed to open PDF: %w", err))
 		return
 	}
+	defer pdf.Close()
 
-	// Send the file
-	c.Writer.WriteHeader(http.StatusOK)
-	if _, err = c.Writer.Write(pdfBytes); err != nil {
-		handle.ServerError(c, fmt.Errorf("failed to write PDF to response: %w", err))
+	if !ac.audit(c, audit.OrderPDFDownload, order) {
 		return
 	}
 
 	c.Header("Content-Type", "application/pdf")
 	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"order_%s.pdf\"", order.OrderID))
-	c.Header("Content-Length", strconv.Itoa(len(pdfBytes)))
-}
-
-func (ac *DownloadController) DownloadOrder(c *gin.Context) {
-	orderID := c.Param("order_id")
-
-	var order model.Order
-	if err := ac.DB.Select("order_id", "order_data").
-		Where("order_id = ?", orderID).First(&order).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			handle.NotFoundError(c, "Order not found")
-			return
-		}
-		handle.ServerError(c, err)
-		return
+	if order.ResultPDFHash != nil {
+		c.Header("ETag", fmt.Sprintf("\"%s\"", *order.ResultPDFHash))
 	}
-
-	handle.Success(c, order.OrderData)
+	http.ServeContent(c.Writer, c.Request, "", pdf.ModTime, pdf)
 }
 
-func (ac *DownloadController) DownloadPrecheck(c *gin.Context) {
-	orderID := c.Param("order_id")
-
-	var order model.Order
-	if err := ac.DB.Select("order_id", "precheck_passed", "precheck_result", "prechecked_at").
-		Where("order_id = ?", orderID).First(&order).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			handle.NotFoundError(c, "Order not found")
-			return
-		}
-		handle.ServerError(c, err)
+func (ac *DownloadController) sendPrecheck(c *gin.Context, query *gorm.DB) {
+	order, ok := ac.fetchOrder(c, query, "order_id", "precheck_passed", "precheck_result", "prechecked_at")
+	if !ok {
 		return
 	}
 
@@ -98,6 +140,10 @@ func (ac *DownloadController) DownloadPrecheck(c *gin.Context) {
 		return
 	}
 
+	if !ac.audit(c, audit.OrderPrecheckDownload, order) {
+		return
+	}
+
 	type Result struct {
 		Passed    bool             `json:"passed"`
 		Result    *json.RawMessage `json:"result"`
@@ -0,0 +1,233 @@
+package dsscontroller
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"precisiondosing-api-go/internal/handle"
+	"precisiondosing-api-go/internal/middleware"
+	"precisiondosing-api-go/internal/model"
+	"precisiondosing-api-go/internal/utils/log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const ndjsonContentType = "application/x-ndjson"
+
+type batchItem struct {
+	Index   int    `json:"index"`
+	OrderID string `json:"order_id,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+type batchResponse struct {
+	BatchID  string      `json:"batch_id,omitempty"` // empty if no item was accepted
+	Accepted int         `json:"accepted"`
+	Rejected int         `json:"rejected"`
+	Items    []batchItem `json:"items"`
+}
+
+type batchOrder struct {
+	OrderID string `json:"order_id"`
+	Status  string `json:"status"`
+}
+
+type batchSummary struct {
+	BatchID    string           `json:"batch_id"`
+	CreatedAt  time.Time        `json:"created_at"`
+	Submitted  int              `json:"submitted"`
+	Accepted   int              `json:"accepted"`
+	Rejected   int              `json:"rejected"`
+	Statuses   map[string]int64 `json:"statuses"`
+	Unfinished int64            `json:"unfinished"` // orders without result yet
+	Complete   bool             `json:"complete"`
+	Orders     []batchOrder     `json:"orders"`
+}
+
+// @Summary		Submit a batch of dose adjustments
+// @Description	__Authentication required__
+// @Description	Queues the patients of a JSON array or an NDJSON body (one patient per line) as orders of one batch.
+// @Description	Invalid patients are rejected per item, the valid ones are queued.
+// @Tags			Dose
+// @Accept			json,application/x-ndjson
+// @Produce		json
+// @Param			request	body		[]object									true	"Patients"
+// @Success		200		{object}	handle.jsendSuccess[batchResponse]			"Accepted and rejected patients"
+// @Failure		400		{object}	handle.jsendFailure[handle.errorResponse]	"Invalid body or too many patients"
+// @Failure		401		{object}	handle.jsendFailure[handle.errorResponse]	"Unauthorized"
+// @Failure		500		{object}	handle.jSendError							"Internal server error"
+//
+// @Security		Bearer
+//
+// @Router			/dose/batches [post]
+func (sc *DSSController) PostAdjustBatch(c *gin.Context) {
+	items, err := sc.readBatch(c)
+	if err != nil {
+		handle.BadRequestError(c, err.Error())
+		return
+	}
+
+	response := batchResponse{Items: make([]batchItem, len(items))}
+	patients := make([]*model.PatientData, len(items))
+	for i, item := range items {
+		response.Items[i].Index = i
+		patientData, parseErr := sc.parsePatientData(item)
+		if parseErr != nil {
+			response.Items[i].Error = parseErr.Error()
+			response.Rejected++
+			continue
+		}
+		patients[i] = patientData
+		response.Accepted++
+	}
+
+	if response.Accepted == 0 {
+		handle.Success(c, response)
+		return
+	}
+
+	batch := model.Batch{
+		UserID:    middleware.UserID(c),
+		Submitted: len(items),
+		Accepted:  response.Accepted,
+		Rejected:  response.Rejected,
+	}
+
+	if err = sc.DB.Transaction(func(tx *gorm.DB) error {
+		var owner *model.User
+		if owner, err = submitter(tx, batch.UserID); err != nil {
+			return err
+		}
+
+		if err = tx.Create(&batch).Error; err != nil {
+			return err
+		}
+
+		for i, patientData := range patients {
+			if patientData == nil {
+				continue
+			}
+
+			var order *model.Order
+			if order, err = queueOrder(tx, c, owner, patientData, &batch); err != nil {
+				return err
+			}
+			response.Items[i].OrderID = order.OrderID
+		}
+		return nil
+	}); err != nil {
+		handle.ServerError(c, err)
+		return
+	}
+
+	response.BatchID = batch.BatchID
+	sc.logger.Info("batch queued",
+		log.Str("batchID", batch.BatchID),
+		log.Int("accepted", response.Accepted),
+		log.Int("rejected", response.Rejected),
+		log.Str("ip", c.ClientIP()),
+		log.Str("user-agent", c.Request.UserAgent()),
+	)
+	handle.Success(c, response)
+}
+
+// @Summary		Get a batch
+// @Description	__Authentication required__
+// @Description	Summarizes the progress of an own batch and lists the status of its orders.
+// @Tags			Dose
+// @Produce		json
+// @Param			batch_id	path		string										true	"Batch ID"
+// @Success		200			{object}	handle.jsendSuccess[batchSummary]			"Batch summary"
+// @Failure		401			{object}	handle.jsendFailure[handle.errorResponse]	"Unauthorized"
+// @Failure		404			{object}	handle.jsendFailure[handle.errorResponse]	"Batch not found"
+// @Failure		500			{object}	handle.jSendError							"Internal server error"
+//
+// @Security		Bearer
+//
+// @Router			/dose/batches/{batch_id} [get]
+func (sc *DSSController) GetBatch(c *gin.Context) {
+	var batch model.Batch
+	if err := sc.DB.
+		Where("batch_id = ? AND user_id = ?", c.Param("batch_id"), middleware.UserID(c)).
+		First(&batch).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			handle.NotFoundError(c, "Batch not found")
+			return
+		}
+		handle.ServerError(c, err)
+		return
+	}
+
+	orders := []batchOrder{}
+	if err := sc.DB.Model(&model.Order{}).
+		Select("order_id", "status").
+		Where("batch_id = ?", batch.ID).
+		Order("id").
+		Scan(&orders).Error; err != nil {
+		handle.ServerError(c, err)
+		return
+	}
+
+	summary := batchSummary{
+		BatchID:   batch.BatchID,
+		CreatedAt: batch.CreatedAt,
+		Submitted: batch.Submitted,
+		Accepted:  batch.Accepted,
+		Rejected:  batch.Rejected,
+		Statuses:  map[string]int64{},
+		Orders:    orders,
+	}
+	for _, order := range orders {
+		summary.Statuses[order.Status]++
+		if slices.Contains(model.UnfinishedStatuses(), order.Status) {
+			summary.Unfinished++
+		}
+	}
+	summary.Complete = summary.Unfinished == 0
+
+	handle.Success(c, summary)
+}
+
+// readBatch splits the body into the raw patients. NDJSON is read line by line,
+// any other content type as JSON array.
+func (sc *DSSController) readBatch(c *gin.Context) ([]json.RawMessage, error) {
+	bodyBytes, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read request body: %w", err)
+	}
+
+	var items []json.RawMessage
+	if strings.HasPrefix(c.ContentType(), ndjsonContentType) {
+		scanner := bufio.NewScanner(bytes.NewReader(bodyBytes))
+		scanner.Buffer(nil, len(bodyBytes)+1)
+		for scanner.Scan() {
+			line := bytes.TrimSpace(scanner.Bytes())
+			if len(line) == 0 {
+				continue
+			}
+			items = append(items, json.RawMessage(slices.Clone(line)))
+		}
+		if err = scanner.Err(); err != nil {
+			return nil, fmt.Errorf("invalid NDJSON body: %w", err)
+		}
+	} else if err = json.Unmarshal(bodyBytes, &items); err != nil {
+		return nil, fmt.Errorf("invalid JSON body, expected an array of patients: %w", err)
+	}
+
+	if len(items) == 0 {
+		return nil, errors.New("no patients submitted")
+	}
+
+	if sc.MaxBatchSize > 0 && len(items) > sc.MaxBatchSize {
+		return nil, fmt.Errorf("too many patients, a batch holds at most %d", sc.MaxBatchSize)
+	}
+
+	return items, nil
+}
@@ -9,8 +9,14 @@ import (
 	"precisiondosing-api-go/internal/handle"
 	"precisiondosing-api-go/internal/middleware"
 	"precisiondosing-api-go/internal/model"
+	"precisiondosing-api-go/internal/orderhistory"
 	"precisiondosing-api-go/internal/precheck"
 	"precisiondosing-api-go/internal/utils/log"
+	"precisiondosing-api-go/internal/utils/validate"
+	"precisiondosing-api-go/internal/webhook"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	cron "github.com/robfig/cron/v3"
@@ -22,6 +28,8 @@ type DSSController struct {
 	DB             *gorm.DB
 	JSONValidators handle.JSONValidators
 	Prechecker     *precheck.PreCheck
+	IdempotencyTTL time.Duration
+	MaxBatchSize   int
 	logger         log.Logger
 }
 
@@ -31,6 +39,8 @@ func New(resourceHandle *handle.ResourceHandle) *DSSController {
 		DB:             resourceHandle.Databases.GormDB,
 		Prechecker:     resourceHandle.Prechecker,
 		JSONValidators: resourceHandle.JSONValidators,
+		IdempotencyTTL: resourceHandle.ServerCfg.IdempotencyTTL,
+		MaxBatchSize:   resourceHandle.ServerCfg.MaxBatchSize,
 		logger:         log.WithComponent("dsscontroller"),
 	}
 }
@@ -64,19 +74,29 @@ func (sc *DSSController) PostPrecheck(c *gin.Context) {
 }
 
 func (sc *DSSController) PostAdjust(c *gin.Context) {
+	key, ok := idempotencyKey(c)
+	if !ok {
+		return
+	}
+
 	patientData, err := sc.readPatientData(c)
 	if err != nil {
 		handle.BadRequestError(c, err.Error())
 		return
 	}
 
-	marshalledData, _ := json.Marshal(patientData)
-	newOrder := model.Order{OrderData: marshalledData}
-	newOrder.UserID = middleware.UserID(c)
-
-	if err = sc.DB.Create(&newOrder).Error; err != nil {
-		handle.ServerError(c, err)
-		return
+	userID := middleware.UserID(c)
+	requestPrint := fingerprint(patientData)
+	if key != "" {
+		stored, getErr := model.GetIdempotencyKey(sc.DB, userID, key)
+		if getErr == nil {
+			replay(c, stored, requestPrint)
+			return
+		}
+		if !errors.Is(getErr, gorm.ErrRecordNotFound) {
+			handle.ServerError(c, getErr)
+			return
+		}
 	}
 
 	type AdaptResponse struct {
@@ -84,9 +104,45 @@ func (sc *DSSController) PostAdjust(c *gin.Context) {
 		Message string `json:"message"`
 	}
 
-	result := AdaptResponse{
-		OrderID: newOrder.OrderID,
-		Message: "Order queued",
+	var result AdaptResponse
+	var newOrder *model.Order
+	if err = sc.DB.Transaction(func(tx *gorm.DB) error {
+		var owner *model.User
+		if owner, err = submitter(tx, userID); err != nil {
+			return err
+		}
+
+		if newOrder, err = queueOrder(tx, c, owner, patientData, nil); err != nil {
+			return err
+		}
+
+		result = AdaptResponse{
+			OrderID: newOrder.OrderID,
+			Message: "Order queued",
+		}
+		if key == "" {
+			return nil
+		}
+
+		response, _ := json.Marshal(result)
+		return model.SaveIdempotencyKey(tx, &model.IdempotencyKey{
+			UserID:      userID,
+			Key:         key,
+			Fingerprint: requestPrint,
+			OrderID:     newOrder.OrderID,
+			Response:    response,
+			ExpiresAt:   time.Now().Add(sc.IdempotencyTTL),
+		})
+	}); err != nil {
+		// a concurrent submission with the same key won, its order is the result
+		if key != "" {
+			if stored, getErr := model.GetIdempotencyKey(sc.DB, userID, key); getErr == nil {
+				replay(c, stored, requestPrint)
+				return
+			}
+		}
+		handle.ServerError(c, err)
+		return
 	}
 
 	sc.logger.Info("adjustment queued",
@@ -98,19 +154,75 @@ func (sc *DSSController) PostAdjust(c *gin.Context) {
 	handle.Success(c, result)
 }
 
+// submitter loads the fields of the calling user that new orders inherit.
+func submitter(tx *gorm.DB, userID uint) (*model.User, error) {
+	var owner model.User
+	if err := tx.Select("id", "callback_url", "organization_id").First(&owner, userID).Error; err != nil {
+		return nil, err
+	}
+	return &owner, nil
+}
+
+// queueOrder creates a queued order of the owner for the patient.
+func queueOrder(
+	tx *gorm.DB, c *gin.Context, owner *model.User, patientData *model.PatientData, batch *model.Batch,
+) (*model.Order, error) {
+	// the callback is not part of the order data passed to R,
+	// without one the default callback of the user is used
+	callbackURL := patientData.CallbackURL
+	if callbackURL == nil {
+		callbackURL = owner.CallbackURL
+	}
+
+	withoutCallback := *patientData
+	withoutCallback.CallbackURL = nil
+	marshalledData, _ := json.Marshal(withoutCallback)
+
+	order := &model.Order{
+		OrderData:      marshalledData,
+		Status:         model.StatusQueued,
+		UserID:         owner.ID,
+		OrganizationID: owner.OrganizationID,
+		CallbackURL:    callbackURL,
+	}
+	if batch != nil {
+		order.BatchID = &batch.ID
+	}
+
+	if err := tx.Create(order).Error; err != nil {
+		return nil, err
+	}
+
+	if err := webhook.Enqueue(tx, order, "", order.Status); err != nil {
+		return nil, err
+	}
+
+	if err := orderhistory.Record(tx, order, "", order.Status, orderhistory.User(c), ""); err != nil {
+		return nil, err
+	}
+
+	return order, nil
+}
+
 func (sc *DSSController) readPatientData(c *gin.Context) (*model.PatientData, error) {
 	bodyBytes, err := io.ReadAll(c.Request.Body)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read request body: %w", err)
 	}
 
+	return sc.parsePatientData(bodyBytes)
+}
+
+// parsePatientData validates a patient against the precheck schema and the
+// rules the schema cannot express.
+func (sc *DSSController) parsePatientData(bodyBytes []byte) (*model.PatientData, error) {
 	var jsonBody map[string]interface{}
-	if err = json.Unmarshal(bodyBytes, &jsonBody); err != nil {
+	if err := json.Unmarshal(bodyBytes, &jsonBody); err != nil {
 		return nil, fmt.Errorf("invalid JSON body: %w", err)
 	}
 
 	// Validate the JSON body
-	err = sc.JSONValidators.PreCheck.Validate(jsonBody)
+	err := sc.JSONValidators.PreCheck.Validate(jsonBody)
 	if err != nil {
 		return nil, fmt.Errorf("invalid JSON body: %w", err)
 	}
@@ -121,9 +233,38 @@ func (sc *DSSController) readPatientData(c *gin.Context) (*model.PatientData, er
 		return nil, fmt.Errorf("invalid body JSON structure: %w", err)
 	}
 
+	if patientData.CallbackURL != nil {
+		if err = validate.CallbackURL(*patientData.CallbackURL); err != nil {
+			return nil, fmt.Errorf("invalid callback_url: %w", err)
+		}
+	}
+
 	// cron tab check
 	parser := cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow)
 	for _, drug := range patientData.Drugs {
+		if err = validateSubstances(&drug); err != nil {
+			return nil, err
+		}
+
+		if drug.IntakeCycle.OnDemand() {
+			if *drug.IntakeCycle.TypicalDose > *drug.IntakeCycle.MaxDailyDose {
+				return nil, errors.New("typical_dose of an on-demand drug exceeds its max_daily_dose")
+			}
+			dosesPerDay := *drug.IntakeCycle.MaxDailyDose / *drug.IntakeCycle.TypicalDose
+			if dosesPerDay > precheck.MaxOnDemandDosesPerDay {
+				return nil, fmt.Errorf("max_daily_dose of an on-demand drug exceeds %d typical doses",
+					precheck.MaxOnDemandDosesPerDay)
+			}
+			if drug.AdjustDose {
+				return nil, errors.New("the dose of an on-demand drug cannot be adjusted")
+			}
+			continue
+		}
+
+		if err = precheck.CheckFrequency(drug.IntakeCycle.Frequency); err != nil {
+			return nil, err
+		}
+
 		for _, intake := range drug.IntakeCycle.Intakes {
 			_, err = parser.Parse(intake.Cron)
 			if err != nil {
@@ -147,6 +288,30 @@ func (sc *DSSController) readPatientData(c *gin.Context) (*model.PatientData, er
 	return &patientData, nil
 }
 
+// validateSubstances checks the per-substance strengths and the adjusted substance
+// of combination products.
+func validateSubstances(drug *model.Drug) error {
+	substances := drug.ActiveSubstances
+	if len(substances) > 1 {
+		for _, substance := range substances {
+			if amount, _ := drug.Strength(substance); amount == 0 {
+				return fmt.Errorf("missing strength of '%s' in combination product", substance)
+			}
+		}
+
+		if drug.AdjustDose && drug.AdjustSubstance == nil {
+			return errors.New("'adjust_substance' is required to adjust a combination product")
+		}
+	}
+
+	if drug.AdjustSubstance != nil &&
+		!slices.ContainsFunc(substances, func(s string) bool { return strings.EqualFold(s, *drug.AdjustSubstance) }) {
+		return fmt.Errorf("'adjust_substance' %s is not an active substance of the drug", *drug.AdjustSubstance)
+	}
+
+	return nil
+}
+
 func (sc *DSSController) GetSchema(c *gin.Context) {
 	schema := sc.JSONValidators.PreCheck.SchemaJSON
 	handle.Success(c, schema)
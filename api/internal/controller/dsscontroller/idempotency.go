@@ -0,0 +1,54 @@
+package dsscontroller
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"precisiondosing-api-go/internal/handle"
+	"precisiondosing-api-go/internal/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	IdempotencyKeyHeader = "Idempotency-Key"
+	ReplayedHeader       = "Idempotent-Replayed"
+)
+
+// idempotencyKey returns the optional Idempotency-Key of the request.
+// On failure the error response is written and false is returned.
+func idempotencyKey(c *gin.Context) (string, bool) {
+	key := c.GetHeader(IdempotencyKeyHeader)
+	if len(key) > model.MaxIdempotencyKeyLength {
+		handle.BadRequestError(c, "Idempotency-Key is too long")
+		return "", false
+	}
+
+	for _, r := range key {
+		if r < 0x21 || r > 0x7e {
+			handle.BadRequestError(c, "Idempotency-Key must be printable ASCII without spaces")
+			return "", false
+		}
+	}
+
+	return key, true
+}
+
+// fingerprint identifies the request body, independent of formatting and key order.
+func fingerprint(patientData *model.PatientData) string {
+	data, _ := json.Marshal(patientData)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// replay answers a repeated submission with the original response.
+// A different request under the same key is a conflict.
+func replay(c *gin.Context, stored *model.IdempotencyKey, fingerprint string) {
+	if stored.Fingerprint != fingerprint {
+		handle.ConflictError(c, "Idempotency-Key was already used for a different request")
+		return
+	}
+
+	c.Header(ReplayedHeader, "true")
+	handle.Success(c, stored.Response)
+}
@@ -0,0 +1,158 @@
+package ordercontroller
+
+import (
+	"precisiondosing-api-go/internal/handle"
+	"precisiondosing-api-go/internal/model"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultOrderLimit = 100
+	maxOrderStatuses  = 10
+)
+
+type orderQuery struct {
+	Status         []string   `form:"status" binding:"omitempty,dive,max=255"`
+	DoseAdjusted   *bool      `form:"dose_adjusted"`
+	PrecheckPassed *bool      `form:"precheck_passed"`
+	ModelID        string     `form:"model_id" binding:"omitempty,max=255"`
+	Compound       string     `form:"compound" binding:"omitempty,max=255"`
+	CreatedFrom    *time.Time `form:"created_from" time_format:"2006-01-02T15:04:05Z07:00"`
+	CreatedTo      *time.Time `form:"created_to" time_format:"2006-01-02T15:04:05Z07:00"`
+	ProcessedFrom  *time.Time `form:"processed_from" time_format:"2006-01-02T15:04:05Z07:00"`
+	ProcessedTo    *time.Time `form:"processed_to" time_format:"2006-01-02T15:04:05Z07:00"`
+	Sort           string     `form:"sort" binding:"omitempty,oneof=created_at processed_at sent_at"`
+	Direction      string     `form:"direction" binding:"omitempty,oneof=asc desc"`
+	Limit          int        `form:"limit" binding:"omitempty,min=1,max=1000"`
+	Offset         int        `form:"offset" binding:"omitempty,min=0"`
+}
+
+type orderPage struct {
+	Orders []orderOverview `json:"orders"`
+	Total  int64           `json:"total"`
+	Limit  int             `json:"limit"`
+	Offset int             `json:"offset"`
+}
+
+// statuses accepts repeated (status=a&status=b) and comma separated (status=a,b) values.
+func (q *orderQuery) statuses() []string {
+	var statuses []string
+	for _, s := range q.Status {
+		for _, part := range strings.Split(s, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				statuses = append(statuses, part)
+			}
+		}
+	}
+	return statuses
+}
+
+func (q *orderQuery) filter(query *gorm.DB) *gorm.DB {
+	if statuses := q.statuses(); len(statuses) > 0 {
+		query = query.Where("orders.status IN ?", statuses)
+	}
+	if q.DoseAdjusted != nil {
+		query = query.Where("orders.dose_adjusted = ?", *q.DoseAdjusted)
+	}
+	if q.PrecheckPassed != nil {
+		query = query.Where("orders.precheck_passed = ?", *q.PrecheckPassed)
+	}
+
+	// the model is chosen by the precheck, compounds are matched against the
+	// submitted substances and the (lowercase) compounds found by the precheck
+	if q.ModelID != "" {
+		query = query.Where("orders.precheck_result->>'$.model_id' = ?", q.ModelID)
+	}
+	if q.Compound != "" {
+		query = query.Where(
+			"JSON_SEARCH(orders.order_data, 'one', ?, NULL, '$.drugs[*].active_substances[*]') IS NOT NULL "+
+				"OR JSON_SEARCH(orders.precheck_result, 'one', ?, NULL, '$.compounds[*].name') IS NOT NULL",
+			q.Compound, strings.ToLower(q.Compound))
+	}
+
+	if q.CreatedFrom != nil {
+		query = query.Where("orders.created_at >= ?", *q.CreatedFrom)
+	}
+	if q.CreatedTo != nil {
+		query = query.Where("orders.created_at < ?", *q.CreatedTo)
+	}
+	if q.ProcessedFrom != nil {
+		query = query.Where("orders.processed_at >= ?", *q.ProcessedFrom)
+	}
+	if q.ProcessedTo != nil {
+		query = query.Where("orders.processed_at < ?", *q.ProcessedTo)
+	}
+
+	return query
+}
+
+// order sorts by the requested time, newest first by default. Orders without
+// that time (not processed or sent yet) are listed last in both directions.
+func (q *orderQuery) order(query *gorm.DB) *gorm.DB {
+	column := "orders.created_at"
+	if q.Sort != "" {
+		column = "orders." + q.Sort
+	}
+
+	direction := "desc"
+	if q.Direction != "" {
+		direction = q.Direction
+	}
+
+	return query.
+		Order(column + " IS NULL").
+		Order(column + " " + direction).
+		Order("orders.id " + direction)
+}
+
+func (oc *OrderController) listOrders(c *gin.Context, query *gorm.DB) {
+	var params orderQuery
+	if !handle.QueryBind(c, &params) {
+		return
+	}
+
+	if len(params.statuses()) > maxOrderStatuses {
+		handle.BadRequestError(c, "Too many statuses")
+		return
+	}
+
+	if params.Limit == 0 {
+		params.Limit = defaultOrderLimit
+	}
+
+	// the filtered query is used for the count and the page
+	query = params.filter(query).Session(&gorm.Session{})
+
+	var total int64
+	if err := query.Model(&model.Order{}).Count(&total).Error; err != nil {
+		handle.ServerError(c, err)
+		return
+	}
+
+	var orders []model.Order
+	if err := params.order(query).
+		Preload("User").
+		Omit("order_data", "precheck_result", "process_result_pdf").
+		Limit(params.Limit).
+		Offset(params.Offset).
+		Find(&orders).Error; err != nil {
+		handle.ServerError(c, err)
+		return
+	}
+
+	response := orderPage{
+		Orders: make([]orderOverview, 0, len(orders)),
+		Total:  total,
+		Limit:  params.Limit,
+		Offset: params.Offset,
+	}
+	for i := range orders {
+		response.Orders = append(response.Orders, newOrderOverview(&orders[i]))
+	}
+
+	handle.Success(c, response)
+}
@@ -2,25 +2,36 @@ package ordercontroller
 
 import (
 	"errors"
+	"precisiondosing-api-go/internal/audit"
+	"precisiondosing-api-go/internal/blobstore"
 	"precisiondosing-api-go/internal/handle"
+	"precisiondosing-api-go/internal/middleware"
 	"precisiondosing-api-go/internal/model"
+	"precisiondosing-api-go/internal/orderhistory"
 	"precisiondosing-api-go/internal/utils/log"
+	"precisiondosing-api-go/internal/webhook"
+	"slices"
 	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+var errNotCancellable = errors.New("order not cancellable")
+
 type OrderController struct {
-	DB     *gorm.DB
-	logger log.Logger
+	DB        *gorm.DB
+	BlobStore blobstore.Store
+	logger    log.Logger
 }
 
 func New(resourceHandle *handle.ResourceHandle) *OrderController {
 	return &OrderController{
-		DB:     resourceHandle.Databases.GormDB,
-		logger: log.WithComponent("ordercontroller"),
+		DB:        resourceHandle.Databases.GormDB,
+		BlobStore: resourceHandle.BlobStore,
+		logger:    log.WithComponent("ordercontroller"),
 	}
 }
 
@@ -39,15 +50,25 @@ type orderOverview struct {
 	SentAt              *time.Time `json:"sent_at,omitempty"`
 }
 
-func (oc *OrderController) GetOrders(c *gin.Context) {
-	var orders []model.Order
-	query := oc.DB.Preload("User")
-
-	// Optional filters
-	status := c.Query("status")
-	if status != "" {
-		query = query.Where("status = ?", status)
+func newOrderOverview(o *model.Order) orderOverview {
+	return orderOverview{
+		OrderID:             o.OrderID,
+		User:                o.User.Email,
+		DoseAdjusted:        o.DoseAdjusted,
+		PrecheckPassed:      o.PrecheckPassed,
+		ProcessErrorMessage: o.ProcessErrorMessage,
+		LastSendError:       o.LastSendError,
+		Status:              o.Status,
+		CreatedAt:           o.CreatedAt,
+		ProcessedAt:         o.ProcessedAt,
+		ProcessingDuration:  o.ProcessingDuration,
+		SentAt:              o.SentAt,
 	}
+}
+
+// GetOrders lists the orders of all users, organization admins see the orders of their organization.
+func (oc *OrderController) GetOrders(c *gin.Context) {
+	query := oc.DB.Scopes(middleware.TenantScope(c, "orders"))
 
 	owner := c.Query("user")
 	if owner != "" {
@@ -59,46 +80,119 @@ func (oc *OrderController) GetOrders(c *gin.Context) {
 		}
 	}
 
-	if err := query.
-		Omit("order_data", "precheck_result", "process_result_pdf").
-		Order("created_at desc").Find(&orders).Error; err != nil {
+	oc.listOrders(c, query)
+}
+
+func (oc *OrderController) GetOrderByID(c *gin.Context) {
+	oc.findOrder(c, oc.DB.Scopes(middleware.TenantScope(c, "orders")))
+}
+
+// GetOrderHistory lists the status transitions of an order, oldest first.
+// Events of deleted orders are kept but not served.
+func (oc *OrderController) GetOrderHistory(c *gin.Context) {
+	orderID := c.Param("order_id")
+
+	var order model.Order
+	if err := oc.DB.Scopes(middleware.TenantScope(c, "orders")).
+		Select("id").
+		Where("order_id = ?", orderID).
+		First(&order).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			handle.NotFoundError(c, "Order not found")
+			return
+		}
 		handle.ServerError(c, err)
 		return
 	}
 
-	var response []orderOverview
-	for _, o := range orders {
-		response = append(response, orderOverview{
-			OrderID:             o.OrderID,
-			User:                o.User.Email,
-			DoseAdjusted:        o.DoseAdjusted,
-			PrecheckPassed:      o.PrecheckPassed,
-			ProcessErrorMessage: o.ProcessErrorMessage,
-			LastSendError:       o.LastSendError,
-			Status:              o.Status,
-			CreatedAt:           o.CreatedAt,
-			ProcessedAt:         o.ProcessedAt,
-			ProcessingDuration:  o.ProcessingDuration,
-			SentAt:              o.SentAt,
-		})
+	events := []model.OrderEvent{}
+	if err := oc.DB.Where(&model.OrderEvent{OrderID: order.ID}).Order("id").Find(&events).Error; err != nil {
+		handle.ServerError(c, err)
+		return
 	}
 
-	if len(response) == 0 {
-		handle.NotFoundError(c, "No orders found that match the query")
+	handle.Success(c, events)
+}
+
+// GetUserOrders lists the orders submitted by the calling user.
+func (oc *OrderController) GetUserOrders(c *gin.Context) {
+	oc.listOrders(c, oc.DB.Where("orders.user_id = ?", middleware.UserID(c)))
+}
+
+// GetUserOrderByID returns an order only if it was submitted by the calling user.
+func (oc *OrderController) GetUserOrderByID(c *gin.Context) {
+	oc.findOrder(c, oc.DB.Where("orders.user_id = ?", middleware.UserID(c)))
+}
+
+// CancelUserOrder cancels an order of the calling user that is not finished yet.
+// Running R scripts are torn down by the job runner once it sees the cancelled status.
+func (oc *OrderController) CancelUserOrder(c *gin.Context) {
+	orderID := c.Param("order_id")
+
+	var order model.Order
+	err := oc.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("id", "order_id", "status", "callback_url", "dose_adjusted").
+			Where("order_id = ? AND user_id = ?", orderID, middleware.UserID(c)).
+			First(&order).Error; err != nil {
+			return err
+		}
+
+		if !slices.Contains(model.CancellableStatuses(), order.Status) {
+			return errNotCancellable
+		}
+
+		now := time.Now()
+		if err := tx.Model(&model.Order{}).Where("id = ?", order.ID).Updates(map[string]interface{}{
+			"status":       model.StatusCancelled,
+			"cancelled_at": now,
+		}).Error; err != nil {
+			return err
+		}
+
+		if err := audit.Record(tx, c, audit.Entry{
+			Action:     audit.OrderCancel,
+			TargetType: model.TargetOrder,
+			TargetID:   order.OrderID,
+			Before:     gin.H{"status": order.Status},
+			After:      gin.H{"status": model.StatusCancelled},
+		}); err != nil {
+			return err
+		}
+
+		if err := orderhistory.Record(tx, &order, order.Status, model.StatusCancelled,
+			orderhistory.User(c), "cancelled by the submitter"); err != nil {
+			return err
+		}
+
+		return webhook.Enqueue(tx, &order, order.Status, model.StatusCancelled)
+	})
+
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		handle.NotFoundError(c, "Order not found")
+		return
+	case errors.Is(err, errNotCancellable):
+		handle.ConflictError(c, "Order is already "+order.Status)
+		return
+	case err != nil:
+		handle.ServerError(c, err)
 		return
 	}
 
-	handle.Success(c, response)
+	oc.logger.Info("Order cancelled", log.Str("orderID", order.OrderID), log.Str("from", order.Status))
+	handle.Success(c, gin.H{
+		"message": "Order cancelled",
+		"orderId": order.OrderID,
+	})
 }
 
-func (oc *OrderController) GetOrderByID(c *gin.Context) {
+func (oc *OrderController) findOrder(c *gin.Context, query *gorm.DB) {
 	orderID := c.Param("order_id")
 	var order model.Order
 
-	// You could add validation here to make sure orderID is an integer if needed
-	query := oc.DB.Preload("User")
-
 	if err := query.
+		Preload("User").
 		Omit("order_data", "precheck_result", "process_result_pdf").
 		Where("order_id = ?", orderID).
 		First(&order).Error; err != nil {
@@ -110,41 +204,20 @@ func (oc *OrderController) GetOrderByID(c *gin.Context) {
 		return
 	}
 
-	response := orderOverview{
-		OrderID:             order.OrderID,
-		User:                order.User.Email,
-		DoseAdjusted:        order.DoseAdjusted,
-		PrecheckPassed:      order.PrecheckPassed,
-		ProcessErrorMessage: order.ProcessErrorMessage,
-		LastSendError:       order.LastSendError,
-		Status:              order.Status,
-		CreatedAt:           order.CreatedAt,
-		ProcessedAt:         order.ProcessedAt,
-		SentAt:              order.SentAt,
-	}
-
-	handle.Success(c, response)
+	handle.Success(c, newOrderOverview(&order))
 }
 
 func (oc *OrderController) ResetFailedSends(c *gin.Context) {
-	result := oc.DB.Model(&model.Order{}).
-		Where("status = ?", model.StatusSendFailed).
-		Updates(map[string]interface{}{
-			"status":               model.StatusProcessed,
-			"last_send_error":      nil,
-			"last_send_attempt_at": nil,
-			"next_send_attempt_at": nil,
-			"sent_at":              nil,
-			"send_tries":           0,
-		})
+	orderAffected, err := oc.transitionOrders(c, audit.OrderResend,
+		func(db *gorm.DB) *gorm.DB { return db.Where("status = ?", model.StatusSendFailed) },
+		resendUpdates(), model.StatusProcessed,
+	)
 
-	if result.Error != nil {
-		handle.ServerError(c, result.Error)
+	if err != nil {
+		handle.ServerError(c, err)
 		return
 	}
 
-	orderAffected := result.RowsAffected
-
 	oc.logger.Info("Requeue orders for sending", log.Int("orders", int(orderAffected)))
 	handle.Success(c, gin.H{
 		"message": "Orders with failed sends resetted",
@@ -156,7 +229,7 @@ func (oc *OrderController) ResendOrder(c *gin.Context) {
 	orderID := c.Param("order_id")
 
 	var order model.Order
-	if err := oc.DB.
+	if err := oc.DB.Scopes(middleware.TenantScope(c, "orders")).
 		Select("id", "order_id", "status").
 		Where("order_id = ?", orderID).
 		First(&order).Error; err != nil {
@@ -174,14 +247,10 @@ func (oc *OrderController) ResendOrder(c *gin.Context) {
 		return
 	}
 
-	if err := oc.DB.Model(&order).Updates(map[string]interface{}{
-		"status":               model.StatusProcessed,
-		"last_send_error":      nil,
-		"last_send_attempt_at": nil,
-		"next_send_attempt_at": nil,
-		"sent_at":              nil,
-		"send_tries":           0,
-	}).Error; err != nil {
+	if _, err := oc.transitionOrders(c, audit.OrderResend,
+		func(db *gorm.DB) *gorm.DB { return db.Where("id = ?", order.ID) },
+		resendUpdates(), model.StatusProcessed,
+	); err != nil {
 		handle.ServerError(c, err)
 		return
 	}
@@ -197,7 +266,7 @@ func (oc *OrderController) RequeueOrderByID(c *gin.Context) {
 	orderID := c.Param("order_id")
 
 	var status string
-	if err := oc.DB.
+	if err := oc.DB.Scopes(middleware.TenantScope(c, "orders")).
 		Model(&model.Order{}).
 		Select("status").
 		Where("order_id = ?", orderID).
@@ -215,23 +284,12 @@ func (oc *OrderController) RequeueOrderByID(c *gin.Context) {
 		return
 	}
 
-	if err := oc.DB.Model(&model.Order{}).
-		Where("order_id = ?", orderID).
-		Updates(map[string]interface{}{
-			"precheck_result":       nil,
-			"precheck_passed":       false,
-			"prechecked_at":         nil,
-			"process_result_pdf":    nil,
-			"dose_adjusted":         false,
-			"process_error_message": nil,
-			"processed_at":          nil,
-			"sent_at":               nil,
-			"send_tries":            0,
-			"last_send_attempt_at":  nil,
-			"last_send_error":       nil,
-			"next_send_attempt_at":  nil,
-			"status":                model.StatusQueued,
-		}).Error; err != nil {
+	if _, err := oc.transitionOrders(c, audit.OrderRequeue,
+		func(db *gorm.DB) *gorm.DB {
+			return db.Where("order_id = ? AND status != ?", orderID, model.StatusProcessing)
+		},
+		requeueUpdates(), model.StatusQueued,
+	); err != nil {
 		handle.ServerError(c, err)
 		return
 	}
@@ -244,32 +302,16 @@ func (oc *OrderController) RequeueOrderByID(c *gin.Context) {
 }
 
 func (oc *OrderController) RequeueErrorOrders(c *gin.Context) {
-	res := oc.DB.
-		Model(&model.Order{}).
-		Where("status = ?", model.StatusError).
-		Updates(map[string]interface{}{
-			"precheck_result":       nil,
-			"precheck_passed":       false,
-			"prechecked_at":         nil,
-			"process_result_pdf":    nil,
-			"dose_adjusted":         false,
-			"process_error_message": nil,
-			"processed_at":          nil,
-			"sent_at":               nil,
-			"send_tries":            0,
-			"last_send_attempt_at":  nil,
-			"last_send_error":       nil,
-			"next_send_attempt_at":  nil,
-			"status":                model.StatusQueued,
-		})
+	ordersAffected, err := oc.transitionOrders(c, audit.OrderRequeue,
+		func(db *gorm.DB) *gorm.DB { return db.Where("status = ?", model.StatusError) },
+		requeueUpdates(), model.StatusQueued,
+	)
 
-	if res.Error != nil {
-		handle.ServerError(c, res.Error)
+	if err != nil {
+		handle.ServerError(c, err)
 		return
 	}
 
-	ordersAffected := res.RowsAffected
-
 	oc.logger.Info("Requeue orders with error status", log.Int("orders", int(ordersAffected)))
 	handle.Success(c, gin.H{
 		"message":       "Requeued orders with error status",
@@ -277,13 +319,101 @@ func (oc *OrderController) RequeueErrorOrders(c *gin.Context) {
 	})
 }
 
+// transitionOrders moves all orders selected by scope (within the tenant of the caller)
+// to a new status, enqueues the webhook events and audits the action for them.
+// Returns the number of updated orders.
+func (oc *OrderController) transitionOrders(
+	c *gin.Context,
+	action string,
+	scope func(*gorm.DB) *gorm.DB,
+	updates map[string]interface{},
+	status string,
+) (int64, error) {
+	var affected int64
+	err := oc.DB.Transaction(func(tx *gorm.DB) error {
+		var orders []model.Order
+		if err := tx.Scopes(middleware.TenantScope(c, "orders"), scope).
+			Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("id", "order_id", "status", "callback_url", "dose_adjusted").
+			Find(&orders).Error; err != nil {
+			return err
+		}
+
+		if len(orders) == 0 {
+			return nil
+		}
+
+		ids := make([]uint, len(orders))
+		for i, order := range orders {
+			ids[i] = order.ID
+		}
+
+		updates["status"] = status
+		if err := tx.Model(&model.Order{}).Where("id IN ?", ids).Updates(updates).Error; err != nil {
+			return err
+		}
+
+		for i := range orders {
+			if err := audit.Record(tx, c, audit.Entry{
+				Action:     action,
+				TargetType: model.TargetOrder,
+				TargetID:   orders[i].OrderID,
+				Before:     gin.H{"status": orders[i].Status},
+				After:      gin.H{"status": status},
+			}); err != nil {
+				return err
+			}
+		}
+
+		if err := orderhistory.RecordAll(tx, orders, status, orderhistory.User(c), action); err != nil {
+			return err
+		}
+
+		affected = int64(len(orders))
+		return webhook.EnqueueAll(tx, orders, status)
+	})
+
+	return affected, err
+}
+
+func resendUpdates() map[string]interface{} {
+	return map[string]interface{}{
+		"last_send_error":      nil,
+		"last_send_attempt_at": nil,
+		"next_send_attempt_at": nil,
+		"sent_at":              nil,
+		"send_tries":           0,
+	}
+}
+
+func requeueUpdates() map[string]interface{} {
+	return map[string]interface{}{
+		"precheck_result":       nil,
+		"precheck_passed":       false,
+		"prechecked_at":         nil,
+		"process_result_pdf":    nil,
+		"result_pdf_key":        nil,
+		"result_pdf_hash":       nil,
+		"result_pdf_size":       nil,
+		"dose_adjusted":         false,
+		"process_error_message": nil,
+		"processed_at":          nil,
+		"sent_at":               nil,
+		"send_tries":            0,
+		"last_send_attempt_at":  nil,
+		"last_send_error":       nil,
+		"next_send_attempt_at":  nil,
+	}
+}
+
 func (oc *OrderController) DeleteOrderByID(c *gin.Context) {
 	orderID := c.Param("order_id")
 
-	if err := oc.DB.
+	var order model.Order
+	if err := oc.DB.Scopes(middleware.TenantScope(c, "orders")).
+		Select("id", "order_id", "user_id", "organization_id", "status", "created_at", "result_pdf_key").
 		Where("order_id = ?", orderID).
-		Delete(&model.Order{}).
-		Limit(1).Error; err != nil {
+		First(&order).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			handle.NotFoundError(c, "Order not found")
 			return
@@ -292,6 +422,34 @@ func (oc *OrderController) DeleteOrderByID(c *gin.Context) {
 		return
 	}
 
+	if err := oc.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&model.Order{}, order.ID).Error; err != nil {
+			return err
+		}
+
+		return audit.Record(tx, c, audit.Entry{
+			Action:     audit.OrderDelete,
+			TargetType: model.TargetOrder,
+			TargetID:   order.OrderID,
+			Before: gin.H{
+				"status":          order.Status,
+				"user_id":         order.UserID,
+				"organization_id": order.OrganizationID,
+				"created_at":      order.CreatedAt,
+			},
+		})
+	}); err != nil {
+		handle.ServerError(c, err)
+		return
+	}
+
+	// the row is gone, a failed blob delete only leaves an unreferenced object
+	if order.ResultPDFKey != nil {
+		if err := oc.BlobStore.Delete(c.Request.Context(), *order.ResultPDFKey); err != nil {
+			oc.logger.Error("deleting result PDF", log.Str("orderID", orderID), log.Err(err))
+		}
+	}
+
 	oc.logger.Info("Order deleted", log.Str("orderID", orderID))
 	handle.Success(c, gin.H{
 		"message": "Order deleted",
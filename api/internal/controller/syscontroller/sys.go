@@ -1,9 +1,11 @@
 package syscontroller
 
 import (
+	"net/http"
 	"precisiondosing-api-go/cfg"
 	"precisiondosing-api-go/internal/handle"
 	"precisiondosing-api-go/internal/utils/srvstats"
+	"precisiondosing-api-go/internal/utils/tokens"
 
 	"github.com/gin-gonic/gin"
 )
@@ -50,6 +52,18 @@ func (sc *SysController) GetInfo(c *gin.Context) {
 	handle.Success(c, res)
 }
 
+// @Summary		Get JWKS
+// @Description	Get the public keys to verify access tokens (JSON Web Key Set).
+// @Description	The list is empty if tokens are signed with a shared secret (HS256).
+// @Tags			System
+// @Produce		json
+// @Success		200	{object}	tokens.JWKS	"JSON Web Key Set"
+// @Router			/.well-known/jwks.json [get]
+func (sc *SysController) GetJWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, tokens.PublicJWKS())
+}
+
 func (sc *SysController) GetServerStats(c *gin.Context) {
 
 	cpuStats, err := srvstats.CPU()
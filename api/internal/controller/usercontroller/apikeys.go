@@ -0,0 +1,126 @@
+package usercontroller
+
+import (
+	"errors"
+	"precisiondosing-api-go/internal/apikey"
+	"precisiondosing-api-go/internal/handle"
+	"precisiondosing-api-go/internal/middleware"
+	"precisiondosing-api-go/internal/model"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// @Summary		List own API keys
+// @Description	Lists the API keys of the logged-in user. The keys themselves are not shown.
+// @Tags			User
+// @Produce		json
+// @Success		200	{object}	handle.jsendSuccess[[]model.APIKey]			"API keys"
+// @Failure		401	{object}	handle.jsendFailure[handle.errorResponse]	"Unauthorized"
+// @Failure		403	{object}	handle.jsendFailure[handle.errorResponse]	"Authenticated by API key"
+// @Failure		500	{object}	handle.jSendError							"Internal server error"
+//
+// @Security		Bearer
+//
+// @Router			/user/me/api-keys [get]
+func (uc *UserController) GetAPIKeys(c *gin.Context) {
+	if !requireLogin(c) {
+		return
+	}
+
+	keys, err := model.GetAPIKeys(uc.DB, middleware.UserID(c))
+	if err != nil {
+		handle.ServerError(c, err)
+		return
+	}
+
+	handle.Success(c, keys)
+}
+
+// @Summary		Create an API key
+// @Description	Creates an API key for the logged-in user. Send it in the `X-API-Key` header.
+// @Description	The key is only returned once.
+// @Tags			User
+// @Produce		json
+// @Param			request	body		apikey.CreateRequest							true	"Request body"
+// @Success		200		{object}	handle.jsendSuccess[apikey.CreateResponse]		"New API key"
+// @Failure		400		{object}	handle.jsendFailure[handle.errorResponse]		"Bad request"
+// @Failure		401		{object}	handle.jsendFailure[handle.errorResponse]		"Unauthorized"
+// @Failure		403		{object}	handle.jsendFailure[handle.errorResponse]		"Authenticated by API key"
+// @Failure		422		{object}	handle.jsendFailure[handle.validationResponse]	"Bad query format"
+// @Failure		500		{object}	handle.jSendError								"Internal server error"
+//
+// @Security		Bearer
+//
+// @Router			/user/me/api-keys [post]
+func (uc *UserController) CreateAPIKey(c *gin.Context) {
+	if !requireLogin(c) {
+		return
+	}
+
+	var query apikey.CreateRequest
+	if !handle.JSONBind(c, &query) {
+		return
+	}
+
+	// the key acts with the role of the user, not the one of the token (might be downgraded)
+	user, err := model.GetUserByID(uc.DB, middleware.UserID(c))
+	if err != nil {
+		handle.NotFoundError(c, "User not found")
+		return
+	}
+
+	if err = query.Validate(); err != nil {
+		handle.BadRequestError(c, err.Error())
+		return
+	}
+
+	key, secret, err := apikey.Create(uc.DB, user.ID, query.Name, query.Scopes, query.ExpiresAt)
+	if err != nil {
+		handle.ServerError(c, err)
+		return
+	}
+
+	handle.Success(c, apikey.CreateResponse{APIKey: *key, Key: secret})
+}
+
+// @Summary		Revoke an API key
+// @Description	Revokes an API key of the logged-in user.
+// @Tags			User
+// @Produce		json
+// @Param			prefix	path		string										true	"Key prefix"
+// @Success		200		{object}	handle.jsendSuccess[map[string]string]		"API key revoked"
+// @Failure		401		{object}	handle.jsendFailure[handle.errorResponse]	"Unauthorized"
+// @Failure		403		{object}	handle.jsendFailure[handle.errorResponse]	"Authenticated by API key"
+// @Failure		404		{object}	handle.jsendFailure[handle.errorResponse]	"API key not found"
+// @Failure		500		{object}	handle.jSendError							"Internal server error"
+//
+// @Security		Bearer
+//
+// @Router			/user/me/api-keys/{prefix} [delete]
+func (uc *UserController) RevokeAPIKey(c *gin.Context) {
+	if !requireLogin(c) {
+		return
+	}
+
+	if err := uc.APIKeys.Revoke(middleware.UserID(c), c.Param("prefix")); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			handle.NotFoundError(c, "API key not found")
+			return
+		}
+		handle.ServerError(c, err)
+		return
+	}
+
+	handle.Success(c, gin.H{"message": "API key revoked"})
+}
+
+// requireLogin rejects requests authenticated by API key,
+// keys must not be able to create or revoke keys.
+func requireLogin(c *gin.Context) bool {
+	if middleware.APIKeyID(c) != 0 {
+		handle.ForbiddenError(c, "API keys cannot manage API keys")
+		return false
+	}
+	return true
+}
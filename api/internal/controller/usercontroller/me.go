@@ -0,0 +1,196 @@
+package usercontroller
+
+import (
+	"fmt"
+	"precisiondosing-api-go/internal/handle"
+	"precisiondosing-api-go/internal/middleware"
+	"precisiondosing-api-go/internal/model"
+	"precisiondosing-api-go/internal/session"
+	"precisiondosing-api-go/internal/utils/hash"
+	"precisiondosing-api-go/internal/utils/log"
+	"precisiondosing-api-go/internal/utils/validate"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// @Summary		Get own account
+// @Description	Returns the account of the logged-in user.
+// @Tags			User
+// @Produce		json
+// @Success		200	{object}	handle.jsendSuccess[model.User]				"User account"
+// @Failure		401	{object}	handle.jsendFailure[handle.errorResponse]	"Unauthorized"
+// @Failure		404	{object}	handle.jsendFailure[handle.errorResponse]	"User not found"
+// @Failure		500	{object}	handle.jSendError							"Internal server error"
+//
+// @Security		Bearer
+//
+// @Router			/user/me [get]
+func (uc *UserController) GetMe(c *gin.Context) {
+	user, err := model.GetUserByID(uc.DB, middleware.UserID(c))
+	if err != nil {
+		handle.NotFoundError(c, "User not found")
+		return
+	}
+
+	handle.Success(c, user)
+}
+
+// @Summary		Update own account
+// @Description	Updates name and default webhook of the logged-in user.
+// @Description	Role, status and organization can only be changed by admins.
+// @Tags			User
+// @Produce		json
+// @Param			request	body		UpdateMeQuery								true	"Profile updates"
+// @Success		200		{object}	handle.jsendSuccess[model.User]				"Updated account"
+// @Failure		400		{object}	handle.jsendFailure[handle.errorResponse]	"Bad request"
+// @Failure		401		{object}	handle.jsendFailure[handle.errorResponse]	"Unauthorized"
+// @Failure		404		{object}	handle.jsendFailure[handle.errorResponse]	"User not found"
+// @Failure		500		{object}	handle.jSendError							"Internal server error"
+//
+// @Security		Bearer
+//
+// @Router			/user/me [patch]
+func (uc *UserController) UpdateMe(c *gin.Context) {
+	type Query struct {
+		FirstName *string `json:"first_name" binding:"omitempty,min=2,max=255" example:"Joe"`
+		LastName  *string `json:"last_name" binding:"omitempty,min=2,max=255" example:"Doe"`
+		// Default webhook for the own orders (empty string removes it)
+		CallbackURL *string `json:"callback_url" example:"https://ehr.example.org/hooks/doseadjust"`
+	} //	@name	UpdateMeQuery
+
+	var query Query
+	if !handle.JSONBind(c, &query) {
+		return
+	}
+
+	if query.FirstName == nil && query.LastName == nil && query.CallbackURL == nil {
+		handle.BadRequestError(c, "No changes requested")
+		return
+	}
+
+	user, err := model.GetUserByID(uc.DB, middleware.UserID(c))
+	if err != nil {
+		handle.NotFoundError(c, "User not found")
+		return
+	}
+
+	if query.FirstName != nil {
+		if err = validate.Name(*query.FirstName); err != nil {
+			handle.BadRequestError(c, fmt.Sprintf("Invalid first name: %s", err))
+			return
+		}
+		user.FirstName = *query.FirstName
+	}
+
+	if query.LastName != nil {
+		if err = validate.Name(*query.LastName); err != nil {
+			handle.BadRequestError(c, fmt.Sprintf("Invalid last name: %s", err))
+			return
+		}
+		user.LastName = *query.LastName
+	}
+
+	if query.CallbackURL != nil {
+		user.CallbackURL = nil
+		if *query.CallbackURL != "" {
+			if err = validate.CallbackURL(*query.CallbackURL); err != nil {
+				handle.BadRequestError(c, fmt.Sprintf("Invalid callback URL: %s", err))
+				return
+			}
+			user.CallbackURL = query.CallbackURL
+		}
+	}
+
+	if err = uc.DB.Model(user).
+		Select("first_name", "last_name", "callback_url").
+		Updates(user).Error; err != nil {
+		handle.ServerError(c, err)
+		return
+	}
+
+	handle.Success(c, user)
+}
+
+// @Summary		Change own password
+// @Description	Changes the password of the logged-in user. The current password is required.
+// @Description	Open password reset links become invalid.
+// @Tags			User
+// @Produce		json
+// @Param			request	body		ChangePasswordQuery								true	"Request body"
+// @Success		200		{object}	handle.jsendSuccess[map[string]string]			"Password changed"
+// @Failure		400		{object}	handle.jsendFailure[handle.errorResponse]		"Invalid new password"
+// @Failure		401		{object}	handle.jsendFailure[handle.errorResponse]		"Wrong current password"
+// @Failure		422		{object}	handle.jsendFailure[handle.validationResponse]	"Bad query format"
+// @Failure		429		{object}	handle.jsendFailure[handle.errorResponse]		"Too many failed attempts"
+// @Failure		500		{object}	handle.jSendError								"Internal server error"
+//
+// @Security		Bearer
+//
+// @Router			/user/me/password [post]
+func (uc *UserController) ChangePassword(c *gin.Context) {
+	type Query struct {
+		CurrentPassword string `json:"current_password" binding:"required" example:"password123"`
+		NewPassword     string `json:"new_password" binding:"required" example:"new_password123"`
+	} //	@name	ChangePasswordQuery
+
+	var query Query
+	if !handle.JSONBind(c, &query) {
+		return
+	}
+
+	user, err := model.GetUserByID(uc.DB, middleware.UserID(c))
+	if err != nil {
+		handle.NotFoundError(c, "User not found")
+		return
+	}
+
+	// guessing the current password counts like failed logins of the account
+	retryAfter, err := uc.LoginGuard.Attempt(c.Request.Context(), user.Email, c.ClientIP())
+	if err != nil {
+		handle.ServerError(c, err)
+		return
+	}
+	if retryAfter > 0 {
+		handle.TooManyRequestsError(c, "Too many failed attempts, try again later", retryAfter)
+		return
+	}
+
+	if user.PwdHash == nil {
+		handle.UnauthorizedError(c, "Invalid credentials")
+		return
+	}
+
+	if validPwd, _ := hash.Check(*user.PwdHash, query.CurrentPassword); !validPwd {
+		handle.UnauthorizedError(c, "Invalid credentials")
+		return
+	}
+
+	if err = uc.LoginGuard.Clear(c.Request.Context(), user.Email); err != nil {
+		uc.logger.Error("clearing login attempts", log.Str("email", user.Email), log.Err(err))
+	}
+
+	if err = validate.Password(query.NewPassword); err != nil {
+		handle.BadRequestError(c, "Invalid password")
+		return
+	}
+
+	hashedPwd, err := hash.Create(query.NewPassword)
+	if err != nil {
+		handle.ServerError(c, err)
+		return
+	}
+
+	if err = uc.DB.Transaction(func(tx *gorm.DB) error {
+		if updateErr := tx.Model(user).Update("pwd_hash", hashedPwd).Error; updateErr != nil {
+			return updateErr
+		}
+		return model.RevokeUserTokens(tx, user.ID, model.TokenPurposeReset)
+	}); err != nil {
+		handle.ServerError(c, err)
+		return
+	}
+
+	uc.revokeSessions(c, user.ID, session.ReasonPasswordSet)
+	handle.Success(c, gin.H{"message": "Password changed"})
+}
@@ -0,0 +1,272 @@
+package usercontroller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"precisiondosing-api-go/internal/audit"
+	"precisiondosing-api-go/internal/handle"
+	"precisiondosing-api-go/internal/middleware"
+	"precisiondosing-api-go/internal/model"
+	"precisiondosing-api-go/internal/session"
+	"precisiondosing-api-go/internal/sso"
+	"precisiondosing-api-go/internal/utils/log"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// @Summary		Login via the identity provider
+// @Description	Redirects to the OpenID Connect identity provider (authorization code flow with PKCE).
+// @Description	After the login the provider redirects to the callback, which returns the JWT tokens.
+// @Tags			Login
+// @Success		302	"Redirect to the identity provider"
+// @Failure		500	{object}	handle.jSendError	"Internal server error"
+//
+// @Router			/user/oidc/login [get]
+func (uc *UserController) OIDCLogin(c *gin.Context) {
+	url, err := uc.SSO.AuthCodeURL(c.Request.Context())
+	if err != nil {
+		handle.ServerError(c, err)
+		return
+	}
+
+	c.Redirect(http.StatusFound, url)
+}
+
+// @Summary		Callback of the identity provider
+// @Description	Completes the login via the identity provider and returns the JWT tokens.
+// @Description	The IdP subject is mapped to the local user it is linked to. Mapped IdP roles replace the local role.
+// @Description	Unknown users are created if just-in-time provisioning is enabled,
+// @Description	existing accounts have to be linked first.
+// @Description	Completes a link started with /user/me/oidc/link instead of logging in.
+// @Tags			Login
+// @Produce		json
+// @Param			code	query		string										true	"Authorization code"
+// @Param			state	query		string										true	"Login state"
+// @Success		200		{object}	handle.jsendSuccess[loginResponse]			"JWT token"
+// @Failure		400		{object}	handle.jsendFailure[handle.errorResponse]	"Invalid or expired login state"
+// @Failure		401		{object}	handle.jsendFailure[handle.errorResponse]	"Identity provider login failed"
+// @Failure		403		{object}	handle.jsendFailure[handle.errorResponse]	"User unknown, not linked or not active"
+// @Failure		409		{object}	handle.jsendFailure[handle.errorResponse]	"Identity linked to another user"
+// @Failure		500		{object}	handle.jSendError							"Internal server error"
+//
+// @Router			/user/oidc/callback [get]
+func (uc *UserController) OIDCCallback(c *gin.Context) {
+	type Query struct {
+		Code             string `form:"code"`
+		State            string `form:"state" binding:"required"`
+		Error            string `form:"error"`
+		ErrorDescription string `form:"error_description"`
+	}
+
+	var query Query
+	if !handle.QueryBind(c, &query) {
+		return
+	}
+
+	if query.Error != "" || query.Code == "" {
+		uc.logger.Warn("identity provider denied login",
+			log.Str("error", query.Error), log.Str("description", query.ErrorDescription))
+		handle.UnauthorizedError(c, "Identity provider login failed")
+		return
+	}
+
+	identity, err := uc.SSO.Exchange(c.Request.Context(), query.Code, query.State)
+	if errors.Is(err, model.ErrInvalidState) {
+		handle.BadRequestError(c, "Invalid or expired login state")
+		return
+	}
+	if errors.Is(err, sso.ErrIdentity) {
+		uc.logger.Warn("identity provider login failed", log.Err(err))
+		handle.UnauthorizedError(c, "Identity provider login failed")
+		return
+	}
+	if err != nil {
+		handle.ServerError(c, err)
+		return
+	}
+
+	if identity.LinkUserID != 0 {
+		uc.finishOIDCLink(c, identity)
+		return
+	}
+
+	role, err := uc.SSO.MappedRole(uc.DB, identity)
+	if err != nil {
+		handle.ServerError(c, err)
+		return
+	}
+
+	user, err := uc.SSO.User(uc.DB, identity, role)
+	if err == nil {
+		err = uc.applyIdPRole(c, user, role)
+	}
+	if errors.Is(err, sso.ErrNotProvisioned) || errors.Is(err, sso.ErrNoRole) {
+		handle.ForbiddenError(c, "User is not registered")
+		return
+	}
+	if errors.Is(err, sso.ErrNotLinked) {
+		handle.ForbiddenError(c, "Account is not linked to the identity provider, log in and link it first")
+		return
+	}
+	if err != nil {
+		handle.ServerError(c, err)
+		return
+	}
+
+	uc.finishOIDCLogin(c, user)
+}
+
+// @Summary		Link the identity provider
+// @Description	Starts linking the account of the logged-in user to an identity provider login.
+// @Description	Open the returned URL in the browser and log in at the identity provider,
+// @Description	the callback then links the identity. Afterwards the user can log in via the identity provider.
+// @Tags			User
+// @Produce		json
+// @Success		200	{object}	handle.jsendSuccess[map[string]string]		"URL of the identity provider"
+// @Failure		401	{object}	handle.jsendFailure[handle.errorResponse]	"Unauthorized"
+// @Failure		403	{object}	handle.jsendFailure[handle.errorResponse]	"Authenticated by API key"
+// @Failure		500	{object}	handle.jSendError							"Internal server error"
+//
+// @Security		Bearer
+//
+// @Router			/user/me/oidc/link [post]
+func (uc *UserController) OIDCLink(c *gin.Context) {
+	if middleware.APIKeyID(c) != 0 {
+		handle.ForbiddenError(c, "API keys cannot link an identity provider")
+		return
+	}
+
+	url, err := uc.SSO.LinkURL(c.Request.Context(), middleware.UserID(c))
+	if err != nil {
+		handle.ServerError(c, err)
+		return
+	}
+
+	handle.Success(c, gin.H{"url": url})
+}
+
+// @Summary		Login of a service via the identity provider
+// @Description	Exchanges an access token a service obtained from the identity provider (client credentials grant)
+// @Description	for JWT tokens of the local service user configured for the client.
+// @Tags			Login
+// @Produce		json
+// @Param			request	body		OIDCTokenQuery									true	"Request body"
+// @Success		200		{object}	handle.jsendSuccess[loginResponse]				"JWT token"
+// @Failure		401		{object}	handle.jsendFailure[handle.errorResponse]		"Invalid access token"
+// @Failure		403		{object}	handle.jsendFailure[handle.errorResponse]		"Client unknown or not active"
+// @Failure		422		{object}	handle.jsendFailure[handle.validationResponse]	"Bad query format"
+// @Failure		500		{object}	handle.jSendError								"Internal server error"
+//
+// @Router			/user/oidc/token [post]
+func (uc *UserController) OIDCServiceToken(c *gin.Context) {
+	type Query struct {
+		AccessToken string `json:"access_token" binding:"required" example:"idp_access_token"`
+	} //	@name	OIDCTokenQuery
+
+	var query Query
+	if !handle.JSONBind(c, &query) {
+		return
+	}
+
+	identity, err := uc.SSO.VerifyServiceToken(c.Request.Context(), query.AccessToken)
+	if errors.Is(err, sso.ErrIdentity) || errors.Is(err, sso.ErrServiceClient) {
+		uc.logger.Warn("service token rejected", log.Err(err))
+		handle.UnauthorizedError(c, "Invalid access token")
+		return
+	}
+	if err != nil {
+		handle.ServerError(c, err)
+		return
+	}
+
+	user, err := uc.SSO.ServiceUser(uc.DB, identity)
+	if errors.Is(err, sso.ErrServiceClient) || errors.Is(err, sso.ErrNotProvisioned) {
+		uc.logger.Warn("unknown service client", log.Str("client", identity.ClientID))
+		handle.ForbiddenError(c, "Client is not registered")
+		return
+	}
+	if err != nil {
+		handle.ServerError(c, err)
+		return
+	}
+
+	uc.finishOIDCLogin(c, user)
+}
+
+// applyIdPRole replaces the local role of the user with the role mapped from the IdP,
+// without mapped role the local role is kept. The change is audited and ends the
+// sessions that still carry the old role.
+func (uc *UserController) applyIdPRole(c *gin.Context, user *model.User, role string) error {
+	if role == "" || role == user.Role {
+		return nil
+	}
+
+	localRole, err := model.GetRole(uc.DB, role)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return sso.ErrNoRole
+	}
+	if err != nil {
+		return err
+	}
+	if localRole.NeedsOrganization() && user.OrganizationID == nil {
+		return sso.ErrNoRole
+	}
+
+	before := *user
+	user.Role = role
+	if err = uc.DB.Transaction(func(tx *gorm.DB) error {
+		if updateErr := tx.Model(user).Update("role", role).Error; updateErr != nil {
+			return updateErr
+		}
+
+		return audit.Record(tx, c, audit.Entry{
+			Action:     audit.UserUpdate,
+			TargetType: model.TargetUser,
+			TargetID:   user.Email,
+			Before:     before,
+			After:      user,
+			Actor:      &before,
+		})
+	}); err != nil {
+		return fmt.Errorf("cannot update role: %w", err)
+	}
+
+	uc.revokeSessions(c, user.ID, session.ReasonRoleChanged)
+	return nil
+}
+
+func (uc *UserController) finishOIDCLink(c *gin.Context, identity *sso.Identity) {
+	user, err := uc.SSO.Link(uc.DB, identity)
+	if errors.Is(err, sso.ErrAlreadyLinked) {
+		handle.ConflictError(c, "Identity is linked to another user")
+		return
+	}
+	if errors.Is(err, sso.ErrNotProvisioned) {
+		handle.ForbiddenError(c, "User is not registered")
+		return
+	}
+	if err != nil {
+		handle.ServerError(c, err)
+		return
+	}
+
+	uc.logger.Info("identity provider linked", log.Str("email", user.Email), log.Str("ip", c.ClientIP()))
+	handle.Success(c, gin.H{"message": "Identity provider linked"})
+}
+
+func (uc *UserController) finishOIDCLogin(c *gin.Context, user *model.User) {
+	if user.Status != "active" {
+		handle.ForbiddenError(c, "User account is not active")
+		return
+	}
+
+	role, err := switchRole(uc.DB, user.Role, nil)
+	if err != nil {
+		handle.ForbiddenError(c, "Unauthorized role access")
+		return
+	}
+
+	uc.startSession(c, user, role)
+}
@@ -1,11 +1,20 @@
 package usercontroller
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"precisiondosing-api-go/cfg"
+	"precisiondosing-api-go/internal/apikey"
 	"precisiondosing-api-go/internal/handle"
+	"precisiondosing-api-go/internal/loginguard"
+	"precisiondosing-api-go/internal/middleware"
 	"precisiondosing-api-go/internal/model"
+	"precisiondosing-api-go/internal/services/mailer"
+	"precisiondosing-api-go/internal/session"
+	"precisiondosing-api-go/internal/sso"
 	"precisiondosing-api-go/internal/utils/hash"
+	"precisiondosing-api-go/internal/utils/log"
 	"precisiondosing-api-go/internal/utils/tokens"
 	"precisiondosing-api-go/internal/utils/validate"
 	"time"
@@ -14,15 +23,39 @@ import (
 	"gorm.io/gorm"
 )
 
+// resetMailTimeout bounds sending a reset mail after the request has been answered.
+const resetMailTimeout = time.Minute
+
+var (
+	errInvalidResetToken = errors.New("invalid or expired reset token")
+	errUserNotActive     = errors.New("user account is not active")
+)
+
 type UserController struct {
-	DB      *gorm.DB
-	AuthCfg cfg.AuthTokenConfig
+	DB         *gorm.DB
+	AuthCfg    cfg.AuthTokenConfig
+	MailCfg    cfg.MailConfig
+	Mailer     mailer.Mailer
+	APIKeys    *apikey.Authenticator
+	Sessions   *session.Store
+	LoginGuard *loginguard.Guard
+	ResetGuard *loginguard.ResetGuard
+	SSO        *sso.Provider
+	logger     log.Logger
 }
 
 func New(resourceHandle *handle.ResourceHandle) *UserController {
 	return &UserController{
-		DB:      resourceHandle.Databases.GormDB,
-		AuthCfg: resourceHandle.AuthCfg,
+		DB:         resourceHandle.Databases.GormDB,
+		AuthCfg:    resourceHandle.AuthCfg,
+		MailCfg:    resourceHandle.MailCfg,
+		Mailer:     resourceHandle.Mailer,
+		APIKeys:    resourceHandle.APIKeys,
+		Sessions:   resourceHandle.Sessions,
+		LoginGuard: resourceHandle.LoginGuard,
+		ResetGuard: resourceHandle.ResetGuard,
+		SSO:        resourceHandle.SSO,
+		logger:     log.WithComponent("usercontroller"),
 	}
 }
 
@@ -42,22 +75,36 @@ func newLoginResponse(tokens *tokens.AuthTokens, role string, lastLogin *time.Ti
 	return result
 }
 
-func switchRole(dbRole string, requestedRole *string) (string, error) {
+// switchRole returns the role of the tokens: the user's own role or a requested
+// role that the own role covers.
+func switchRole(db *gorm.DB, dbRole string, requestedRole *string) (*model.Role, error) {
+	role, err := model.GetRole(db, dbRole)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load role: %w", err)
+	}
+
 	if requestedRole == nil || *requestedRole == dbRole {
-		return dbRole, nil
+		return role, nil
 	}
 
-	err := validate.CanSwitchToRole(*requestedRole, dbRole)
+	requested, err := model.GetRole(db, *requestedRole)
 	if err != nil {
-		return dbRole, fmt.Errorf("cannot switch to role: %w", err)
+		return nil, fmt.Errorf("cannot load role: %w", err)
+	}
+
+	if !role.Covers(requested) {
+		return nil, errors.New("cannot switch to role: user role not sufficient")
 	}
-	return *requestedRole, nil
+	return requested, nil
 }
 
 // @Summary		Login for the API to get JWT token
 // @Description	Acciqures a JWT token for the user to access the API
 // @Description	Only active users can login
-// @Description	Users can downgrade their role by providing the role in the request (optional)
+// @Description	Users can downgrade their role by providing the role in the request (optional),
+// @Description	any role whose permissions the own role has can be requested.
+// @Description	Repeated failed logins delay further attempts and lock the account or client IP
+// @Description	temporarily (429 with Retry-After).
 // @Tags			Login
 // @Produce		json
 // @Param			request	body		LoginQuery										true	"Request body"
@@ -65,6 +112,7 @@ func switchRole(dbRole string, requestedRole *string) (string, error) {
 // @Failure		401		{object}	handle.jsendFailure[handle.errorResponse]		"Unauthorized"
 // @Failure		422		{object}	handle.jsendFailure[handle.validationResponse]	"Bad query format"
 // @Failure		403		{object}	handle.jsendFailure[handle.errorResponse]		"User is not active"
+// @Failure		429		{object}	handle.jsendFailure[handle.errorResponse]		"Too many failed logins"
 // @Failure		500		{object}	handle.jSendError								"Internal server error"
 //
 // @Router			/user/login [post]
@@ -72,7 +120,7 @@ func (uc *UserController) Login(c *gin.Context) {
 	type Query struct {
 		Login    string  `json:"login" binding:"required" example:"joe@me.com"`
 		Password string  `json:"password" binding:"required" example:"password"`
-		Role     *string `json:"role" binding:"omitempty,oneof=admin user debug" example:"user"`
+		Role     *string `json:"role" binding:"omitempty,max=50" example:"user"`
 	} //	@name	LoginQuery
 
 	var query Query
@@ -80,14 +128,20 @@ func (uc *UserController) Login(c *gin.Context) {
 		return
 	}
 
-	user, err := model.GetUserByEmail(uc.DB, query.Login)
+	// recorded before the expensive password hash, cleared on success
+	retryAfter, err := uc.LoginGuard.Attempt(c.Request.Context(), query.Login, c.ClientIP())
 	if err != nil {
-		handle.UnauthorizedError(c, "Invalid ceredentials")
+		handle.ServerError(c, err)
+		return
+	}
+	if retryAfter > 0 {
+		handle.TooManyRequestsError(c, "Too many failed logins, try again later", retryAfter)
 		return
 	}
 
-	if user.PwdHash == nil {
-		handle.UnauthorizedError(c, "Invalid ceredentials")
+	user, err := model.GetUserByEmail(uc.DB, query.Login)
+	if err != nil || user.PwdHash == nil {
+		handle.UnauthorizedError(c, "Invalid credentials")
 		return
 	}
 
@@ -96,21 +150,34 @@ func (uc *UserController) Login(c *gin.Context) {
 		return
 	}
 
+	if err = uc.LoginGuard.Clear(c.Request.Context(), query.Login); err != nil {
+		uc.logger.Error("clearing login attempts", log.Str("email", query.Login), log.Err(err))
+	}
+
 	if user.Status != "active" {
 		handle.ForbiddenError(c, "User account is not active")
 		return
 	}
 
-	newRole, err := switchRole(user.Role, query.Role)
+	newRole, err := switchRole(uc.DB, user.Role, query.Role)
 	if err != nil {
 		handle.ForbiddenError(c, "Unauthorized role access")
 		return
 	}
 
+	uc.startSession(c, user, newRole)
+}
+
+// startSession issues the tokens of a new session for an authenticated user.
+// The permissions of the role are carried as token scope.
+func (uc *UserController) startSession(c *gin.Context, user *model.User, role *model.Role) {
 	claims := tokens.CustomClaims{
-		ID:    user.ID,
-		Email: user.Email,
-		Role:  newRole,
+		ID:          user.ID,
+		Email:       user.Email,
+		Role:        role.Name,
+		Permissions: role.Permissions,
+		OrgID:       user.OrgID(),
+		FamilyID:    session.NewFamilyID(),
 	}
 	token, err := tokens.CreateAuthTokens(&claims, &uc.AuthCfg)
 	if err != nil {
@@ -118,7 +185,13 @@ func (uc *UserController) Login(c *gin.Context) {
 		return
 	}
 
-	res := newLoginResponse(token, newRole, user.LastLogin)
+	if err = uc.Sessions.Start(c.Request.Context(), claims.FamilyID, user.ID,
+		token.RefreshJTI, token.RefreshExpiresIn); err != nil {
+		handle.ServerError(c, err)
+		return
+	}
+
+	res := newLoginResponse(token, role.Name, user.LastLogin)
 	_ = user.UpdateLastLogin(uc.DB)
 
 	handle.Success(c, res)
@@ -126,6 +199,7 @@ func (uc *UserController) Login(c *gin.Context) {
 
 // @Summary		Refresh JWT token
 // @Description	Refreshes the JWT token for the user to access the API
+// @Description	Refresh tokens are single-use. Reusing a refresh token ends the session (all its tokens).
 // @Tags			Login
 // @Produce		json
 // @Param			request	body		RefreshQuery									true	"Request body"
@@ -163,15 +237,20 @@ func (uc *UserController) RefreshToken(c *gin.Context) {
 		return
 	}
 
-	if err = validate.CanSwitchToRole(claims.Role, user.Role); err != nil {
+	// the permissions of the role may have changed since login
+	role, err := switchRole(uc.DB, user.Role, &claims.Role)
+	if err != nil {
 		handle.ForbiddenError(c, "Unauthorized role access")
 		return
 	}
 
 	updatedClaims := tokens.CustomClaims{
-		ID:    user.ID,
-		Email: user.Email,
-		Role:  claims.Role,
+		ID:          user.ID,
+		Email:       user.Email,
+		Role:        role.Name,
+		Permissions: role.Permissions,
+		OrgID:       user.OrgID(),
+		FamilyID:    claims.FamilyID,
 	}
 	newToken, err := tokens.CreateAuthTokens(&updatedClaims, &uc.AuthCfg)
 	if err != nil {
@@ -179,7 +258,202 @@ func (uc *UserController) RefreshToken(c *gin.Context) {
 		return
 	}
 
+	// refresh tokens are single-use
+	err = uc.Sessions.Rotate(c.Request.Context(), claims.FamilyID, claims.JTI,
+		newToken.RefreshJTI, newToken.RefreshExpiresIn)
+	if errors.Is(err, session.ErrRevoked) || errors.Is(err, session.ErrReused) {
+		handle.UnauthorizedError(c, "Invalid refresh token")
+		return
+	}
+	if err != nil {
+		handle.ServerError(c, err)
+		return
+	}
+
 	res := newLoginResponse(newToken, user.Role, user.LastLogin)
 	_ = user.UpdateLastLogin(uc.DB)
 	handle.Success(c, res)
 }
+
+// @Summary		Logout
+// @Description	Ends the session of the access token. The access and refresh tokens of the session become invalid.
+// @Tags			Login
+// @Produce		json
+// @Success		200	{object}	handle.jsendSuccess[map[string]string]		"Logged out"
+// @Failure		400	{object}	handle.jsendFailure[handle.errorResponse]	"Authenticated by API key"
+// @Failure		401	{object}	handle.jsendFailure[handle.errorResponse]	"Unauthorized"
+// @Failure		500	{object}	handle.jSendError							"Internal server error"
+//
+// @Security		Bearer
+//
+// @Router			/user/logout [post]
+func (uc *UserController) Logout(c *gin.Context) {
+	familyID := middleware.SessionID(c)
+	if familyID == "" {
+		handle.BadRequestError(c, "No session to end, API keys are revoked via /user/me/api-keys")
+		return
+	}
+
+	if err := uc.Sessions.Revoke(c.Request.Context(), familyID, session.ReasonLogout); err != nil {
+		handle.ServerError(c, err)
+		return
+	}
+
+	handle.Success(c, gin.H{"message": "Logged out"})
+}
+
+// @Summary		Request a password reset
+// @Description	Sends a mail with a single-use password reset link to the user.
+// @Description	The response is the same for unknown accounts to not disclose registered emails.
+// @Tags			Login
+// @Produce		json
+// @Param			request	body		ForgotPasswordQuery								true	"Request body"
+// @Success		200		{object}	handle.jsendSuccess[map[string]string]			"Reset requested"
+// @Failure		422		{object}	handle.jsendFailure[handle.validationResponse]	"Bad query format"
+// @Failure		429		{object}	handle.jsendFailure[handle.errorResponse]		"Too many reset requests"
+// @Failure		500		{object}	handle.jSendError								"Internal server error"
+//
+// @Router			/user/forgot-password [post]
+func (uc *UserController) ForgotPassword(c *gin.Context) {
+	type Query struct {
+		Email string `json:"email" binding:"required,email" example:"joe@me.com"`
+	} //	@name	ForgotPasswordQuery
+
+	var query Query
+	if !handle.JSONBind(c, &query) {
+		return
+	}
+
+	retryAfter, err := uc.ResetGuard.Allow(c.Request.Context(), query.Email, c.ClientIP())
+	if err != nil {
+		handle.ServerError(c, err)
+		return
+	}
+	if retryAfter > 0 {
+		handle.TooManyRequestsError(c, "Too many password reset requests, try again later", retryAfter)
+		return
+	}
+
+	// the reset is sent in the background, so the response time does not disclose registered emails
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(c.Request.Context()), resetMailTimeout)
+	go func() {
+		defer cancel()
+		uc.sendResetMail(ctx, query.Email)
+	}()
+
+	handle.Success(c, gin.H{"message": "If the account exists, a reset link has been sent"})
+}
+
+// sendResetMail issues a reset token for an active account and mails it, unknown
+// or inactive accounts are ignored.
+func (uc *UserController) sendResetMail(ctx context.Context, email string) {
+	user, err := model.GetUserByEmail(uc.DB.WithContext(ctx), email)
+	if err != nil || user.Status != "active" {
+		return
+	}
+
+	validFor := uc.AuthCfg.ResetExpirationTime
+	token, err := model.IssueUserToken(uc.DB.WithContext(ctx), user.ID, model.TokenPurposeReset, validFor)
+	if err != nil {
+		uc.logger.Error("issuing reset token", log.Str("email", user.Email), log.Err(err))
+		return
+	}
+
+	mail := mailer.ResetMail(user.Email, uc.MailCfg.ResetURL, token, validFor)
+	if err = uc.Mailer.Send(ctx, mail); err != nil {
+		uc.logger.Error("sending reset mail", log.Str("email", user.Email), log.Err(err))
+	}
+}
+
+// @Summary		Set a new password with a token
+// @Description	Sets the password with the token of a password reset or an invitation mail.
+// @Description	The token can only be used once.
+// @Tags			Login
+// @Produce		json
+// @Param			request	body		ResetPasswordQuery								true	"Request body"
+// @Success		200		{object}	handle.jsendSuccess[map[string]string]			"Password set"
+// @Failure		400		{object}	handle.jsendFailure[handle.errorResponse]		"Invalid token or password"
+// @Failure		422		{object}	handle.jsendFailure[handle.validationResponse]	"Bad query format"
+// @Failure		403		{object}	handle.jsendFailure[handle.errorResponse]		"User is not active"
+// @Failure		500		{object}	handle.jSendError								"Internal server error"
+//
+// @Router			/user/reset-password [post]
+func (uc *UserController) ResetPassword(c *gin.Context) {
+	type Query struct {
+		Token    string `json:"token" binding:"required" example:"my_reset_token"`
+		Password string `json:"password" binding:"required" example:"new_password123"`
+	} //	@name	ResetPasswordQuery
+
+	var query Query
+	if !handle.JSONBind(c, &query) {
+		return
+	}
+
+	if err := validate.Password(query.Password); err != nil {
+		handle.BadRequestError(c, "Invalid password")
+		return
+	}
+
+	hashedPwd, err := hash.Create(query.Password)
+	if err != nil {
+		handle.ServerError(c, err)
+		return
+	}
+
+	var userID uint
+	err = uc.DB.Transaction(func(tx *gorm.DB) error {
+		userToken, tokenErr := model.FindUserToken(tx, query.Token)
+		if errors.Is(tokenErr, model.ErrInvalidToken) {
+			return errInvalidResetToken
+		}
+		if tokenErr != nil {
+			return tokenErr
+		}
+
+		user, userErr := model.GetUserByID(tx, userToken.UserID)
+		if userErr != nil {
+			return errInvalidResetToken
+		}
+
+		if user.Status != "active" {
+			return errUserNotActive
+		}
+
+		// the used_at condition makes sure that concurrent requests use the token only once
+		now := time.Now()
+		used := tx.Model(&model.UserToken{}).
+			Where("id = ? AND used_at IS NULL", userToken.ID).
+			Update("used_at", now)
+		if used.Error != nil {
+			return used.Error
+		}
+		if used.RowsAffected == 0 {
+			return errInvalidResetToken
+		}
+
+		userID = user.ID
+		return tx.Model(user).Update("pwd_hash", hashedPwd).Error
+	})
+	switch {
+	case errors.Is(err, errInvalidResetToken):
+		handle.BadRequestError(c, "Invalid or expired token")
+		return
+	case errors.Is(err, errUserNotActive):
+		handle.ForbiddenError(c, "User account is not active")
+		return
+	case err != nil:
+		handle.ServerError(c, err)
+		return
+	}
+
+	uc.revokeSessions(c, userID, session.ReasonPasswordSet)
+	handle.Success(c, gin.H{"message": "Password set"})
+}
+
+// revokeSessions ends all sessions of a user, e.g. after the password was set, so
+// tokens obtained with the old password stop working.
+func (uc *UserController) revokeSessions(c *gin.Context, userID uint, reason string) {
+	if _, err := uc.Sessions.RevokeUser(c.Request.Context(), userID, reason); err != nil {
+		uc.logger.Error("revoking sessions", log.Int("userID", int(userID)), log.Err(err))
+	}
+}
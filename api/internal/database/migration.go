@@ -14,6 +14,18 @@ import (
 func Migrate(db *gorm.DB) error {
 	db.Set("gorm:table_options", "ENGINE=InnoDB")
 
+	if err := db.AutoMigrate(&model.Role{}); err != nil {
+		return fmt.Errorf("migrate role model: %w", err)
+	}
+
+	if err := model.SeedRoles(db); err != nil {
+		return fmt.Errorf("seed roles: %w", err)
+	}
+
+	if err := db.AutoMigrate(&model.Organization{}); err != nil {
+		return fmt.Errorf("migrate organization model: %w", err)
+	}
+
 	if err := db.AutoMigrate(&model.User{}); err != nil {
 		return fmt.Errorf("migrate user models: %w", err)
 	}
@@ -23,10 +35,59 @@ func Migrate(db *gorm.DB) error {
 		return fmt.Errorf("seed user database: %w", err)
 	}
 
+	if err := db.AutoMigrate(&model.Batch{}); err != nil {
+		return fmt.Errorf("migrate batch model: %w", err)
+	}
+
 	if err := db.AutoMigrate(&model.Order{}); err != nil {
 		return fmt.Errorf("migrate order model: %w", err)
 	}
 
+	// assign users and orders created before organizations existed
+	if err := model.BackfillOrganizations(db); err != nil {
+		return fmt.Errorf("backfill organizations: %w", err)
+	}
+
+	if err := db.AutoMigrate(&model.OrderEvent{}); err != nil {
+		return fmt.Errorf("migrate order event model: %w", err)
+	}
+
+	if err := db.AutoMigrate(&model.IdempotencyKey{}); err != nil {
+		return fmt.Errorf("migrate idempotency key model: %w", err)
+	}
+
+	if err := db.AutoMigrate(&model.WebhookDelivery{}); err != nil {
+		return fmt.Errorf("migrate webhook delivery model: %w", err)
+	}
+
+	if err := db.AutoMigrate(&model.UserToken{}); err != nil {
+		return fmt.Errorf("migrate user token model: %w", err)
+	}
+
+	if err := db.AutoMigrate(&model.APIKey{}); err != nil {
+		return fmt.Errorf("migrate API key model: %w", err)
+	}
+
+	if err := db.AutoMigrate(&model.Session{}); err != nil {
+		return fmt.Errorf("migrate session model: %w", err)
+	}
+
+	if err := db.AutoMigrate(&model.LoginAttempt{}); err != nil {
+		return fmt.Errorf("migrate login attempt model: %w", err)
+	}
+
+	if err := db.AutoMigrate(&model.ResetRequest{}); err != nil {
+		return fmt.Errorf("migrate reset request model: %w", err)
+	}
+
+	if err := db.AutoMigrate(&model.OIDCState{}); err != nil {
+		return fmt.Errorf("migrate OIDC state model: %w", err)
+	}
+
+	if err := db.AutoMigrate(&model.AuditLog{}); err != nil {
+		return fmt.Errorf("migrate audit log model: %w", err)
+	}
+
 	return nil
 }
 
@@ -74,7 +135,7 @@ func seedAdminUser(db *gorm.DB, email string, pwd string) error {
 		LastName:  "Admin",
 		FirstName: "Admin",
 		Org:       "Admin",
-		Role:      "admin",
+		Role:      model.RoleAdmin,
 		Status:    "active",
 		PwdHash:   &pwd,
 	}
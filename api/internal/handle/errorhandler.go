@@ -2,8 +2,11 @@ package handle
 
 import (
 	"errors"
+	"math"
 	"net/http"
 	"precisiondosing-api-go/internal/utils/apierr"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -40,6 +43,16 @@ func NotFoundError(c *gin.Context, msg string) {
 	Error(c, apierr.New(http.StatusNotFound, msg))
 }
 
+func ConflictError(c *gin.Context, msg string) {
+	Error(c, apierr.New(http.StatusConflict, msg))
+}
+
+// TooManyRequestsError rejects a request that can be retried after retryAfter.
+func TooManyRequestsError(c *gin.Context, msg string, retryAfter time.Duration) {
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	Error(c, apierr.New(http.StatusTooManyRequests, msg))
+}
+
 func Error(c *gin.Context, err error) {
 	var apiErr apierr.Error
 	if !errors.As(err, &apiErr) {
@@ -2,8 +2,14 @@ package handle
 
 import (
 	"precisiondosing-api-go/cfg"
+	"precisiondosing-api-go/internal/apikey"
+	"precisiondosing-api-go/internal/blobstore"
+	"precisiondosing-api-go/internal/loginguard"
 	"precisiondosing-api-go/internal/precheck"
 	"precisiondosing-api-go/internal/services/individualdb"
+	"precisiondosing-api-go/internal/services/mailer"
+	"precisiondosing-api-go/internal/session"
+	"precisiondosing-api-go/internal/sso"
 	"precisiondosing-api-go/internal/utils/callr"
 	"precisiondosing-api-go/internal/utils/helper"
 	"precisiondosing-api-go/internal/utils/validate"
@@ -16,10 +22,19 @@ type ResourceHandle struct {
 	ServerCfg      cfg.ServerConfig
 	MetaCfg        cfg.MetaConfig
 	AuthCfg        cfg.AuthTokenConfig
+	MetricsCfg     cfg.MetricsConfig
+	MailCfg        cfg.MailConfig
 	Databases      Databases
 	JSONValidators JSONValidators
 	Prechecker     *precheck.PreCheck
 	CallR          *callr.CallR
+	BlobStore      blobstore.Store
+	Mailer         mailer.Mailer
+	APIKeys        *apikey.Authenticator
+	Sessions       *session.Store
+	LoginGuard     *loginguard.Guard
+	ResetGuard     *loginguard.ResetGuard
+	SSO            *sso.Provider // nil if OIDC login is disabled
 	DebugMode      bool
 }
 
@@ -37,6 +52,9 @@ func NewResourceHandle(
 	databases Databases,
 	prechecker *precheck.PreCheck,
 	callR *callr.CallR,
+	blobStore blobstore.Store,
+	mailSender mailer.Mailer,
+	ssoProvider *sso.Provider,
 	jsonValidators JSONValidators,
 	debug bool,
 ) *ResourceHandle {
@@ -44,13 +62,23 @@ func NewResourceHandle(
 		ServerCfg:      apiCfg.Server,
 		MetaCfg:        apiCfg.Meta,
 		AuthCfg:        apiCfg.AuthToken,
+		MetricsCfg:     apiCfg.Metrics,
+		MailCfg:        apiCfg.Mail,
 		Databases:      databases,
 		JSONValidators: jsonValidators,
 		Prechecker:     prechecker,
 		CallR:          callR,
+		BlobStore:      blobStore,
+		Mailer:         mailSender,
+		SSO:            ssoProvider,
 		DebugMode:      debug,
 	}
 
+	res.APIKeys = apikey.New(databases.GormDB, apiCfg.AuthToken.APIKeyCacheTTL)
+	res.Sessions = session.New(databases.GormDB, apiCfg.AuthToken.SessionCacheTTL)
+	res.LoginGuard = loginguard.New(databases.GormDB, apiCfg.AuthToken.LoginLockout)
+	res.ResetGuard = loginguard.NewResetGuard(databases.GormDB, apiCfg.AuthToken.ResetThrottle)
+
 	res.MetaCfg.URL = helper.RemoveTrailingSlash(res.MetaCfg.URL)
 	res.MetaCfg.Group = helper.RemoveTrailingSlash(res.MetaCfg.Group)
 	res.MetaCfg.Group = helper.AddLeadingSlash(res.MetaCfg.Group)
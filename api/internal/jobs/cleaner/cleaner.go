@@ -0,0 +1,75 @@
+package cleaner
+
+import (
+	"context"
+	"precisiondosing-api-go/cfg"
+	"precisiondosing-api-go/internal/model"
+	"precisiondosing-api-go/internal/utils/log"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Cleaner periodically purges expired records that are not removed on access.
+type Cleaner struct {
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+	interval time.Duration
+	db       *gorm.DB
+
+	logger log.Logger
+}
+
+func New(config cfg.CleanupConfig, db *gorm.DB) *Cleaner {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Cleaner{
+		interval: config.Interval,
+		ctx:      ctx,
+		cancel:   cancel,
+		db:       db,
+		logger:   log.WithComponent("cleaner"),
+	}
+}
+
+func (cl *Cleaner) Start() {
+	cl.logger.Info("started")
+
+	cl.wg.Add(1)
+	go cl.run()
+}
+
+func (cl *Cleaner) Stop() {
+	cl.logger.Info("stopped")
+
+	cl.cancel()
+	cl.wg.Wait()
+}
+
+func (cl *Cleaner) run() {
+	defer cl.wg.Done()
+	ticker := time.NewTicker(cl.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-cl.ctx.Done():
+			return
+		case <-ticker.C:
+			cl.purge(cl.ctx)
+		}
+	}
+}
+
+func (cl *Cleaner) purge(ctx context.Context) {
+	purged, err := model.PurgeExpiredIdempotencyKeys(cl.db.WithContext(ctx))
+	if err != nil {
+		cl.logger.Error("purging expired idempotency keys", log.Err(err))
+		return
+	}
+
+	if purged > 0 {
+		cl.logger.Info("purged expired idempotency keys", log.Int("count", int(purged)))
+	}
+}
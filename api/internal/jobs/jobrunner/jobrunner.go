@@ -3,12 +3,17 @@ package jobrunner
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"precisiondosing-api-go/cfg"
+	"precisiondosing-api-go/internal/blobstore"
+	"precisiondosing-api-go/internal/metrics"
 	"precisiondosing-api-go/internal/model"
+	"precisiondosing-api-go/internal/orderhistory"
 	"precisiondosing-api-go/internal/precheck"
 	"precisiondosing-api-go/internal/utils/callr"
 	"precisiondosing-api-go/internal/utils/helper"
 	"precisiondosing-api-go/internal/utils/log"
+	"precisiondosing-api-go/internal/webhook"
 	"sync"
 	"time"
 
@@ -29,14 +34,25 @@ type JobRunner struct {
 	wg     sync.WaitGroup
 	jobs   chan *model.Order
 
+	// cancel functions of the orders being processed, by order ID
+	running   map[uint]context.CancelFunc
+	runningMu sync.Mutex
+
 	callr      *callr.CallR
 	preckecker *precheck.PreCheck
+	blobStore  blobstore.Store
 	jobDB      *gorm.DB
 
 	logger log.Logger
 }
 
-func New(config cfg.JobRunnerConfig, preckecker *precheck.PreCheck, callr *callr.CallR, jobDB *gorm.DB) *JobRunner {
+func New(
+	config cfg.JobRunnerConfig,
+	preckecker *precheck.PreCheck,
+	callr *callr.CallR,
+	blobStore blobstore.Store,
+	jobDB *gorm.DB,
+) *JobRunner {
 	ctx, cancel := context.WithCancel(context.Background())
 	return &JobRunner{
 		cfg:        Config{fetchInterval: config.Interval, timeout: config.Timeout, workerPoolSize: config.MaxJobs},
@@ -44,7 +60,10 @@ func New(config cfg.JobRunnerConfig, preckecker *precheck.PreCheck, callr *callr
 		cancel:     cancel,
 		preckecker: preckecker,
 		callr:      callr,
+		blobStore:  blobStore,
 		jobDB:      jobDB,
+		jobs:       make(chan *model.Order, config.MaxJobs*2), // Buffered channel (can tweak size)
+		running:    make(map[uint]context.CancelFunc),
 		logger:     log.WithComponent("jobrunner"),
 	}
 }
@@ -53,7 +72,6 @@ func (jr *JobRunner) Start() {
 	jr.logger.Info("started")
 	jr.purgeOnStart(jr.ctx)
 
-	jr.jobs = make(chan *model.Order, jr.cfg.workerPoolSize*2) // Buffered channel (can tweak size)
 	for i := 0; i < jr.cfg.workerPoolSize; i++ {
 		jr.wg.Add(1)
 		go jr.worker()
@@ -71,6 +89,11 @@ func (jr *JobRunner) Stop() {
 	jr.wg.Wait()
 }
 
+// QueueDepth returns the number of fetched orders waiting for a worker.
+func (jr *JobRunner) QueueDepth() int {
+	return len(jr.jobs)
+}
+
 func (jr *JobRunner) run() {
 	defer jr.wg.Done()
 	ticker := time.NewTicker(jr.cfg.fetchInterval)
@@ -81,6 +104,8 @@ func (jr *JobRunner) run() {
 		case <-jr.ctx.Done():
 			return
 		case <-ticker.C:
+			jr.stopCancelled(jr.ctx)
+
 			orders := jr.fetchJobs(jr.ctx)
 			if len(orders) == 0 {
 				continue
@@ -145,6 +170,18 @@ func (jr *JobRunner) fetchJobs(ctx context.Context) []model.Order {
 		return nil
 	}
 
+	if err = orderhistory.RecordAll(tx, orders, model.StatusStaged, orderhistory.Worker, ""); err != nil {
+		jr.logger.Error("recording order events", log.Err(err))
+		tx.Rollback()
+		return nil
+	}
+
+	if err = webhook.EnqueueAll(tx, orders, model.StatusStaged); err != nil {
+		jr.logger.Error("enqueue webhook events", log.Err(err))
+		tx.Rollback()
+		return nil
+	}
+
 	// 3. Also update the Go structs, so later Save() will not mess up
 	for i := range orders {
 		orders[i].Status = model.StatusStaged
@@ -174,22 +211,31 @@ func (jr *JobRunner) worker() {
 }
 
 func (jr *JobRunner) processJob(order *model.Order) {
+	// not derived from jr.ctx: a shutdown lets running scripts finish
+	ctx, cancel := context.WithCancel(context.Background())
+	jr.track(order.ID, cancel)
+	defer jr.untrack(order.ID)
+
 	patientData := model.PatientData{}
 	_ = json.Unmarshal(order.OrderData, &patientData)
 
 	now := time.Now()
 	order.PrecheckedAt = &now
 
+	precheckStart := time.Now()
 	precheck, err := jr.preckecker.Check(&patientData)
+	metrics.ObservePrecheck(time.Since(precheckStart), err == nil)
 	precheckByte, _ := json.Marshal(precheck)
 	precheckRaw := json.RawMessage(precheckByte)
 	order.PrecheckResult = &precheckRaw
 
+	precheckDetail := "precheck passed"
 	if err == nil {
 		// precheck passed
 		order.PrecheckPassed = true
 	} else {
 		order.PrecheckPassed = false
+		precheckDetail = "precheck failed: " + err.Error()
 		if err.Recoverable {
 			order.Status = model.StatusQueued
 		}
@@ -202,13 +248,13 @@ func (jr *JobRunner) processJob(order *model.Order) {
 	}
 
 	// update order in db
-	if saveErr := jr.jobDB.Save(order).Error; saveErr != nil {
-		jr.logger.Error("updating order", log.Str("orderID", order.OrderID), log.Err(saveErr))
+	if !jr.update(order, model.StatusStaged) {
 		return
 	}
 
 	// if precheck failed and is recoverable, return
 	if order.Status == "queued" {
+		jr.notify(order, model.StatusStaged, precheckDetail)
 		jr.logger.Info("order precheck failed, re-queued", log.Str("orderID", order.OrderID))
 		return
 	}
@@ -216,10 +262,10 @@ func (jr *JobRunner) processJob(order *model.Order) {
 	// run order
 	jr.logger.Info("running order", log.Str("orderID", order.OrderID))
 	order.Status = model.StatusProcessing
-	if saveErr := jr.jobDB.Save(order).Error; saveErr != nil {
-		jr.logger.Error("updating order", log.Str("orderID", order.OrderID), log.Err(saveErr))
+	if !jr.update(order, model.StatusStaged) {
 		return
 	}
+	jr.notify(order, model.StatusStaged, precheckDetail)
 
 	adjust := order.PrecheckPassed && !precheck.OrganImpairment
 	errMsg := precheck.Message
@@ -229,12 +275,18 @@ func (jr *JobRunner) processJob(order *model.Order) {
 	}
 
 	preadjustTime := time.Now()
-	resp, rError := jr.callr.Adjust(ids, adjust, errMsg, jr.cfg.timeout)
+	resp, rError := jr.callr.Adjust(ctx, ids, adjust, errMsg, jr.cfg.timeout)
 	postadjustTime := time.Now()
 	adjustDuration := helper.FormatDuration(postadjustTime.Sub(preadjustTime))
 	order.ProcessedAt = &postadjustTime
 	order.ProcessingDuration = &adjustDuration
 
+	// no result PDF is stored for orders cancelled in the meantime
+	if errors.Is(rError, callr.ErrCancelled) || jr.cancelled(order) {
+		jr.logger.Info("order cancelled while processing", log.Str("orderID", order.OrderID))
+		return
+	}
+
 	if rError != nil {
 		jr.logger.Error("calling R",
 			log.Str("orderID", order.OrderID),
@@ -242,43 +294,180 @@ func (jr *JobRunner) processJob(order *model.Order) {
 			log.Strs("stack", rError.CallStack),
 		)
 
+		metrics.ObserveAdjust(postadjustTime.Sub(preadjustTime), metrics.ResultError)
 		order.Status = model.StatusError
 		adjErrMsg := rError.Error()
 		order.ProcessErrorMessage = &adjErrMsg
 	} else {
+		metrics.ObserveAdjust(postadjustTime.Sub(preadjustTime), metrics.ResultSuccess)
 		order.Status = model.StatusProcessed
 		order.DoseAdjusted = resp.DoseAdjusted
 	}
 
+	// R writes the PDF as base64 into the order, move it into the blob store
+	// the job context, a shutdown lets running jobs finish
+	if _, ingestErr := blobstore.IngestPDF(ctx, jr.blobStore, jr.jobDB, order); ingestErr != nil {
+		jr.logger.Error("storing result PDF", log.Str("orderID", order.OrderID), log.Err(ingestErr))
+
+		order.Status = model.StatusError
+		errorMessage := "storing result PDF failed"
+		order.ProcessErrorMessage = &errorMessage
+	}
+
 	// This is imortant: we need to NOT Touch the ProcessResultPDF field
-	// This might be set by callr.Adjust() if the process was successful
-	saveErr := jr.jobDB.Model(&model.Order{}).
-		Where("id = ?", order.ID).
+	// It is cleared by IngestPDF() or kept if the PDF could not be stored
+	if !jr.update(order, model.StatusProcessing) {
+		return
+	}
+
+	processDetail := "dose not adjusted"
+	switch {
+	case order.Status == model.StatusError:
+		processDetail = *order.ProcessErrorMessage
+	case order.DoseAdjusted:
+		processDetail = "dose adjusted"
+	}
+	jr.notify(order, model.StatusProcessing, processDetail)
+}
+
+// update saves the order if it is still in the from status. Orders cancelled in
+// the meantime keep their status, false is returned for them and on errors.
+// The ProcessResultPDF field written by R is never touched.
+func (jr *JobRunner) update(order *model.Order, from string) bool {
+	result := jr.jobDB.Model(&model.Order{}).
+		Where("id = ? AND status = ?", order.ID, from).
 		Select("*").
-		Omit("ProcessResultPDF").
-		Updates(order).Error
+		Omit("ProcessResultPDF", "CancelledAt").
+		Updates(order)
+
+	if result.Error != nil {
+		jr.logger.Error("updating order", log.Str("orderID", order.OrderID), log.Err(result.Error))
+		return false
+	}
 
-	if saveErr != nil {
-		jr.logger.Error("updating order", log.Str("orderID", order.OrderID), log.Err(saveErr))
+	if result.RowsAffected == 0 {
+		jr.logger.Info("order cancelled, stopped processing", log.Str("orderID", order.OrderID))
+		return false
+	}
+
+	return true
+}
+
+// cancelled reports whether the order was cancelled since it was picked up.
+// If the status cannot be read, the conditional update of the order decides.
+func (jr *JobRunner) cancelled(order *model.Order) bool {
+	var status string
+	if err := jr.jobDB.Model(&model.Order{}).
+		Select("status").
+		Where("id = ?", order.ID).
+		Scan(&status).Error; err != nil {
+		jr.logger.Error("reading order status", log.Str("orderID", order.OrderID), log.Err(err))
+		return false
+	}
+	return status == model.StatusCancelled
+}
+
+func (jr *JobRunner) track(orderID uint, cancel context.CancelFunc) {
+	jr.runningMu.Lock()
+	defer jr.runningMu.Unlock()
+	jr.running[orderID] = cancel
+}
+
+func (jr *JobRunner) untrack(orderID uint) {
+	jr.runningMu.Lock()
+	defer jr.runningMu.Unlock()
+	if cancel, ok := jr.running[orderID]; ok {
+		cancel()
+		delete(jr.running, orderID)
+	}
+}
+
+// stopCancelled tears down the R scripts of running orders that were cancelled.
+// Cancellations are read from the database, they can be requested on any instance.
+func (jr *JobRunner) stopCancelled(ctx context.Context) {
+	jr.runningMu.Lock()
+	ids := make([]uint, 0, len(jr.running))
+	for id := range jr.running {
+		ids = append(ids, id)
+	}
+	jr.runningMu.Unlock()
+
+	if len(ids) == 0 {
+		return
+	}
+
+	var cancelled []uint
+	if err := jr.jobDB.WithContext(ctx).Model(&model.Order{}).
+		Where("id IN ? AND status = ?", ids, model.StatusCancelled).
+		Pluck("id", &cancelled).Error; err != nil {
+		jr.logger.Error("fetching cancelled orders", log.Err(err))
+		return
+	}
+
+	jr.runningMu.Lock()
+	defer jr.runningMu.Unlock()
+	for _, id := range cancelled {
+		if cancel, ok := jr.running[id]; ok {
+			cancel()
+		}
+	}
+}
+
+// notify records the transition of the order and enqueues its webhook event.
+func (jr *JobRunner) notify(order *model.Order, from, detail string) {
+	if err := orderhistory.Record(jr.jobDB, order, from, order.Status, orderhistory.Worker, detail); err != nil {
+		jr.logger.Error("recording order event", log.Str("orderID", order.OrderID), log.Err(err))
+	}
+
+	if err := webhook.Enqueue(jr.jobDB, order, from, order.Status); err != nil {
+		jr.logger.Error("enqueue webhook event", log.Str("orderID", order.OrderID), log.Err(err))
 	}
 }
 
 func (jr *JobRunner) purgeOnStart(ctx context.Context) {
 	// On start, reset orders that started but did not finish
-	err := jr.jobDB.WithContext(ctx).
-		Model(&model.Order{}).
-		Where(&model.Order{Status: model.StatusStaged}).
-		Or(&model.Order{Status: model.StatusPrechecked}).
-		Or(&model.Order{Status: model.StatusProcessing}).
-		Updates(map[string]interface{}{
-			"status":                model.StatusQueued,
-			"precheck_result":       nil,
-			"precheck_passed":       false,
-			"prechecked_at":         nil,
-			"process_result_PDF":    nil,
-			"process_error_message": nil,
-			"processed_at":          nil,
-		}).Error
+	err := jr.jobDB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var orders []model.Order
+		if err := tx.
+			Select("id", "order_id", "status", "callback_url", "dose_adjusted").
+			Where("status IN ?", []string{model.StatusStaged, model.StatusPrechecked, model.StatusProcessing}).
+			Find(&orders).Error; err != nil {
+			return err
+		}
+
+		if len(orders) == 0 {
+			return nil
+		}
+
+		ids := make([]uint, len(orders))
+		for i, order := range orders {
+			ids[i] = order.ID
+		}
+
+		if err := tx.Model(&model.Order{}).
+			Where("id IN ?", ids).
+			Updates(map[string]interface{}{
+				"status":                model.StatusQueued,
+				"precheck_result":       nil,
+				"precheck_passed":       false,
+				"prechecked_at":         nil,
+				"process_result_PDF":    nil,
+				"result_pdf_key":        nil,
+				"result_pdf_hash":       nil,
+				"result_pdf_size":       nil,
+				"process_error_message": nil,
+				"processed_at":          nil,
+			}).Error; err != nil {
+			return err
+		}
+
+		if err := orderhistory.RecordAll(tx, orders, model.StatusQueued,
+			orderhistory.System, "unfinished run reset on startup"); err != nil {
+			return err
+		}
+
+		return webhook.EnqueueAll(tx, orders, model.StatusQueued)
+	})
 
 	if err != nil {
 		jr.logger.Error("purging incomplete orders", log.Err(err))
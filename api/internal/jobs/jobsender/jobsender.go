@@ -2,11 +2,17 @@ package jobsender
 
 import (
 	"context"
-	"encoding/base64"
+	"errors"
+	"fmt"
 	"precisiondosing-api-go/cfg"
+	"precisiondosing-api-go/internal/blobstore"
+	"precisiondosing-api-go/internal/metrics"
 	"precisiondosing-api-go/internal/model"
+	"precisiondosing-api-go/internal/orderhistory"
 	"precisiondosing-api-go/internal/services/mmc"
+	"precisiondosing-api-go/internal/utils/helper"
 	"precisiondosing-api-go/internal/utils/log"
+	"precisiondosing-api-go/internal/webhook"
 	"sync"
 	"time"
 
@@ -21,12 +27,13 @@ type JobSender struct {
 	batchSize     int
 	MaxRetries    int
 	jobDB         *gorm.DB
+	blobStore     blobstore.Store
 	mmcAPI        *mmc.API
 
 	logger log.Logger
 }
 
-func New(mmcConfig cfg.MMCConfig, jobDB *gorm.DB) *JobSender {
+func New(mmcConfig cfg.MMCConfig, blobStore blobstore.Store, jobDB *gorm.DB) *JobSender {
 	ctx, cancel := context.WithCancel(context.Background())
 	return &JobSender{
 		fetchInterval: mmcConfig.Interval,
@@ -36,6 +43,7 @@ func New(mmcConfig cfg.MMCConfig, jobDB *gorm.DB) *JobSender {
 		ctx:           ctx,
 		cancel:        cancel,
 		jobDB:         jobDB,
+		blobStore:     blobStore,
 		logger:        log.WithComponent("jobsender"),
 	}
 }
@@ -69,29 +77,12 @@ func (js *JobSender) run() {
 	}
 }
 
-func calculateBackoff(sendTries int) time.Duration {
-	switch sendTries {
-	case 1:
-		return 1 * time.Minute
-	case 2:
-		return 2 * time.Minute
-	case 3:
-		return 5 * time.Minute
-	case 4:
-		return 15 * time.Minute
-	case 5:
-		return 30 * time.Minute
-	default:
-		return 1 * time.Hour // Cap backoff at 1 hour
-	}
-}
-
 func (js *JobSender) processJobs(ctx context.Context) {
 	var orders []model.Order
 	now := time.Now()
 
 	// Fetch only orders that are:
-	// - In the "processed" status
+	// - In the "processed" status (cancelled orders never reach it)
 	// - With less than MaxSendTries attempts (or nil, which is treated as 0)
 	// - And either without a NextSendAttemptAt or that time is due
 	err := js.jobDB.WithContext(ctx).
@@ -113,26 +104,30 @@ func (js *JobSender) processJobs(ctx context.Context) {
 	}
 
 	js.logger.Info("fetched orders", log.Int("count", len(orders)))
+
+	// result of the send attempt per order, for the order history
+	details := make([]string, len(orders))
 	for i := range orders {
 		order := &orders[i]
 
-		if order.ProcessResultPDF == nil {
+		pdfBytes, readErr := blobstore.ReadPDF(ctx, js.blobStore, order)
+		if errors.Is(readErr, blobstore.ErrNotFound) {
 			js.logger.Error("order has no result PDF", log.Str("orderID", order.OrderID))
 
 			order.Status = model.StatusError
 			errorMessage := "no result PDF created"
 			order.ProcessErrorMessage = &errorMessage
+			details[i] = errorMessage
 			continue
 		}
 
-		// Try to decode PDF
-		pdfBytes, decodeErr := base64.StdEncoding.DecodeString(*order.ProcessResultPDF)
-		if decodeErr != nil {
-			js.logger.Error("decoding PDF", log.Str("orderID", order.OrderID), log.Err(decodeErr))
+		if readErr != nil {
+			js.logger.Error("reading PDF", log.Str("orderID", order.OrderID), log.Err(readErr))
 
 			order.Status = model.StatusError
-			errorMessage := "decoding PDF failed"
+			errorMessage := "reading PDF failed"
 			order.ProcessErrorMessage = &errorMessage
+			details[i] = errorMessage
 			continue
 		}
 
@@ -149,9 +144,10 @@ func (js *JobSender) processJobs(ctx context.Context) {
 			order.LastSendError = &errMsg
 
 			// Set next send attempt time
-			backoff := calculateBackoff(order.SendTries)
+			backoff := helper.RetryBackoff(order.SendTries)
 			nextRetry := now.Add(backoff)
 			order.NextSendAttemptAt = &nextRetry
+			details[i] = fmt.Sprintf("send attempt %d failed: %s", order.SendTries, errMsg)
 
 			// If too many tries -> give up
 			if order.SendTries >= js.MaxRetries {
@@ -160,15 +156,20 @@ func (js *JobSender) processJobs(ctx context.Context) {
 				order.ProcessErrorMessage = &errorMessage
 
 				js.logger.Error("max send tries exceeded", log.Str("orderID", order.OrderID))
+				metrics.MMCSend(metrics.ResultFailed, order.SendTries)
+			} else {
+				metrics.MMCSend(metrics.ResultError, order.SendTries)
 			}
 
 			continue
 		}
 
 		// If sending successful
+		metrics.MMCSend(metrics.ResultSuccess, order.SendTries)
 		order.Status = model.StatusSent
 		order.SentAt = &now
 		order.LastSendError = nil // Clear last error
+		details[i] = fmt.Sprintf("sent with attempt %d", order.SendTries)
 	}
 
 	// Save all updated orders
@@ -177,5 +178,22 @@ func (js *JobSender) processJobs(ctx context.Context) {
 		return
 	}
 
+	for i := range orders {
+		order := &orders[i]
+
+		// failed attempts that are retried are recorded without a status change
+		if err = orderhistory.Record(js.jobDB.WithContext(ctx), order, model.StatusProcessed, order.Status,
+			orderhistory.Sender, details[i]); err != nil {
+			js.logger.Error("recording order event", log.Str("orderID", order.OrderID), log.Err(err))
+		}
+
+		if order.Status == model.StatusProcessed {
+			continue
+		}
+		if err = webhook.Enqueue(js.jobDB.WithContext(ctx), order, model.StatusProcessed, order.Status); err != nil {
+			js.logger.Error("enqueue webhook event", log.Str("orderID", order.OrderID), log.Err(err))
+		}
+	}
+
 	js.logger.Info("successfully processed batch", log.Int("count", len(orders)))
 }
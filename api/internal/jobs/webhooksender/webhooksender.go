@@ -0,0 +1,159 @@
+package webhooksender
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"precisiondosing-api-go/cfg"
+	"precisiondosing-api-go/internal/model"
+	"precisiondosing-api-go/internal/utils/helper"
+	"precisiondosing-api-go/internal/utils/log"
+	"precisiondosing-api-go/internal/webhook"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type WebhookSender struct {
+	ctx           context.Context
+	cancel        context.CancelFunc
+	wg            sync.WaitGroup
+	fetchInterval time.Duration
+	batchSize     int
+	maxRetries    int
+	secret        []byte
+	client        *http.Client
+	jobDB         *gorm.DB
+
+	logger log.Logger
+}
+
+func New(config cfg.WebhookConfig, jobDB *gorm.DB) *WebhookSender {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &WebhookSender{
+		fetchInterval: config.Interval,
+		batchSize:     config.BatchSize,
+		maxRetries:    config.MaxRetries,
+		secret:        config.Secret,
+		client:        webhook.NewClient(config.Timeout),
+		ctx:           ctx,
+		cancel:        cancel,
+		jobDB:         jobDB,
+		logger:        log.WithComponent("webhooksender"),
+	}
+}
+
+func (ws *WebhookSender) Start() {
+	ws.logger.Info("started")
+
+	ws.wg.Add(1)
+	go ws.run()
+}
+
+func (ws *WebhookSender) Stop() {
+	ws.logger.Info("stopped")
+
+	ws.cancel()
+	ws.wg.Wait()
+}
+
+func (ws *WebhookSender) run() {
+	defer ws.wg.Done()
+	ticker := time.NewTicker(ws.fetchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ws.ctx.Done():
+			return
+		case <-ticker.C:
+			ws.processDeliveries(ws.ctx)
+		}
+	}
+}
+
+func (ws *WebhookSender) processDeliveries(ctx context.Context) {
+	var deliveries []model.WebhookDelivery
+	now := time.Now()
+
+	// Oldest events first, so a receiver sees the transitions of an order in order
+	err := ws.jobDB.WithContext(ctx).
+		Where("status = ? AND (next_attempt_at IS NULL OR next_attempt_at <= ?)",
+			model.DeliveryPending, now).
+		Order("id ASC").
+		Limit(ws.batchSize).
+		Find(&deliveries).Error
+	if err != nil {
+		ws.logger.Error("fetching webhook deliveries", log.Err(err))
+		return
+	}
+
+	if len(deliveries) == 0 {
+		return
+	}
+
+	for i := range deliveries {
+		delivery := &deliveries[i]
+		delivery.Tries++
+		delivery.LastAttemptAt = &now
+
+		if err = ws.deliver(ctx, delivery); err != nil {
+			ws.logger.Warn("webhook delivery failed",
+				log.Str("orderID", delivery.OrderID),
+				log.Str("eventID", delivery.EventID),
+				log.Err(err),
+			)
+
+			errMsg := err.Error()
+			delivery.LastError = &errMsg
+
+			nextRetry := now.Add(helper.RetryBackoff(delivery.Tries))
+			delivery.NextAttemptAt = &nextRetry
+
+			if delivery.Tries >= ws.maxRetries {
+				delivery.Status = model.DeliveryFailed
+				ws.logger.Error("max webhook tries exceeded", log.Str("eventID", delivery.EventID))
+			}
+			continue
+		}
+
+		delivery.Status = model.DeliveryDelivered
+		delivery.DeliveredAt = &now
+		delivery.LastError = nil
+		delivery.NextAttemptAt = nil
+	}
+
+	if err = ws.jobDB.WithContext(ctx).Save(&deliveries).Error; err != nil {
+		ws.logger.Error("saving webhook deliveries", log.Err(err))
+		return
+	}
+}
+
+func (ws *WebhookSender) deliver(ctx context.Context, delivery *model.WebhookDelivery) error {
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(webhook.SignatureHeader, webhook.Sign(ws.secret, body))
+	req.Header.Set(webhook.EventIDHeader, delivery.EventID)
+	req.Header.Set(webhook.EventTypeHeader, webhook.EventStatusChanged)
+
+	resp, err := ws.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to make request: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	return nil
+}
@@ -0,0 +1,181 @@
+package loginguard
+
+import (
+	"context"
+	"fmt"
+	"precisiondosing-api-go/cfg"
+	"precisiondosing-api-go/internal/model"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Guard tracks failed logins per account and per client IP. After a number of free
+// attempts, each further attempt on the account has to wait a doubling delay, too many
+// attempts lock the account or IP. IPs get no delays, they might be shared (e.g. NAT).
+// The state is derived from the recorded attempts, clearing them ends a lockout.
+type Guard struct {
+	db     *gorm.DB
+	config cfg.LockoutConfig
+}
+
+type Status struct {
+	FailedAttempts int                  `json:"failed_attempts"` // within the window
+	LastFailedAt   *time.Time           `json:"last_failed_at"`
+	LockedUntil    *time.Time           `json:"locked_until"` // lockout or delay until the next attempt
+	Attempts       []model.LoginAttempt `json:"attempts"`
+}
+
+func New(db *gorm.DB, config cfg.LockoutConfig) *Guard {
+	return &Guard{db: db, config: config}
+}
+
+// Attempt records a login attempt before the password is verified, so concurrent
+// attempts count against each other. It returns how long the client has to wait
+// if the earlier attempts block this one (0 if allowed); a blocked attempt is not
+// recorded. The attempt counts as failed until Clear is called after a successful login.
+func (g *Guard) Attempt(ctx context.Context, email, ip string) (time.Duration, error) {
+	now := time.Now()
+	db := g.db.WithContext(ctx)
+
+	attempt := model.LoginAttempt{Email: normalize(email), IP: ip}
+	if err := db.Create(&attempt).Error; err != nil {
+		return 0, fmt.Errorf("cannot record login attempt: %w", err)
+	}
+
+	accountUntil, err := g.blockedUntil(ctx, "email = ?", attempt.Email, attempt.ID, g.config.MaxAttempts, true, now)
+	if err != nil {
+		return 0, err
+	}
+
+	ipUntil, err := g.blockedUntil(ctx, "ip = ?", ip, attempt.ID, g.config.MaxAttemptsIP, false, now)
+	if err != nil {
+		return 0, err
+	}
+
+	until := accountUntil
+	if ipUntil.After(until) {
+		until = ipUntil
+	}
+
+	if until.After(now) {
+		if err = db.Delete(&attempt).Error; err != nil {
+			return 0, fmt.Errorf("cannot remove blocked login attempt: %w", err)
+		}
+		return until.Sub(now), nil
+	}
+
+	if err = db.Where("created_at < ?", now.Add(-g.retention())).
+		Delete(&model.LoginAttempt{}).Error; err != nil {
+		return 0, fmt.Errorf("cannot remove old login attempts: %w", err)
+	}
+
+	return 0, nil
+}
+
+// Clear removes the failed attempts of an account, e.g. after a successful login.
+// Attempts of the client IPs still count for the IPs.
+func (g *Guard) Clear(ctx context.Context, email string) error {
+	if err := g.db.WithContext(ctx).Where("email = ?", normalize(email)).
+		Delete(&model.LoginAttempt{}).Error; err != nil {
+		return fmt.Errorf("cannot clear login attempts: %w", err)
+	}
+	return nil
+}
+
+// Status returns the failed attempts and lockout of an account.
+func (g *Guard) Status(ctx context.Context, email string) (*Status, error) {
+	now := time.Now()
+
+	attempts := []model.LoginAttempt{}
+	if err := g.db.WithContext(ctx).
+		Where("email = ? AND created_at >= ?", normalize(email), now.Add(-g.retention())).
+		Order("created_at DESC").
+		Find(&attempts).Error; err != nil {
+		return nil, fmt.Errorf("cannot fetch login attempts: %w", err)
+	}
+
+	status := &Status{Attempts: attempts}
+	if len(attempts) == 0 {
+		return status, nil
+	}
+
+	times := make([]time.Time, len(attempts))
+	for i, attempt := range attempts {
+		times[i] = attempt.CreatedAt
+	}
+
+	last := times[0]
+	status.LastFailedAt = &last
+	status.FailedAttempts = countWithin(times, g.config.Window)
+	if until := g.until(times, g.config.MaxAttempts, true); until.After(now) {
+		status.LockedUntil = &until
+	}
+
+	return status, nil
+}
+
+// blockedUntil evaluates the latest failed attempts matching the condition that
+// were recorded before the attempt.
+func (g *Guard) blockedUntil(
+	ctx context.Context, condition, value string, attemptID uint, maxAttempts int, delays bool, now time.Time,
+) (time.Time, error) {
+	var times []time.Time
+	if err := g.db.WithContext(ctx).Model(&model.LoginAttempt{}).
+		Where(condition, value).
+		Where("id < ? AND created_at >= ?", attemptID, now.Add(-g.retention())).
+		Order("created_at DESC").
+		Limit(maxAttempts).
+		Pluck("created_at", &times).Error; err != nil {
+		return time.Time{}, fmt.Errorf("cannot fetch login attempts: %w", err)
+	}
+
+	return g.until(times, maxAttempts, delays), nil
+}
+
+// until returns the time until which logins are blocked after the failed
+// attempts (newest first). The counts are relative to the last failure, so
+// a lockout lasts the full duration even if the window is shorter.
+func (g *Guard) until(times []time.Time, maxAttempts int, delays bool) time.Time {
+	if len(times) == 0 {
+		return time.Time{}
+	}
+
+	last := times[0]
+	count := countWithin(times, g.config.Window)
+	if count >= maxAttempts {
+		return last.Add(g.config.LockoutDuration)
+	}
+
+	if !delays || count <= g.config.FreeAttempts {
+		return time.Time{}
+	}
+
+	delay := g.config.BaseDelay << (count - g.config.FreeAttempts - 1)
+	if delay <= 0 || delay > g.config.LockoutDuration {
+		delay = g.config.LockoutDuration
+	}
+	return last.Add(delay)
+}
+
+// retention is how long attempts are relevant.
+func (g *Guard) retention() time.Duration {
+	return g.config.Window + g.config.LockoutDuration
+}
+
+// countWithin counts the attempts (newest first) within the window before the last one.
+func countWithin(times []time.Time, window time.Duration) int {
+	count := 0
+	for _, t := range times {
+		if times[0].Sub(t) > window {
+			break
+		}
+		count++
+	}
+	return count
+}
+
+func normalize(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
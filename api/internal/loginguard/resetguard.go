@@ -0,0 +1,83 @@
+package loginguard
+
+import (
+	"context"
+	"fmt"
+	"precisiondosing-api-go/cfg"
+	"precisiondosing-api-go/internal/model"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ResetGuard throttles password reset requests per email and per client IP, so the
+// reset endpoint can neither flood an inbox nor be used to probe many accounts.
+type ResetGuard struct {
+	db     *gorm.DB
+	config cfg.ResetThrottleConfig
+}
+
+func NewResetGuard(db *gorm.DB, config cfg.ResetThrottleConfig) *ResetGuard {
+	return &ResetGuard{db: db, config: config}
+}
+
+// Allow records a reset request and returns how long the client has to wait if
+// it exceeds the limits (0 if allowed). Rejected requests are not recorded.
+func (g *ResetGuard) Allow(ctx context.Context, email, ip string) (time.Duration, error) {
+	now := time.Now()
+
+	emailUntil, err := g.blockedUntil(ctx, "email = ?", normalize(email), g.config.MaxPerEmail, now)
+	if err != nil {
+		return 0, err
+	}
+
+	ipUntil, err := g.blockedUntil(ctx, "ip = ?", ip, g.config.MaxPerIP, now)
+	if err != nil {
+		return 0, err
+	}
+
+	until := emailUntil
+	if ipUntil.After(until) {
+		until = ipUntil
+	}
+	if until.After(now) {
+		return until.Sub(now), nil
+	}
+
+	db := g.db.WithContext(ctx)
+	if err = db.Create(&model.ResetRequest{Email: normalize(email), IP: ip}).Error; err != nil {
+		return 0, fmt.Errorf("cannot record reset request: %w", err)
+	}
+
+	if err = db.Where("created_at < ?", now.Add(-g.config.Window)).
+		Delete(&model.ResetRequest{}).Error; err != nil {
+		return 0, fmt.Errorf("cannot remove old reset requests: %w", err)
+	}
+
+	return 0, nil
+}
+
+// blockedUntil returns when the oldest of the maxRequests latest requests matching
+// the condition leaves the window, or zero if fewer requests were made.
+func (g *ResetGuard) blockedUntil(
+	ctx context.Context, condition, value string, maxRequests int, now time.Time,
+) (time.Time, error) {
+	if maxRequests <= 0 {
+		return time.Time{}, nil
+	}
+
+	var times []time.Time
+	if err := g.db.WithContext(ctx).Model(&model.ResetRequest{}).
+		Where(condition, value).
+		Where("created_at >= ?", now.Add(-g.config.Window)).
+		Order("created_at DESC").
+		Limit(maxRequests).
+		Pluck("created_at", &times).Error; err != nil {
+		return time.Time{}, fmt.Errorf("cannot fetch reset requests: %w", err)
+	}
+
+	if len(times) < maxRequests {
+		return time.Time{}, nil
+	}
+	return times[len(times)-1].Add(g.config.Window), nil
+}
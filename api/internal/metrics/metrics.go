@@ -0,0 +1,233 @@
+package metrics
+
+import (
+	"crypto/subtle"
+	"precisiondosing-api-go/internal/model"
+	"precisiondosing-api-go/internal/utils/log"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"gorm.io/gorm"
+)
+
+const namespace = "doseadjust"
+
+// Result labels
+const (
+	ResultSuccess = "success"
+	ResultError   = "error"
+	ResultTimeout = "timeout"
+	ResultFailed  = "failed"
+)
+
+// Services of outbound calls
+const (
+	ServiceMedInfo = "medinfo"
+	ServiceMongo   = "mongo"
+)
+
+//nolint:gochecknoglobals // metrics are registered once per process
+var (
+	registry = prometheus.NewRegistry()
+
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by route, method and status code.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request duration by route and method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	precheckDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "precheck_duration_seconds",
+		Help:      "Duration of prechecks by result.",
+		Buckets:   []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+	}, []string{"result"})
+
+	adjustDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "adjust_duration_seconds",
+		Help:      "Duration of the R dose adjustment by result.",
+		Buckets:   []float64{1, 5, 10, 30, 60, 120, 300, 600, 1800, 3600},
+	}, []string{"result"})
+
+	rTimeouts = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "r_timeouts_total",
+		Help:      "R script runs that timed out.",
+	})
+
+	rRetries = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "r_retries_total",
+		Help:      "R script runs retried after a timeout.",
+	})
+
+	mmcSends = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "mmc_sends_total",
+		Help:      "Result sends to MMC by result (success, error, failed after max. retries).",
+	}, []string{"result"})
+
+	mmcSendTries = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "mmc_send_tries",
+		Help:      "Tries needed until a result was sent or finally failed.",
+		Buckets:   []float64{1, 2, 3, 4, 5, 6, 8, 10},
+	})
+
+	externalDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "external_request_duration_seconds",
+		Help:      "Latency of requests to external services.",
+		Buckets:   []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+	}, []string{"service", "operation"})
+
+	externalErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "external_request_errors_total",
+		Help:      "Failed requests to external services.",
+	}, []string{"service", "operation"})
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests, httpDuration,
+		precheckDuration, adjustDuration, rTimeouts, rRetries,
+		mmcSends, mmcSendTries,
+		externalDuration, externalErrors,
+	)
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func Handler() gin.HandlerFunc {
+	h := promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+	return gin.WrapH(h)
+}
+
+// HTTPHandler records the requests per gin route.
+// Unknown routes are collected under "unmatched" to keep the label set bounded.
+func HTTPHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+
+		httpRequests.WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).Inc()
+		httpDuration.WithLabelValues(c.Request.Method, route).Observe(time.Since(start).Seconds())
+	}
+}
+
+func ObservePrecheck(duration time.Duration, passed bool) {
+	result := ResultSuccess
+	if !passed {
+		result = ResultFailed
+	}
+	precheckDuration.WithLabelValues(result).Observe(duration.Seconds())
+}
+
+func ObserveAdjust(duration time.Duration, result string) {
+	adjustDuration.WithLabelValues(result).Observe(duration.Seconds())
+}
+
+func RTimeout() { rTimeouts.Inc() }
+
+func RRetry() { rRetries.Inc() }
+
+// MMCSend counts a send attempt. Failed attempts that are retried are counted as error,
+// the tries are only observed once the send is final (success or failed).
+func MMCSend(result string, tries int) {
+	mmcSends.WithLabelValues(result).Inc()
+	if result != ResultError {
+		mmcSendTries.Observe(float64(tries))
+	}
+}
+
+// ObserveExternal records the latency of a call to an external service.
+func ObserveExternal(service, operation string, start time.Time, err error) {
+	externalDuration.WithLabelValues(service, operation).Observe(time.Since(start).Seconds())
+	if err != nil {
+		externalErrors.WithLabelValues(service, operation).Inc()
+	}
+}
+
+// RegisterQueueDepth exposes the number of orders waiting in the job channel.
+func RegisterQueueDepth(depth func() int) {
+	registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "job_queue_depth",
+		Help:      "Orders waiting in the job runner channel.",
+	}, func() float64 { return float64(depth()) }))
+}
+
+// RegisterOrderCollector exposes the order counts by status, queried on scrape.
+func RegisterOrderCollector(db *gorm.DB) {
+	registry.MustRegister(&orderCollector{
+		db: db,
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "orders"),
+			"Orders by status.", []string{"status"}, nil),
+		logger: log.WithComponent("metrics"),
+	})
+}
+
+type orderCollector struct {
+	db     *gorm.DB
+	desc   *prometheus.Desc
+	logger log.Logger
+}
+
+func (oc *orderCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- oc.desc
+}
+
+func (oc *orderCollector) Collect(ch chan<- prometheus.Metric) {
+	var counts []struct {
+		Status string
+		Count  int64
+	}
+
+	if err := oc.db.Model(&model.Order{}).
+		Select("status, COUNT(*) AS count").
+		Group("status").
+		Scan(&counts).Error; err != nil {
+		oc.logger.Error("counting orders", log.Err(err))
+		return
+	}
+
+	for _, c := range counts {
+		ch <- prometheus.MustNewConstMetric(oc.desc, prometheus.GaugeValue, float64(c.Count), c.Status)
+	}
+}
+
+// ScrapeTokenHandler serves the metrics directly to requests with the scrape token
+// as Bearer token. Other requests continue down the chain (e.g. to admin authentication).
+func ScrapeTokenHandler(scrapeToken string) gin.HandlerFunc {
+	serve := Handler()
+	return func(c *gin.Context) {
+		expected := "Bearer " + scrapeToken
+		if scrapeToken != "" &&
+			subtle.ConstantTimeCompare([]byte(c.GetHeader("Authorization")), []byte(expected)) == 1 {
+			serve(c)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -2,7 +2,7 @@ package middleware
 
 import (
 	"errors"
-	"precisiondosing-api-go/cfg"
+	"precisiondosing-api-go/internal/apikey"
 	"precisiondosing-api-go/internal/handle"
 	"precisiondosing-api-go/internal/utils/tokens"
 	"strings"
@@ -10,8 +10,37 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-func AuthHandler(authCfg *cfg.AuthTokenConfig) gin.HandlerFunc {
+// AuthHandler accepts a Bearer JWT or an API key in the X-API-Key header.
+func AuthHandler(resourceHandle *handle.ResourceHandle) gin.HandlerFunc {
+	authCfg := &resourceHandle.AuthCfg
+	apiKeys := resourceHandle.APIKeys
+	sessions := resourceHandle.Sessions
+
 	return func(c *gin.Context) {
+		if apiKey := c.GetHeader(APIKeyHeader); apiKey != "" {
+			identity, err := apiKeys.Authenticate(c.Request.Context(), apiKey)
+			if errors.Is(err, apikey.ErrInvalidKey) {
+				handle.UnauthorizedError(c, "Invalid API key")
+				c.Abort()
+				return
+			}
+			if err != nil {
+				handle.ServerError(c, err)
+				c.Abort()
+				return
+			}
+
+			c.Set("user_id", identity.UserID)
+			c.Set("user_email", identity.Email)
+			c.Set("user_role", identity.Role)
+			c.Set("org_id", identity.OrgID)
+			c.Set("permissions", identity.Permissions)
+			c.Set("api_key_id", identity.KeyID)
+			c.Set("scopes", identity.Scopes)
+			c.Next()
+			return
+		}
+
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
 			handle.UnauthorizedError(c, "Authorization header is required")
@@ -33,9 +62,24 @@ func AuthHandler(authCfg *cfg.AuthTokenConfig) gin.HandlerFunc {
 			return
 		}
 
+		revoked, err := sessions.IsRevoked(c.Request.Context(), claims.FamilyID)
+		if err != nil {
+			handle.ServerError(c, err)
+			c.Abort()
+			return
+		}
+		if revoked {
+			handle.UnauthorizedError(c, "Access token revoked")
+			c.Abort()
+			return
+		}
+
+		c.Set("session_id", claims.FamilyID)
 		c.Set("user_id", claims.ID)
 		c.Set("user_email", claims.Email)
 		c.Set("user_role", claims.Role)
+		c.Set("org_id", claims.OrgID)
+		c.Set("permissions", claims.Permissions)
 		c.Next()
 	}
 }
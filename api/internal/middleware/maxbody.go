@@ -1,14 +1,30 @@
 package middleware
 
 import (
+	"io"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 )
 
+const rawBodyKey = "raw_body"
+
 func MaxBodySizeHandler(maxSize int64) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		c.Set(rawBodyKey, c.Request.Body)
 		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxSize)
 		c.Next()
 	}
 }
+
+// BodySizeHandler replaces the limit of MaxBodySizeHandler for a route, e.g. for batch submissions.
+func BodySizeHandler(maxSize int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body := c.Request.Body
+		if raw, ok := c.Get(rawBodyKey); ok {
+			body, _ = raw.(io.ReadCloser)
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, body, maxSize)
+		c.Next()
+	}
+}
@@ -2,13 +2,30 @@ package middleware
 
 import (
 	"net/http"
-	"precisiondosing-api-go/internal/utils/validate"
+	"slices"
 
 	"github.com/gin-gonic/gin"
 )
 
-func AdminAccessHandler() gin.HandlerFunc {
-	return roleHandler("admin")
+// PermissionHandler admits callers whose role grants the permission.
+// The permissions are the scope of the access token or those of the API key's user.
+func PermissionHandler(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !HasPermission(c, permission) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Unauthorized access"})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+func HasPermission(c *gin.Context, permission string) bool {
+	return slices.Contains(Permissions(c), permission)
+}
+
+func Permissions(c *gin.Context) []string {
+	return c.GetStringSlice("permissions")
 }
 
 func UserRole(c *gin.Context) string {
@@ -26,14 +43,7 @@ func UserID(c *gin.Context) uint {
 	return userID
 }
 
-func roleHandler(requiredRole string) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		userRole := UserRole(c)
-		if err := validate.Access(requiredRole, userRole); err != nil {
-			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Unauthorized access"})
-			return
-		}
-
-		c.Next()
-	}
+// SessionID returns the session of the access token (empty if authenticated by API key).
+func SessionID(c *gin.Context) string {
+	return c.GetString("session_id")
 }
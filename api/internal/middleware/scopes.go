@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"precisiondosing-api-go/internal/handle"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+)
+
+const APIKeyHeader = "X-API-Key"
+
+// ScopeHandler restricts API keys with scopes to the endpoints of the scope.
+// JWTs and API keys without scopes pass.
+func ScopeHandler(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scopes := c.GetStringSlice("scopes")
+		if len(scopes) > 0 && !slices.Contains(scopes, scope) {
+			handle.ForbiddenError(c, "API key lacks scope "+scope)
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// APIKeyID returns the ID of the API key of the request (0 if authenticated by JWT).
+func APIKeyID(c *gin.Context) uint {
+	return c.GetUint("api_key_id")
+}
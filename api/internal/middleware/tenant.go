@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"precisiondosing-api-go/internal/model"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// OrganizationID returns the organization (tenant) of the caller, 0 if none.
+func OrganizationID(c *gin.Context) uint {
+	return c.GetUint("org_id")
+}
+
+// AllTenants is true for callers with the tenant:all permission, they are not limited to an organization.
+func AllTenants(c *gin.Context) bool {
+	return HasPermission(c, model.PermTenantAll)
+}
+
+// TenantScope limits a query on table to the organization of the caller.
+// Callers with tenant:all see all organizations, callers without organization see nothing.
+func TenantScope(c *gin.Context, table string) func(*gorm.DB) *gorm.DB {
+	if AllTenants(c) {
+		return func(db *gorm.DB) *gorm.DB { return db }
+	}
+
+	return model.OrgScope(table, OrganizationID(c))
+}
@@ -0,0 +1,50 @@
+package model
+
+import (
+	"slices"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Scopes of API keys. A key without scopes has all permissions of its user.
+const (
+	ScopeDose       = "dose"        // precheck and adjust
+	ScopeOrdersRead = "orders:read" // own orders and their results
+	ScopeModelsRead = "models:read" // model list
+	ScopeAccount    = "account"     // own account
+	ScopeAdmin      = "admin"       // admin endpoints, as far as the permissions of the role allow
+)
+
+// APIKey is a long-lived credential of a user for machine clients.
+// Revoked keys are deleted.
+type APIKey struct {
+	ID         uint       `gorm:"primarykey" json:"-"`
+	UserID     uint       `gorm:"not null;index" json:"-"`
+	User       User       `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+	Name       string     `gorm:"not null;size:255" json:"name"`
+	Prefix     string     `gorm:"type:varchar(32);not null;uniqueIndex" json:"prefix"` // public part of the key
+	KeyHash    string     `gorm:"type:varchar(255);not null" json:"-"`                 // SHA-256 hash of the secret part
+	Scopes     []string   `gorm:"serializer:json;type:json" json:"scopes"`
+	ExpiresAt  *time.Time `gorm:"type:timestamp" json:"expires_at"`
+	LastUsedAt *time.Time `gorm:"type:timestamp" json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"-"`
+}
+
+func (k *APIKey) Expired(now time.Time) bool {
+	return k.ExpiresAt != nil && !now.Before(*k.ExpiresAt)
+}
+
+// HasScope returns true if the key grants the scope. Keys without scopes grant all.
+func (k *APIKey) HasScope(scope string) bool {
+	return len(k.Scopes) == 0 || slices.Contains(k.Scopes, scope)
+}
+
+func GetAPIKeys(db *gorm.DB, userID uint) ([]APIKey, error) {
+	keys := []APIKey{}
+	if err := db.Where(&APIKey{UserID: userID}).Order("id").Find(&keys).Error; err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
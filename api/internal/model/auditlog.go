@@ -0,0 +1,48 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Audit targets
+const (
+	TargetOrder        = "order"
+	TargetUser         = "user"
+	TargetRole         = "role"
+	TargetOrganization = "organization"
+	TargetAPIKey       = "api_key"
+	TargetSystem       = "system"
+)
+
+var ErrAuditAppendOnly = errors.New("audit log entries cannot be changed")
+
+// AuditLog records an administrative or data-access action. Entries are
+// append-only, updates and deletes through the model are rejected.
+type AuditLog struct {
+	ID             uint            `gorm:"primarykey" json:"id"`
+	CreatedAt      time.Time       `gorm:"index" json:"created_at"`
+	ActorID        uint            `gorm:"not null;index" json:"actor_id"`
+	ActorEmail     string          `gorm:"type:varchar(255);not null" json:"actor_email"`
+	ActorRole      string          `gorm:"type:varchar(50);not null" json:"actor_role"`
+	APIKeyID       *uint           `json:"api_key_id,omitempty"`                   // set if authenticated by API key
+	OrganizationID *uint           `gorm:"index" json:"organization_id,omitempty"` // tenant of the actor
+	Action         string          `gorm:"type:varchar(64);not null;index" json:"action"`
+	TargetType     string          `gorm:"type:varchar(20);not null;index:idx_audit_target" json:"target_type"`
+	TargetID       string          `gorm:"type:varchar(255);not null;index:idx_audit_target" json:"target_id"`
+	IP             string          `gorm:"type:varchar(45);not null" json:"ip"`
+	UserAgent      string          `gorm:"type:varchar(512);not null" json:"user_agent"`
+	Before         json.RawMessage `gorm:"type:json" json:"before,omitempty"`
+	After          json.RawMessage `gorm:"type:json" json:"after,omitempty"`
+}
+
+func (*AuditLog) BeforeUpdate(*gorm.DB) error {
+	return ErrAuditAppendOnly
+}
+
+func (*AuditLog) BeforeDelete(*gorm.DB) error {
+	return ErrAuditAppendOnly
+}
@@ -0,0 +1,26 @@
+package model
+
+import (
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Batch groups the orders of one batch submission.
+type Batch struct {
+	gorm.Model
+	BatchID string `gorm:"type:char(36);not null;uniqueIndex"` // UUID
+	UserID  uint   `gorm:"not null;index"`
+	User    User   `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+
+	// Items of the submission, rejected items did not pass the validation
+	Submitted int `gorm:"not null"`
+	Accepted  int `gorm:"not null"`
+	Rejected  int `gorm:"not null"`
+}
+
+func (b *Batch) BeforeCreate(_ *gorm.DB) error {
+	if b.BatchID == "" {
+		b.BatchID = uuid.New().String()
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const MaxIdempotencyKeyLength = 255
+
+// IdempotencyKey is the Idempotency-Key of a submission, scoped per user. It keeps
+// the fingerprint of the request and the original response to answer retries.
+type IdempotencyKey struct {
+	ID          uint            `gorm:"primarykey"`
+	UserID      uint            `gorm:"not null;uniqueIndex:idx_idempotency_user_key"`
+	Key         string          `gorm:"column:idempotency_key;type:varchar(255);not null;uniqueIndex:idx_idempotency_user_key"`
+	Fingerprint string          `gorm:"type:char(64);not null"` // SHA-256 of the request
+	OrderID     string          `gorm:"type:char(36);not null"` // Order UUID
+	Response    json.RawMessage `gorm:"type:json;not null"`     // Original response data
+	ExpiresAt   time.Time       `gorm:"type:timestamp;not null;index"`
+	CreatedAt   time.Time
+}
+
+// GetIdempotencyKey returns the unexpired key of the user, gorm.ErrRecordNotFound if there is none.
+func GetIdempotencyKey(db *gorm.DB, userID uint, key string) (*IdempotencyKey, error) {
+	var found IdempotencyKey
+	if err := db.Where("user_id = ? AND idempotency_key = ? AND expires_at > ?", userID, key, time.Now()).
+		First(&found).Error; err != nil {
+		return nil, err
+	}
+
+	return &found, nil
+}
+
+// SaveIdempotencyKey stores a new key and removes the expired keys of the user, so an
+// expired key can be reused. A concurrent submission with the same key fails on the
+// unique index.
+func SaveIdempotencyKey(db *gorm.DB, key *IdempotencyKey) error {
+	if err := db.Where("user_id = ? AND expires_at <= ?", key.UserID, time.Now()).
+		Delete(&IdempotencyKey{}).Error; err != nil {
+		return err
+	}
+
+	return db.Create(key).Error
+}
+
+// PurgeExpiredIdempotencyKeys removes the expired keys of all users.
+func PurgeExpiredIdempotencyKeys(db *gorm.DB) (int64, error) {
+	result := db.Where("expires_at <= ?", time.Now()).Delete(&IdempotencyKey{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,11 @@
+package model
+
+import "time"
+
+// LoginAttempt is a failed login, used against brute-force attacks.
+type LoginAttempt struct {
+	ID        uint      `gorm:"primarykey" json:"-"`
+	Email     string    `gorm:"type:varchar(255);not null;index:idx_login_attempt_email" json:"-"`
+	IP        string    `gorm:"type:varchar(45);not null;index:idx_login_attempt_ip" json:"ip"`
+	CreatedAt time.Time `gorm:"index" json:"at"`
+}
@@ -0,0 +1,60 @@
+package model
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// OIDCState holds the state, nonce and PKCE verifier of an OIDC login
+// between the redirect to the identity provider and the callback.
+type OIDCState struct {
+	ID         uint      `gorm:"primarykey"`
+	State      string    `gorm:"type:varchar(64);not null;uniqueIndex"`
+	Nonce      string    `gorm:"type:varchar(64);not null"`
+	Verifier   string    `gorm:"type:varchar(128);not null"`
+	LinkUserID *uint     // set if the login links the identity to this local user
+	ExpiresAt  time.Time `gorm:"type:timestamp;not null;index"`
+	CreatedAt  time.Time
+}
+
+var ErrInvalidState = errors.New("invalid or expired login state")
+
+// SaveOIDCState stores a new login state and removes expired ones.
+func SaveOIDCState(db *gorm.DB, state *OIDCState) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("expires_at < ?", time.Now()).Delete(&OIDCState{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(state).Error
+	})
+}
+
+// ConsumeOIDCState returns and deletes the login state, so each state is used once.
+func ConsumeOIDCState(db *gorm.DB, state string) (*OIDCState, error) {
+	var found OIDCState
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("state = ? AND expires_at > ?", state, time.Now()).First(&found).Error; err != nil {
+			return err
+		}
+
+		// concurrent callbacks with the same state: only one deletes it
+		deleted := tx.Delete(&OIDCState{}, found.ID)
+		if deleted.Error != nil {
+			return deleted.Error
+		}
+		if deleted.RowsAffected == 0 {
+			return ErrInvalidState
+		}
+		return nil
+	})
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrInvalidState
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &found, nil
+}
@@ -17,17 +17,35 @@ const (
 	StatusError      = "error"
 	StatusSent       = "sent"
 	StatusSendFailed = "send_failed"
+	StatusCancelled  = "cancelled"
 )
 
+// UnfinishedStatuses are the states before the result of an order exists.
+func UnfinishedStatuses() []string {
+	return []string{StatusQueued, StatusStaged, StatusPrechecked, StatusProcessing}
+}
+
+// CancellableStatuses are the states in which the submitter can withdraw an order.
+func CancellableStatuses() []string {
+	return UnfinishedStatuses()
+}
+
 type Order struct {
 	gorm.Model
 	OrderID string `gorm:"type:char(36);not null;uniqueIndex"` // UUID
 	// Foreign key field
 	UserID uint `gorm:"not null"`
 	User   User `gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL;"`
+	// Tenant, the organization of the user at submission
+	OrganizationID *uint         `gorm:"index"`
+	Organization   *Organization `gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL;"`
+	// Batch submission the order belongs to
+	BatchID *uint  `gorm:"index"`
+	Batch   *Batch `gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL;"`
 
 	// Input
-	OrderData json.RawMessage `gorm:"type:json;not null"` // Original input
+	OrderData   json.RawMessage `gorm:"type:json;not null"` // Original input
+	CallbackURL *string         `gorm:"type:varchar(2048)"` // Webhook target for status changes
 
 	// Precheck stage
 	PrecheckResult *json.RawMessage `gorm:"type:json"`      // Result from precheck (success or error JSON)
@@ -35,11 +53,14 @@ type Order struct {
 	PrecheckedAt   *time.Time       `gorm:"type:timestamp"` // When precheck completed
 
 	// Processing (R job)
-	ProcessResultPDF    *string    `gorm:"type:longtext"`    // Result PDF (success or fallback error PDF)
-	DoseAdjusted        bool       `gorm:"default:false"`    // Was the dose adjusted?
-	ProcessErrorMessage *string    `gorm:"type:text"`        // Error if R process fails (System error -> no PDF)
-	ProcessedAt         *time.Time `gorm:"type:timestamp"`   // When processing completed
-	ProcessingDuration  *string    `gorm:"type:varchar(20)"` // Processing time in seconds
+	ProcessResultPDF    *string    `gorm:"type:longtext"`     // Base64 PDF written by R, moved to the blob store afterwards
+	ResultPDFKey        *string    `gorm:"type:varchar(255)"` // Blob store key of the result PDF (success or fallback error PDF)
+	ResultPDFHash       *string    `gorm:"type:char(64)"`     // SHA-256 of the result PDF
+	ResultPDFSize       *int64     `gorm:"type:bigint"`       // Size of the result PDF in bytes
+	DoseAdjusted        bool       `gorm:"default:false"`     // Was the dose adjusted?
+	ProcessErrorMessage *string    `gorm:"type:text"`         // Error if R process fails (System error -> no PDF)
+	ProcessedAt         *time.Time `gorm:"type:timestamp"`    // When processing completed
+	ProcessingDuration  *string    `gorm:"type:varchar(20)"`  // Processing time in seconds
 
 	// Sending stage
 	SentAt            *time.Time `gorm:"type:timestamp"`
@@ -51,7 +72,9 @@ type Order struct {
 	// queued -> staged -> prechecked -> processing -> (processed, error) -> (sent, send_failed)
 	//
 	// error -> system error (e.g., processing error, no PDF, send failed after retries)
-	Status string `gorm:"type:varchar(50);not null;default:'queued'"`
+	// (queued, staged, prechecked, processing) -> cancelled by the submitter, never sent
+	Status      string     `gorm:"type:varchar(50);not null;default:'queued'"`
+	CancelledAt *time.Time `gorm:"type:timestamp"`
 }
 
 func (j *Order) BeforeCreate(_ *gorm.DB) error {
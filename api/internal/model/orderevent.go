@@ -0,0 +1,23 @@
+package model
+
+import "time"
+
+// Actors of order events that are not users
+const (
+	ActorWorker = "worker" // job runner
+	ActorSender = "sender" // job sender
+	ActorSystem = "system" // e.g. reset of unfinished orders on startup
+)
+
+// OrderEvent is a status transition of an order. The events are kept when an
+// order is requeued, they are the history of the earlier precheck and processing runs.
+type OrderEvent struct {
+	ID         uint      `gorm:"primarykey" json:"-"`
+	CreatedAt  time.Time `json:"created_at"`
+	OrderID    uint      `gorm:"not null;index" json:"-"`
+	FromStatus string    `gorm:"type:varchar(50);not null" json:"from_status,omitempty"` // empty on creation
+	ToStatus   string    `gorm:"type:varchar(50);not null" json:"to_status"`
+	Actor      string    `gorm:"type:varchar(255);not null" json:"actor"` // worker, sender, system or user email
+	ActorID    *uint     `json:"actor_id,omitempty"`                      // set for users
+	Detail     *string   `gorm:"type:text" json:"detail,omitempty"`       // e.g. error message or send result
+}
@@ -0,0 +1,87 @@
+package model
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Organization is a tenant. Its users and their orders are isolated from other
+// organizations: organization admins only see and manage their own organization.
+type Organization struct {
+	ID        uint                 `gorm:"primarykey" json:"id"`
+	Name      string               `gorm:"size:255;not null;uniqueIndex" json:"name"`
+	Settings  OrganizationSettings `gorm:"serializer:json;type:json" json:"settings"`
+	CreatedAt time.Time            `json:"created_at"`
+	UpdatedAt time.Time            `json:"updated_at"`
+}
+
+// OrganizationSettings holds the per-organization configuration. Organization
+// specific features (e.g. delivery endpoints, enabled models or report branding)
+// add their fields here.
+type OrganizationSettings struct{}
+
+// OrgScope limits a query to the rows of an organization. The table qualifies the
+// column for joined queries.
+func OrgScope(table string, organizationID uint) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where(table+".organization_id = ?", organizationID)
+	}
+}
+
+func GetOrganization(db *gorm.DB, id uint) (*Organization, error) {
+	var org Organization
+	if err := db.First(&org, id).Error; err != nil {
+		return nil, err
+	}
+
+	return &org, nil
+}
+
+// FindOrCreateOrganization returns the organization with the name, a missing one is created.
+func FindOrCreateOrganization(db *gorm.DB, name string) (*Organization, error) {
+	var org Organization
+	err := db.Where(&Organization{Name: name}).First(&org).Error
+	if err == nil {
+		return &org, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	org.Name = name
+	if err = db.Create(&org).Error; err != nil {
+		return nil, err
+	}
+
+	return &org, nil
+}
+
+// BackfillOrganizations creates the organizations of the free-text organization of
+// users without organization and assigns the users and their orders to them.
+func BackfillOrganizations(db *gorm.DB) error {
+	var names []string
+	if err := db.Model(&User{}).Unscoped().
+		Where("organization_id IS NULL AND org != ''").
+		Distinct().Pluck("org", &names).Error; err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		org, err := FindOrCreateOrganization(db, name)
+		if err != nil {
+			return err
+		}
+
+		if err = db.Model(&User{}).Unscoped().
+			Where("organization_id IS NULL AND org = ?", name).
+			Update("organization_id", org.ID).Error; err != nil {
+			return err
+		}
+	}
+
+	return db.Exec(`UPDATE orders JOIN users ON users.id = orders.user_id
+		SET orders.organization_id = users.organization_id
+		WHERE orders.organization_id IS NULL AND users.organization_id IS NOT NULL`).Error
+}
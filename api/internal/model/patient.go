@@ -11,6 +11,7 @@ type PatientData struct {
 	PatientCharacteristics PatientCharacteristics `json:"patient_characteristics" binding:"required"`
 	PatientPGXProfile      []PGXProfile           `json:"patient_pgx_profile"`
 	Drugs                  []Drug                 `json:"drugs" binding:"required,dive,required"`
+	CallbackURL            *string                `json:"callback_url,omitempty"`
 }
 
 type PatientCharacteristics struct {
@@ -32,10 +33,42 @@ type PGXProfile struct {
 }
 
 type Drug struct {
-	ActiveSubstances []string    `json:"active_substances" binding:"required"`
-	AdjustDose       bool        `json:"adjust_dose" binding:"required"`
-	Product          *Product    `json:"product"`
-	IntakeCycle      IntakeCycle `json:"intake_cycle" binding:"required"`
+	ActiveSubstances []string `json:"active_substances" binding:"required"`
+	AdjustDose       bool     `json:"adjust_dose" binding:"required"`
+	// AdjustSubstance selects the substance of a combination product to adjust
+	AdjustSubstance *string     `json:"adjust_substance"`
+	Product         *Product    `json:"product"`
+	IntakeCycle     IntakeCycle `json:"intake_cycle" binding:"required"`
+}
+
+// Strength returns the strength of a substance of the drug.
+// Single substance drugs use the strength of the product.
+func (d *Drug) Strength(substance string) (float64, string) {
+	if d.Product == nil {
+		return 0, ""
+	}
+
+	for _, s := range d.Product.Strengths {
+		if strings.EqualFold(s.Substance, substance) {
+			return s.Strength, s.StrengthUnit
+		}
+	}
+
+	if len(d.ActiveSubstances) == 1 {
+		return d.Product.Dose, d.Product.DoseUnit
+	}
+	return 0, ""
+}
+
+// Adjusts reports if the dose of the substance should be adjusted.
+func (d *Drug) Adjusts(substance string) bool {
+	if !d.AdjustDose {
+		return false
+	}
+	if d.AdjustSubstance == nil {
+		return len(d.ActiveSubstances) == 1
+	}
+	return strings.EqualFold(*d.AdjustSubstance, substance)
 }
 
 type Product struct {
@@ -43,16 +76,37 @@ type Product struct {
 	ATC         *string `json:"atc"`
 	Dose        float64 `json:"strength" binding:"required"`
 	DoseUnit    string  `json:"strength_unit" binding:"required"`
+	// Strengths of the substances of a combination product
+	Strengths []SubstanceStrength `json:"strengths"`
+}
+
+type SubstanceStrength struct {
+	Substance    string  `json:"substance"`
+	Strength     float64 `json:"strength"`
+	StrengthUnit string  `json:"strength_unit"`
 }
 
+const (
+	IntakeModeRegular  = "regular"
+	IntakeModeOnDemand = "on_demand"
+)
+
 type IntakeCycle struct {
-	// IntakeMode can be either "on_demand" or "regular"
+	// IntakeMode can be either "on_demand" or "regular" (default)
 	// If "on_demand", the "frequency", "frequency_modifier" and 'intakes' fields are not required
-	// IntakeMode        string      `json:"intake_mode" binding:"required"`
+	// but "max_daily_dose", "typical_dose" and "dosage_unit" are
+	IntakeMode        string      `json:"intake_mode"`
 	StartingAt        *CustomTime `json:"starting_at"`
-	Frequency         string      `json:"frequency" binding:"required"`
-	FrequencyModifier int         `json:"frequency_modifier" binding:"required"`
-	Intakes           []Intake    `json:"intakes" binding:"required,dive,required"`
+	Frequency         string      `json:"frequency"`
+	FrequencyModifier int         `json:"frequency_modifier"`
+	Intakes           []Intake    `json:"intakes" binding:"dive,required"`
+	MaxDailyDose      *float64    `json:"max_daily_dose"`
+	TypicalDose       *float64    `json:"typical_dose"`
+	DosageUnit        string      `json:"dosage_unit"`
+}
+
+func (ic *IntakeCycle) OnDemand() bool {
+	return ic.IntakeMode == IntakeModeOnDemand
 }
 
 type Intake struct {
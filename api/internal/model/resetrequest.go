@@ -0,0 +1,11 @@
+package model
+
+import "time"
+
+// ResetRequest is a requested password reset, used to throttle reset mails.
+type ResetRequest struct {
+	ID        uint      `gorm:"primarykey"`
+	Email     string    `gorm:"type:varchar(255);not null;index:idx_reset_request_email"`
+	IP        string    `gorm:"type:varchar(45);not null;index:idx_reset_request_ip"`
+	CreatedAt time.Time `gorm:"index"`
+}
@@ -0,0 +1,111 @@
+package model
+
+import (
+	"slices"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Permissions are granted by roles and checked per route.
+const (
+	PermOrdersRead    = "orders:read"    // orders of all users
+	PermOrdersRequeue = "orders:requeue" // requeue and resend orders
+	PermOrdersDelete  = "orders:delete"
+	PermPDFDownload   = "pdf:download" // results and inputs of all users
+	PermUsersManage   = "users:manage" // users, their sessions, API keys and lockouts
+	PermOrgsManage    = "orgs:manage"
+	PermRolesManage   = "roles:manage"
+	PermModelsRead    = "models:read"
+	PermSysStats      = "sys:stats" // server stats and metrics
+	PermMedInfoManage = "medinfo:manage"
+	PermAuditRead     = "audit:read"
+	PermTenantAll     = "tenant:all" // not limited to the own organization
+)
+
+// Built-in roles, admin always has all permissions.
+const (
+	RoleAdmin    = "admin"
+	RoleOrgAdmin = "orgadmin"
+	RoleUser     = "user"
+	RoleDebug    = "debug"
+)
+
+// AllPermissions lists the known permissions.
+func AllPermissions() []string {
+	return []string{
+		PermOrdersRead, PermOrdersRequeue, PermOrdersDelete, PermPDFDownload,
+		PermUsersManage, PermOrgsManage, PermRolesManage, PermModelsRead,
+		PermSysStats, PermMedInfoManage, PermAuditRead, PermTenantAll,
+	}
+}
+
+// Role is a named set of permissions. Roles can be edited at runtime,
+// changes apply to tokens issued afterwards (login or refresh).
+type Role struct {
+	ID          uint      `gorm:"primarykey" json:"-"`
+	Name        string    `gorm:"type:varchar(50);not null;uniqueIndex" json:"name"`
+	Description string    `gorm:"size:255;not null;default:''" json:"description"`
+	Permissions []string  `gorm:"serializer:json;type:json" json:"permissions"`
+	Builtin     bool      `gorm:"not null;default:false" json:"builtin"` // cannot be deleted
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+func (r *Role) Has(permission string) bool {
+	return slices.Contains(r.Permissions, permission)
+}
+
+// NeedsOrganization is true for roles that manage or read data of other users
+// without tenant:all, they only work within an organization.
+func (r *Role) NeedsOrganization() bool {
+	if r.Has(PermTenantAll) {
+		return false
+	}
+
+	return slices.ContainsFunc(r.Permissions, func(permission string) bool {
+		return permission == PermOrdersRead || permission == PermPDFDownload || permission == PermUsersManage
+	})
+}
+
+// Covers returns true if the role has all permissions of the other role.
+// Users can only switch to, assign or manage roles their role covers.
+func (r *Role) Covers(other *Role) bool {
+	for _, permission := range other.Permissions {
+		if !r.Has(permission) {
+			return false
+		}
+	}
+	return true
+}
+
+func GetRole(db *gorm.DB, name string) (*Role, error) {
+	var role Role
+	if err := db.Where(&Role{Name: name}).First(&role).Error; err != nil {
+		return nil, err
+	}
+
+	return &role, nil
+}
+
+// SeedRoles creates missing built-in roles. Existing roles keep their edited
+// permissions, only admin is updated to all permissions.
+func SeedRoles(db *gorm.DB) error {
+	builtins := []Role{
+		{Name: RoleAdmin, Description: "Full access", Permissions: AllPermissions()},
+		{Name: RoleOrgAdmin, Description: "Manages the users and orders of the own organization",
+			Permissions: []string{PermOrdersRead, PermPDFDownload, PermUsersManage, PermModelsRead}},
+		{Name: RoleDebug, Description: "Dose adjustment with debug access", Permissions: []string{PermModelsRead}},
+		{Name: RoleUser, Description: "Dose adjustment", Permissions: []string{PermModelsRead}},
+	}
+
+	for i := range builtins {
+		builtins[i].Builtin = true
+		if err := db.Where(&Role{Name: builtins[i].Name}).FirstOrCreate(&builtins[i]).Error; err != nil {
+			return err
+		}
+	}
+
+	return db.Model(&Role{}).Where(&Role{Name: RoleAdmin}).
+		Select("permissions").Updates(&Role{Permissions: AllPermissions()}).Error
+}
@@ -0,0 +1,21 @@
+package model
+
+import (
+	"time"
+)
+
+// Session is a token family: the tokens of one login and all its refreshes.
+// Only the latest refresh token of a family is valid, presenting an older one
+// (reuse) revokes the family.
+type Session struct {
+	ID                uint       `gorm:"primarykey"`
+	FamilyID          string     `gorm:"type:char(36);not null;uniqueIndex"`
+	UserID            uint       `gorm:"not null;index"`
+	User              User       `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	CurrentRefreshJTI string     `gorm:"type:char(36);not null"`
+	ExpiresAt         time.Time  `gorm:"type:timestamp;not null"` // expiry of the current refresh token
+	RevokedAt         *time.Time `gorm:"type:timestamp"`
+	RevokeReason      *string    `gorm:"type:varchar(255)"`
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+}
@@ -11,16 +11,32 @@ type User struct {
 	Email      string     `gorm:"index:idx_email_deleted_at,unique;size:255;not null" json:"email"`
 	LastName   string     `gorm:"not null;size:255" json:"last_name"`
 	FirstName  string     `gorm:"not null;size:255" json:"first_name"`
-	Org        string     `gorm:"not null;size:255" json:"organization"`
-	Role       string     `gorm:"type:enum('admin','user','debug');not null" json:"role"`
+	Org        string     `gorm:"not null;size:255" json:"organization"` // name of the organization
+	Role       string     `gorm:"type:varchar(50);not null" json:"role"` // name of a Role
 	Status     string     `gorm:"type:enum('active','inactive');default:'active';not null" json:"status"`
 	LastLogin  *time.Time `gorm:"type:timestamp;" json:"last_login"`
 	PwdHash    *string    `gorm:"default:null;size:255" json:"-"`
+	// Tenant of the user, admins may have none
+	OrganizationID *uint         `gorm:"index" json:"organization_id"`
+	Organization   *Organization `gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL;" json:"-"`
+	// Default webhook target for status changes of the user's orders
+	CallbackURL *string `gorm:"default:null;size:2048" json:"callback_url"`
+	// Identity at the OIDC identity provider, set when provisioned or linked
+	OIDCIssuer  *string `gorm:"column:oidc_issuer;default:null;size:255;index:idx_oidc_identity,unique" json:"-"`
+	OIDCSubject *string `gorm:"column:oidc_subject;default:null;size:255;index:idx_oidc_identity,unique" json:"-"`
 	// Soft delete
-	DeletedAt gorm.DeletedAt `gorm:"index:idx_email_deleted_at,unique" json:"-"`
+	DeletedAt gorm.DeletedAt `gorm:"index:idx_email_deleted_at,unique;index:idx_oidc_identity,unique" json:"-"`
 	Orders    []Order        `json:"-"`
 }
 
+// OrgID returns the organization of the user, 0 if none.
+func (u *User) OrgID() uint {
+	if u.OrganizationID == nil {
+		return 0
+	}
+	return *u.OrganizationID
+}
+
 func (u *User) Save(db *gorm.DB) error {
 	return db.Save(u).Error
 }
@@ -32,7 +48,7 @@ func (u *User) UpdateLastLogin(db *gorm.DB) error {
 
 func CountActiveAdmins(db *gorm.DB) (int64, error) {
 	var count int64
-	if err := db.Model(&User{}).Where(&User{Role: "admin", Status: "active"}).Count(&count).Error; err != nil {
+	if err := db.Model(&User{}).Where(&User{Role: RoleAdmin, Status: "active"}).Count(&count).Error; err != nil {
 		return 0, err
 	}
 
@@ -65,6 +81,16 @@ func GetUserByID(db *gorm.DB, id uint, joins ...string) (*User, error) {
 	return &user, nil
 }
 
+// GetUserByOIDCIdentity returns the user linked to the subject of the identity provider.
+func GetUserByOIDCIdentity(db *gorm.DB, issuer, subject string) (*User, error) {
+	var user User
+	if err := db.Where("oidc_issuer = ? AND oidc_subject = ?", issuer, subject).First(&user).Error; err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
 func IsEmailAvailable(mail string, tx *gorm.DB, excludeID uint) (bool, error) {
 	var exists bool
 
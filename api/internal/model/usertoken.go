@@ -0,0 +1,93 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"precisiondosing-api-go/internal/utils/hash"
+	"precisiondosing-api-go/internal/utils/tokens"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	TokenPurposeReset  = "reset"
+	TokenPurposeInvite = "invite"
+)
+
+// UserToken is a single-use token to set the password of a user,
+// either after "forgot password" or to set up an invited account.
+type UserToken struct {
+	gorm.Model
+	UserID    uint       `gorm:"not null;index"`
+	User      User       `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	Purpose   string     `gorm:"type:enum('reset','invite');not null"`
+	Selector  string     `gorm:"type:varchar(32);not null;uniqueIndex"` // public lookup part of the token
+	TokenHash string     `gorm:"type:varchar(255);not null"`            // argon2 hash of the secret part
+	ExpiresAt time.Time  `gorm:"type:timestamp;not null"`
+	UsedAt    *time.Time `gorm:"type:timestamp"`
+}
+
+// Valid returns true if the token was not used and is not expired.
+func (t *UserToken) Valid(now time.Time) bool {
+	return t.UsedAt == nil && now.Before(t.ExpiresAt)
+}
+
+// RevokeUserTokens invalidates all open tokens of a user for a purpose,
+// so only the latest issued token can be used.
+func RevokeUserTokens(db *gorm.DB, userID uint, purpose string) error {
+	return db.Where("user_id = ? AND purpose = ? AND used_at IS NULL", userID, purpose).
+		Delete(&UserToken{}).Error
+}
+
+var ErrInvalidToken = errors.New("invalid or expired token")
+
+// IssueUserToken creates a token for the user and revokes older open tokens of the
+// same purpose. Returns the token to hand out, only its hash is stored.
+func IssueUserToken(db *gorm.DB, userID uint, purpose string, validFor time.Duration) (string, error) {
+	pair, err := tokens.CreateResetTokens()
+	if err != nil {
+		return "", err
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if revokeErr := RevokeUserTokens(tx, userID, purpose); revokeErr != nil {
+			return revokeErr
+		}
+
+		return tx.Create(&UserToken{
+			UserID:    userID,
+			Purpose:   purpose,
+			Selector:  pair.Selector,
+			TokenHash: pair.TokenHash,
+			ExpiresAt: time.Now().Add(validFor),
+		}).Error
+	})
+	if err != nil {
+		return "", fmt.Errorf("cannot store token: %w", err)
+	}
+
+	return pair.Token, nil
+}
+
+// FindUserToken returns the valid token matching the handed out token string.
+func FindUserToken(db *gorm.DB, token string) (*UserToken, error) {
+	selector, secret, err := tokens.SplitResetToken(token)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	var userToken UserToken
+	if err = db.Where(&UserToken{Selector: selector}).First(&userToken).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidToken
+		}
+		return nil, err
+	}
+
+	if match, _ := hash.Check(userToken.TokenHash, secret); !match || !userToken.Valid(time.Now()) {
+		return nil, ErrInvalidToken
+	}
+
+	return &userToken, nil
+}
@@ -0,0 +1,30 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+type WebhookDelivery struct {
+	gorm.Model
+	EventID string          `gorm:"type:char(36);not null;uniqueIndex"` // UUID
+	OrderID string          `gorm:"type:char(36);not null;index"`       // Order UUID
+	URL     string          `gorm:"type:varchar(2048);not null"`
+	Payload json.RawMessage `gorm:"type:json;not null"` // Signed event body
+
+	// pending -> (delivered, failed)
+	Status        string     `gorm:"type:varchar(20);not null;default:'pending';index"`
+	Tries         int        `gorm:"default:0"`
+	LastAttemptAt *time.Time `gorm:"type:timestamp"`
+	LastError     *string    `gorm:"type:text"`
+	NextAttemptAt *time.Time `gorm:"type:timestamp"`
+	DeliveredAt   *time.Time `gorm:"type:timestamp"`
+}
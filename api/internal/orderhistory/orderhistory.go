@@ -0,0 +1,61 @@
+// Package orderhistory records the status transitions of orders.
+package orderhistory
+
+import (
+	"fmt"
+	"precisiondosing-api-go/internal/middleware"
+	"precisiondosing-api-go/internal/model"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Actor caused a transition, either a background job or a user.
+type Actor struct {
+	Name   string
+	UserID *uint
+}
+
+//nolint:gochecknoglobals // fixed actors of the background jobs
+var (
+	Worker = Actor{Name: model.ActorWorker}
+	Sender = Actor{Name: model.ActorSender}
+	System = Actor{Name: model.ActorSystem}
+)
+
+// User is the caller of the request.
+func User(c *gin.Context) Actor {
+	userID := middleware.UserID(c)
+	return Actor{Name: middleware.UserMail(c), UserID: &userID}
+}
+
+// Record stores a transition of the order, an empty detail is left out.
+// Pass a transaction to make the event part of the status update.
+func Record(db *gorm.DB, order *model.Order, from, to string, actor Actor, detail string) error {
+	event := model.OrderEvent{
+		OrderID:    order.ID,
+		FromStatus: from,
+		ToStatus:   to,
+		Actor:      actor.Name,
+		ActorID:    actor.UserID,
+	}
+	if detail != "" {
+		event.Detail = &detail
+	}
+
+	if err := db.Create(&event).Error; err != nil {
+		return fmt.Errorf("cannot store order event: %w", err)
+	}
+
+	return nil
+}
+
+// RecordAll stores the same transition for several orders.
+func RecordAll(db *gorm.DB, orders []model.Order, to string, actor Actor, detail string) error {
+	for i := range orders {
+		if err := Record(db, &orders[i], orders[i].Status, to, actor, detail); err != nil {
+			return err
+		}
+	}
+	return nil
+}
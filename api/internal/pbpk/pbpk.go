@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 	"precisiondosing-api-go/cfg"
 	"precisiondosing-api-go/internal/utils/log"
+	"slices"
 	"sort"
 	"strings"
 
@@ -13,9 +14,31 @@ import (
 )
 
 type ModelDefinition struct {
-	ID           string   `yaml:"id"`
-	Victim       string   `yaml:"victim"`
-	Perpetrators []string `yaml:"perpetrators"`
+	ID           string        `yaml:"id"`
+	Victim       string        `yaml:"victim"`
+	Perpetrators []string      `yaml:"perpetrators"`
+	Genes        []GeneSupport `yaml:"genes"`
+}
+
+// GeneSupport lists the phenotypes of a gene a model can simulate.
+// Models without a gene entry do not account for that gene.
+type GeneSupport struct {
+	Gene       string   `yaml:"gene"`
+	Phenotypes []string `yaml:"phenotypes"`
+}
+
+// Gene returns the supported phenotypes of a gene or nil if the model does not declare it.
+func (m *ModelDefinition) Gene(gene string) *GeneSupport {
+	for i := range m.Genes {
+		if strings.EqualFold(m.Genes[i].Gene, gene) {
+			return &m.Genes[i]
+		}
+	}
+	return nil
+}
+
+func (g *GeneSupport) Supports(phenotype string) bool {
+	return slices.Contains(g.Phenotypes, phenotype)
 }
 
 type Models struct {
@@ -96,6 +119,14 @@ func mustParseYAML(configFile string) []ModelDefinition {
 			modelsWrapper.Models[i].Perpetrators[j] = strings.ToLower(modelsWrapper.Models[i].Perpetrators[j])
 		}
 		sort.Strings(modelsWrapper.Models[i].Perpetrators)
+
+		for j := range modelsWrapper.Models[i].Genes {
+			gene := &modelsWrapper.Models[i].Genes[j]
+			gene.Gene = strings.ToUpper(gene.Gene)
+			for k := range gene.Phenotypes {
+				gene.Phenotypes[k] = strings.ToLower(gene.Phenotypes[k])
+			}
+		}
 	}
 
 	return modelsWrapper.Models
@@ -0,0 +1,205 @@
+package pgx
+
+import (
+	"fmt"
+	"precisiondosing-api-go/internal/model"
+	"strings"
+)
+
+const (
+	PoorMetabolizer         = "poor_metabolizer"
+	IntermediateMetabolizer = "intermediate_metabolizer"
+	NormalMetabolizer       = "normal_metabolizer"
+	RapidMetabolizer        = "rapid_metabolizer"
+	UltrarapidMetabolizer   = "ultrarapid_metabolizer"
+	Indeterminate           = "indeterminate"
+)
+
+type Phenotype struct {
+	Gene          string   `json:"gene"`
+	Genotype      string   `json:"genotype"`
+	Phenotype     string   `json:"phenotype"`
+	ActivityScore *float64 `json:"activity_score,omitempty"`
+}
+
+// Allele function classes
+const (
+	noFunction        = 0.0
+	reducedFunction   = 0.25 // CYP2D6*10
+	decreasedFunction = 0.5
+	normalFunction    = 1.0
+	increasedFunction = 1.5
+)
+
+// Activity score cut-offs (CPIC)
+const (
+	cyp2d6PoorScore         = 0.0
+	cyp2d6IntermediateBelow = 1.25
+	cyp2d6NormalMax         = 2.25
+	cyp2c9PoorBelow         = 1.0
+	cyp2c9IntermediateBelow = 2.0
+)
+
+// Activity values per allele (CPIC). Alleles that are not listed are unknown
+// and make the phenotype indeterminate.
+//
+//nolint:gochecknoglobals // lookup tables
+var alleleValues = map[string]map[string]float64{
+	"CYP2D6": {
+		"*1": normalFunction, "*2": normalFunction, "*27": normalFunction, "*33": normalFunction,
+		"*34": normalFunction, "*35": normalFunction, "*39": normalFunction, "*45": normalFunction,
+		"*46": normalFunction,
+		"*9":  decreasedFunction, "*14": decreasedFunction, "*17": decreasedFunction, "*29": decreasedFunction,
+		"*41": decreasedFunction, "*49": decreasedFunction, "*59": decreasedFunction,
+		"*10": reducedFunction,
+		"*3":  noFunction, "*4": noFunction, "*5": noFunction, "*6": noFunction, "*7": noFunction,
+		"*8": noFunction, "*11": noFunction, "*12": noFunction, "*13": noFunction, "*15": noFunction,
+		"*19": noFunction, "*20": noFunction, "*21": noFunction, "*31": noFunction, "*36": noFunction,
+		"*38": noFunction, "*40": noFunction, "*42": noFunction,
+	},
+	"CYP2C9": {
+		"*1": normalFunction, "*9": normalFunction,
+		"*2": decreasedFunction, "*5": decreasedFunction, "*8": decreasedFunction,
+		"*11": decreasedFunction, "*12": decreasedFunction,
+		"*3": noFunction, "*6": noFunction, "*13": noFunction, "*15": noFunction, "*25": noFunction,
+	},
+	"CYP2C19": {
+		"*1":  normalFunction,
+		"*17": increasedFunction,
+		"*9":  decreasedFunction,
+		"*2":  noFunction, "*3": noFunction, "*4": noFunction, "*5": noFunction,
+		"*6": noFunction, "*7": noFunction, "*8": noFunction, "*35": noFunction,
+	},
+	"CYP3A5": {
+		"*1": normalFunction,
+		"*3": noFunction, "*6": noFunction, "*7": noFunction,
+	},
+}
+
+// Genes whose phenotype is derived from the summed activity score.
+// Copy number variations scale the activity of an allele.
+//
+//nolint:gochecknoglobals // lookup tables
+var activityScoreGenes = map[string]func(score float64) string{
+	"CYP2D6": func(score float64) string {
+		switch {
+		case score == cyp2d6PoorScore:
+			return PoorMetabolizer
+		case score < cyp2d6IntermediateBelow:
+			return IntermediateMetabolizer
+		case score <= cyp2d6NormalMax:
+			return NormalMetabolizer
+		default:
+			return UltrarapidMetabolizer
+		}
+	},
+	"CYP2C9": func(score float64) string {
+		switch {
+		case score < cyp2c9PoorBelow:
+			return PoorMetabolizer
+		case score < cyp2c9IntermediateBelow:
+			return IntermediateMetabolizer
+		default:
+			return NormalMetabolizer
+		}
+	},
+}
+
+// Resolve translates the genotype of a gene into its phenotype.
+// Unknown genes or alleles result in an indeterminate phenotype.
+func Resolve(profile model.PGXProfile) Phenotype {
+	gene := strings.ToUpper(strings.TrimSpace(profile.Gene))
+	allele1 := NormalizeAllele(profile.Allele1)
+	allele2 := NormalizeAllele(profile.Allele2)
+
+	result := Phenotype{
+		Gene:      gene,
+		Genotype:  genotype(allele1, profile.Allele1CNVMultiplier, allele2, profile.Allele2CNVMultiplier),
+		Phenotype: Indeterminate,
+	}
+
+	values, ok := alleleValues[gene]
+	if !ok {
+		return result
+	}
+
+	value1, ok1 := values[allele1]
+	value2, ok2 := values[allele2]
+	if !ok1 || !ok2 {
+		return result
+	}
+
+	if classify, ok := activityScoreGenes[gene]; ok {
+		score := value1*float64(max(profile.Allele1CNVMultiplier, 1)) +
+			value2*float64(max(profile.Allele2CNVMultiplier, 1))
+		result.ActivityScore = &score
+		result.Phenotype = classify(score)
+		return result
+	}
+
+	result.Phenotype = classifyFunction(value1, value2)
+	return result
+}
+
+// ResolveAll resolves every gene of a profile. If a gene is listed more than once,
+// the first entry wins.
+func ResolveAll(profiles []model.PGXProfile) []Phenotype {
+	var phenotypes []Phenotype
+	seen := map[string]bool{}
+	for _, profile := range profiles {
+		phenotype := Resolve(profile)
+		if seen[phenotype.Gene] {
+			continue
+		}
+		seen[phenotype.Gene] = true
+		phenotypes = append(phenotypes, phenotype)
+	}
+	return phenotypes
+}
+
+// NormalizeAllele reduces an allele to its star allele number,
+// e.g. "*4A/B" -> "*4" or " *17 " -> "*17".
+func NormalizeAllele(allele string) string {
+	allele = strings.TrimSpace(allele)
+	allele, _, _ = strings.Cut(allele, "/")
+	if !strings.HasPrefix(allele, "*") {
+		return strings.ToUpper(allele)
+	}
+
+	end := 1
+	for end < len(allele) && allele[end] >= '0' && allele[end] <= '9' {
+		end++
+	}
+	if end == 1 {
+		return strings.ToUpper(allele)
+	}
+	return allele[:end]
+}
+
+// classifyFunction follows the CPIC function class combinations
+// for genes without an activity score (CYP2C19, CYP3A5).
+func classifyFunction(value1, value2 float64) string {
+	low, high := min(value1, value2), max(value1, value2)
+	switch {
+	case high == noFunction, low == noFunction && high == decreasedFunction:
+		return PoorMetabolizer
+	case low == noFunction, low == decreasedFunction:
+		return IntermediateMetabolizer
+	case low == normalFunction && high == normalFunction:
+		return NormalMetabolizer
+	case low == normalFunction:
+		return RapidMetabolizer
+	default:
+		return UltrarapidMetabolizer
+	}
+}
+
+func genotype(allele1 string, cnv1 int, allele2 string, cnv2 int) string {
+	format := func(allele string, cnv int) string {
+		if cnv > 1 {
+			return fmt.Sprintf("%sx%d", allele, cnv)
+		}
+		return allele
+	}
+	return format(allele1, cnv1) + "/" + format(allele2, cnv2)
+}
@@ -0,0 +1,255 @@
+package pgx
+
+import (
+	"precisiondosing-api-go/internal/model"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		name      string
+		profile   model.PGXProfile
+		genotype  string
+		phenotype string
+		score     *float64
+	}{
+		{
+			name:      "CYP2D6 no function alleles",
+			profile:   profile("CYP2D6", "*4", 1, "*4", 1),
+			genotype:  "*4/*4",
+			phenotype: PoorMetabolizer,
+			score:     score(0),
+		},
+		{
+			name:      "CYP2D6 duplicated normal allele",
+			profile:   profile("CYP2D6", "*1", 1, "*2", 2),
+			genotype:  "*1/*2x2",
+			phenotype: UltrarapidMetabolizer,
+			score:     score(3),
+		},
+		{
+			name:      "CYP2D6 reduced function alleles",
+			profile:   profile("CYP2D6", "*10", 1, "*10", 1),
+			genotype:  "*10/*10",
+			phenotype: IntermediateMetabolizer,
+			score:     score(0.5),
+		},
+		{
+			name:      "CYP2D6 normal and no function allele",
+			profile:   profile("CYP2D6", "*1", 1, "*4", 1),
+			genotype:  "*1/*4",
+			phenotype: IntermediateMetabolizer,
+			score:     score(1),
+		},
+		{
+			name:      "CYP2D6 lowest normal score",
+			profile:   profile("CYP2D6", "*1", 1, "*10", 1),
+			genotype:  "*1/*10",
+			phenotype: NormalMetabolizer,
+			score:     score(1.25),
+		},
+		{
+			name:      "CYP2D6 highest normal score",
+			profile:   profile("CYP2D6", "*1", 2, "*10", 1),
+			genotype:  "*1x2/*10",
+			phenotype: NormalMetabolizer,
+			score:     score(2.25),
+		},
+		{
+			name:      "CYP2D6 deleted allele",
+			profile:   profile("CYP2D6", "*5", 1, "*41", 1),
+			genotype:  "*5/*41",
+			phenotype: IntermediateMetabolizer,
+			score:     score(0.5),
+		},
+		{
+			name:      "CYP2D6 missing CNV multiplier counts once",
+			profile:   profile("CYP2D6", "*1", 0, "*1", 0),
+			genotype:  "*1/*1",
+			phenotype: NormalMetabolizer,
+			score:     score(2),
+		},
+		{
+			name:      "CYP2D6 sub-alleles and case are normalized",
+			profile:   profile(" cyp2d6 ", " *4A ", 1, "*1/*2", 1),
+			genotype:  "*4/*1",
+			phenotype: IntermediateMetabolizer,
+			score:     score(1),
+		},
+		{
+			name:      "CYP2C9 normal",
+			profile:   profile("CYP2C9", "*1", 1, "*1", 1),
+			genotype:  "*1/*1",
+			phenotype: NormalMetabolizer,
+			score:     score(2),
+		},
+		{
+			name:      "CYP2C9 decreased function allele",
+			profile:   profile("CYP2C9", "*1", 1, "*2", 1),
+			genotype:  "*1/*2",
+			phenotype: IntermediateMetabolizer,
+			score:     score(1.5),
+		},
+		{
+			name:      "CYP2C9 lowest intermediate score",
+			profile:   profile("CYP2C9", "*1", 1, "*3", 1),
+			genotype:  "*1/*3",
+			phenotype: IntermediateMetabolizer,
+			score:     score(1),
+		},
+		{
+			name:      "CYP2C9 poor",
+			profile:   profile("CYP2C9", "*2", 1, "*3", 1),
+			genotype:  "*2/*3",
+			phenotype: PoorMetabolizer,
+			score:     score(0.5),
+		},
+		{
+			name:      "CYP2C19 normal",
+			profile:   profile("CYP2C19", "*1", 1, "*1", 1),
+			genotype:  "*1/*1",
+			phenotype: NormalMetabolizer,
+		},
+		{
+			name:      "CYP2C19 rapid",
+			profile:   profile("CYP2C19", "*1", 1, "*17", 1),
+			genotype:  "*1/*17",
+			phenotype: RapidMetabolizer,
+		},
+		{
+			name:      "CYP2C19 ultrarapid",
+			profile:   profile("CYP2C19", "*17", 1, "*17", 1),
+			genotype:  "*17/*17",
+			phenotype: UltrarapidMetabolizer,
+		},
+		{
+			name:      "CYP2C19 no and increased function allele",
+			profile:   profile("CYP2C19", "*2", 1, "*17", 1),
+			genotype:  "*2/*17",
+			phenotype: IntermediateMetabolizer,
+		},
+		{
+			name:      "CYP2C19 decreased function alleles",
+			profile:   profile("CYP2C19", "*9", 1, "*9", 1),
+			genotype:  "*9/*9",
+			phenotype: IntermediateMetabolizer,
+		},
+		{
+			name:      "CYP2C19 no and decreased function allele",
+			profile:   profile("CYP2C19", "*2", 1, "*9", 1),
+			genotype:  "*2/*9",
+			phenotype: PoorMetabolizer,
+		},
+		{
+			name:      "CYP2C19 poor",
+			profile:   profile("CYP2C19", "*2", 1, "*3", 1),
+			genotype:  "*2/*3",
+			phenotype: PoorMetabolizer,
+		},
+		{
+			name:      "CYP3A5 expresser",
+			profile:   profile("CYP3A5", "*1", 1, "*3", 1),
+			genotype:  "*1/*3",
+			phenotype: IntermediateMetabolizer,
+		},
+		{
+			name:      "CYP3A5 non-expresser",
+			profile:   profile("CYP3A5", "*3", 1, "*3", 1),
+			genotype:  "*3/*3",
+			phenotype: PoorMetabolizer,
+		},
+		{
+			name:      "unknown allele",
+			profile:   profile("CYP2D6", "*1", 1, "*999", 1),
+			genotype:  "*1/*999",
+			phenotype: Indeterminate,
+		},
+		{
+			name:      "unknown allele without activity score",
+			profile:   profile("CYP2C19", "*1", 1, "*99", 1),
+			genotype:  "*1/*99",
+			phenotype: Indeterminate,
+		},
+		{
+			name:      "unknown gene",
+			profile:   profile("TPMT", "*1", 1, "*3A", 1),
+			genotype:  "*1/*3",
+			phenotype: Indeterminate,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Resolve(tt.profile)
+			if got.Genotype != tt.genotype {
+				t.Errorf("genotype = %q, want %q", got.Genotype, tt.genotype)
+			}
+			if got.Phenotype != tt.phenotype {
+				t.Errorf("phenotype = %q, want %q", got.Phenotype, tt.phenotype)
+			}
+			switch {
+			case tt.score == nil && got.ActivityScore != nil:
+				t.Errorf("activity score = %v, want none", *got.ActivityScore)
+			case tt.score != nil && got.ActivityScore == nil:
+				t.Errorf("activity score missing, want %v", *tt.score)
+			case tt.score != nil && *got.ActivityScore != *tt.score:
+				t.Errorf("activity score = %v, want %v", *got.ActivityScore, *tt.score)
+			}
+		})
+	}
+}
+
+func TestResolveAll(t *testing.T) {
+	phenotypes := ResolveAll([]model.PGXProfile{
+		profile("CYP2D6", "*4", 1, "*4", 1),
+		profile("CYP2C19", "*1", 1, "*17", 1),
+		profile("cyp2d6", "*1", 1, "*1", 1),
+	})
+
+	if len(phenotypes) != 2 {
+		t.Fatalf("got %d phenotypes, want 2", len(phenotypes))
+	}
+	if phenotypes[0].Gene != "CYP2D6" || phenotypes[0].Phenotype != PoorMetabolizer {
+		t.Errorf("first entry of a gene should win, got %+v", phenotypes[0])
+	}
+	if phenotypes[1].Gene != "CYP2C19" || phenotypes[1].Phenotype != RapidMetabolizer {
+		t.Errorf("got %+v, want CYP2C19 %s", phenotypes[1], RapidMetabolizer)
+	}
+}
+
+func TestNormalizeAllele(t *testing.T) {
+	tests := []struct {
+		allele string
+		want   string
+	}{
+		{"*4", "*4"},
+		{"*4A", "*4"},
+		{" *17 ", "*17"},
+		{"*2xN", "*2"},
+		{"*4/*5", "*4"},
+		{"*", "*"},
+		{"*a", "*A"},
+		{"ref", "REF"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := NormalizeAllele(tt.allele); got != tt.want {
+			t.Errorf("NormalizeAllele(%q) = %q, want %q", tt.allele, got, tt.want)
+		}
+	}
+}
+
+func profile(gene, allele1 string, cnv1 int, allele2 string, cnv2 int) model.PGXProfile {
+	return model.PGXProfile{
+		Gene:                 gene,
+		Allele1:              allele1,
+		Allele1CNVMultiplier: cnv1,
+		Allele2:              allele2,
+		Allele2CNVMultiplier: cnv2,
+	}
+}
+
+func score(value float64) *float64 {
+	return &value
+}
@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"precisiondosing-api-go/internal/model"
 	"precisiondosing-api-go/internal/pbpk"
+	"precisiondosing-api-go/internal/pgx"
 	"precisiondosing-api-go/internal/services/individualdb"
 	"precisiondosing-api-go/internal/services/medinfo"
 	"precisiondosing-api-go/internal/utils/helper"
@@ -15,8 +16,6 @@ import (
 	"slices"
 	"strings"
 	"time"
-
-	cron "github.com/robfig/cron"
 )
 
 type Intake struct {
@@ -30,6 +29,7 @@ type Compound struct {
 	NameInModel string   `json:"name_in_model"`
 	Synonyms    []string `json:"synonyms"`
 	Adjust      bool     `json:"adjust"`
+	OnDemand    bool     `json:"on_demand"`
 	DoseAmount  float64  `json:"dose_amount"`
 	DoseUnit    string   `json:"dose_unit"`
 	Schedule    []Intake `json:"schedule"`
@@ -48,12 +48,14 @@ func (c *Compound) HasName(name string) bool {
 }
 
 type Result struct {
-	Message           string                        `json:"message"`
-	Compounds         []Compound                    `json:"compounds"`
-	Interactions      []medinfo.CompoundInteraction `json:"interactions"`
-	OrganImpairment   bool                          `json:"impairment"`
-	VirtualIndividual json.RawMessage               `json:"virtual_individual"`
-	ModelID           string                        `json:"model_id"`
+	Message                string                        `json:"message"`
+	Compounds              []Compound                    `json:"compounds"`
+	Interactions           []medinfo.CompoundInteraction `json:"interactions"`
+	OrganImpairment        bool                          `json:"impairment"`
+	VirtualIndividual      json.RawMessage               `json:"virtual_individual"`
+	VirtualIndividualMatch *individualdb.Match           `json:"virtual_individual_match,omitempty"`
+	ModelID                string                        `json:"model_id"`
+	PGXPhenotypes          []pgx.Phenotype               `json:"pgx_phenotypes"`
 }
 
 type Error struct {
@@ -135,6 +137,9 @@ func (p *PreCheck) Check(data *model.PatientData) (*Result, *Error) {
 	// Impairment check
 	p.impairmentCheck(response, data)
 
+	// Pharmacogenomic check
+	p.pgxCheck(response, data)
+
 	// MedInfo check
 	err = p.medinfoCheck(response)
 	if err != nil {
@@ -167,18 +172,32 @@ func (p *PreCheck) pbpkModelCheck(resp *Result) *Error {
 	perpetrators := findPerpetrators(victim, resp)
 
 	// Step 3: Match against available PBPK models
-	model, victimNameInModel := p.findMatchingModel(victim, perpetrators)
-	if model == nil {
+	match, rejections := p.findMatchingModel(victim, perpetrators, resp.PGXPhenotypes)
+	if match == nil && len(rejections) > 0 {
+		resp.Message = appendMsg(resp.Message, fmt.Sprintf(
+			"PBPK Model Check: No model supports the pharmacogenomic profile of the patient (%s).",
+			strings.Join(rejections, ", ")))
+		return NewError("no model supports the pharmacogenomic profile", false)
+	}
+	if match == nil {
 		resp.Message = appendMsg(resp.Message, "PBPK Model Check: No model found for victim and perpetrators.")
 		return NewError("no model found for victim and perpetrators", false)
 	}
 
 	// Step 4: Assign and return
-	resp.ModelID = model.ID
-	victim.NameInModel = victimNameInModel
+	resp.ModelID = match.model.ID
+	for c, nameInModel := range match.names {
+		c.NameInModel = nameInModel
+	}
 	return nil
 }
 
+type modelMatch struct {
+	model *pbpk.ModelDefinition
+	names map[*Compound]string // compound -> name in model
+	genes int                  // number of patient genes the model accounts for
+}
+
 func findVictim(comps []Compound) *Compound {
 	for i := range comps {
 		if comps[i].Adjust {
@@ -212,41 +231,91 @@ func findPerpetrators(victim *Compound, resp *Result) []*Compound {
 	return perps
 }
 
-func (p *PreCheck) findMatchingModel(victim *Compound, perps []*Compound) (*pbpk.ModelDefinition, string) {
-	for _, m := range p.PBPKModels.Definitions {
-		if !victim.HasName(m.Victim) {
+// findMatchingModel returns the model for the victim and perpetrators that supports
+// the phenotypes of the patient. Models accounting for more of the patient's genes are preferred.
+// If models only fail because of the phenotypes, the rejected phenotypes are returned.
+func (p *PreCheck) findMatchingModel(
+	victim *Compound,
+	perps []*Compound,
+	phenotypes []pgx.Phenotype,
+) (*modelMatch, []string) {
+	var best *modelMatch
+	var rejections []string
+
+	for i := range p.PBPKModels.Definitions {
+		m := &p.PBPKModels.Definitions[i]
+		names, ok := matchCompounds(m, victim, perps)
+		if !ok {
 			continue
 		}
-		victim.NameInModel = m.Victim
 
-		// Must have same count
-		if len(perps) != len(m.Perpetrators) {
+		genes, rejection := geneticsCheck(m, phenotypes)
+		if rejection != "" {
+			if !slices.Contains(rejections, rejection) {
+				rejections = append(rejections, rejection)
+			}
 			continue
 		}
 
-		matchedNames := make(map[string]bool)
-		for _, nameMod := range m.Perpetrators {
-			matched := false
-			for _, c := range perps {
-				if c.HasName(nameMod) {
-					c.NameInModel = nameMod
-					matchedNames[nameMod] = true
-					matched = true
-					break
-				}
-			}
-			if !matched {
-				matchedNames = nil
+		if best == nil || genes > best.genes {
+			best = &modelMatch{model: m, names: names, genes: genes}
+		}
+	}
+
+	return best, rejections
+}
+
+func matchCompounds(m *pbpk.ModelDefinition, victim *Compound, perps []*Compound) (map[*Compound]string, bool) {
+	if !victim.HasName(m.Victim) {
+		return nil, false
+	}
+
+	// Must have same count
+	if len(perps) != len(m.Perpetrators) {
+		return nil, false
+	}
+
+	names := map[*Compound]string{victim: m.Victim}
+	for _, nameMod := range m.Perpetrators {
+		matched := false
+		for _, c := range perps {
+			if c.HasName(nameMod) {
+				names[c] = nameMod
+				matched = true
 				break
 			}
 		}
+		if !matched {
+			return nil, false
+		}
+	}
+
+	return names, true
+}
+
+// geneticsCheck checks the patient's phenotypes against the genes declared by the model.
+// Genes without a genotype are assumed to be normal metabolizers.
+// Returns the number of patient genes covered or the rejected phenotype.
+func geneticsCheck(m *pbpk.ModelDefinition, phenotypes []pgx.Phenotype) (int, string) {
+	covered := 0
+	for i := range m.Genes {
+		gene := &m.Genes[i]
+		phenotype := pgx.NormalMetabolizer
+
+		idx := slices.IndexFunc(phenotypes, func(ph pgx.Phenotype) bool { return ph.Gene == gene.Gene })
+		if idx >= 0 {
+			phenotype = phenotypes[idx].Phenotype
+		}
+
+		if !gene.Supports(phenotype) {
+			return 0, gene.Gene + " " + phenotype
+		}
 
-		// all perpetrators matched
-		if matchedNames != nil && len(m.Perpetrators) == len(matchedNames) {
-			return &m, m.Victim
+		if idx >= 0 {
+			covered++
 		}
 	}
-	return nil, ""
+	return covered, ""
 }
 
 func (p *PreCheck) impairmentCheck(resp *Result, data *model.PatientData) {
@@ -263,6 +332,17 @@ func (p *PreCheck) impairmentCheck(resp *Result, data *model.PatientData) {
 	resp.OrganImpairment = ld || kd
 }
 
+func (p *PreCheck) pgxCheck(resp *Result, data *model.PatientData) {
+	resp.PGXPhenotypes = pgx.ResolveAll(data.PatientPGXProfile)
+
+	for _, phenotype := range resp.PGXPhenotypes {
+		if phenotype.Phenotype == pgx.Indeterminate {
+			resp.Message = appendMsg(resp.Message, fmt.Sprintf(
+				"PGx Check: Phenotype of %s (%s) could not be determined.", phenotype.Gene, phenotype.Genotype))
+		}
+	}
+}
+
 func (p *PreCheck) virtualIndividualCheck(resp *Result, data *model.PatientData) *Error {
 	age := data.PatientCharacteristics.Age
 	weight := int(math.Round(data.PatientCharacteristics.Weight))
@@ -270,16 +350,19 @@ func (p *PreCheck) virtualIndividualCheck(resp *Result, data *model.PatientData)
 	sex := data.PatientCharacteristics.Sex
 	population := data.PatientCharacteristics.Ethnicity
 
-	individualPayload, err := p.mongoDB.FetchIndividual(population, sex, age, height, weight)
+	match, err := p.mongoDB.FetchIndividual(population, sex, age, height, weight)
 	if err != nil {
 		return NewError("fetching individual", true, err)
 	}
 
-	trimmed := bytes.TrimSpace(individualPayload)
-	preCheckSuccess := len(trimmed) > 0 &&
-		!bytes.Equal(trimmed, []byte("[]")) &&
-		!bytes.Equal(trimmed, []byte("{}")) &&
-		!bytes.Equal(trimmed, []byte("null"))
+	preCheckSuccess := false
+	if match != nil {
+		trimmed := bytes.TrimSpace(match.Payload)
+		preCheckSuccess = len(trimmed) > 0 &&
+			!bytes.Equal(trimmed, []byte("[]")) &&
+			!bytes.Equal(trimmed, []byte("{}")) &&
+			!bytes.Equal(trimmed, []byte("null"))
+	}
 
 	if !preCheckSuccess {
 		p.logger.Warn("no virtual individual matched demographic data",
@@ -294,7 +377,15 @@ func (p *PreCheck) virtualIndividualCheck(resp *Result, data *model.PatientData)
 		return NewError("no virtual individual matched demographic data", false)
 	}
 
-	resp.VirtualIndividual = individualPayload
+	dev := match.Deviation
+	if dev.Age != 0 || dev.Height != 0 || dev.Weight != 0 || match.Sex != strings.ToUpper(sex) {
+		resp.Message = appendMsg(resp.Message, fmt.Sprintf(
+			"Virtual Individual Check: Closest individual used (sex %s, age %+d y, height %+d cm, weight %+.1f kg, BMI %+.1f).",
+			match.Sex, dev.Age, dev.Height, dev.Weight, dev.BMI))
+	}
+
+	resp.VirtualIndividual = match.Payload
+	resp.VirtualIndividualMatch = match
 	return nil
 }
 
@@ -303,46 +394,38 @@ func (p *PreCheck) virtualIndividualCheck(resp *Result, data *model.PatientData)
 func (p *PreCheck) drugCompounds(resp *Result, data *model.PatientData) *Error {
 	compounds := map[string]Compound{}
 	now := time.Now()
-	startOfDay := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	window := simulationStart(data.Drugs, now)
 
-	parser := cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow)
 	for _, drug := range data.Drugs {
-		compoundsList := drug.ActiveSubstances
-		if len(compoundsList) > 1 {
-			p.logger.Warn("multiple active substances in a single drug",
-				log.Str("peoduct", helper.DerefOrDefault(drug.Product.ProductName, "unknown")),
-				log.Str("active_substances", strings.Join(compoundsList, ",")),
-			)
-
-			resp.Message = appendMsg(resp.Message, "Multiple active substances in a single drug not supported")
-			return NewError("multiple active substances in a single drug", false)
+		var schedule []Intake
+		var err error
+		if drug.IntakeCycle.OnDemand() {
+			schedule = buildOnDemandSchedule(&drug.IntakeCycle, p.PBPKModels.MaxDoses, window)
+		} else {
+			schedule, err = buildSchedule(&drug.IntakeCycle, p.PBPKModels.MaxDoses, window, now)
 		}
 
-		c := strings.ToLower(compoundsList[0])
-		adjust := drug.AdjustDose
-		amount := drug.Product.Dose
-		unit := drug.Product.DoseUnit
-		schedule := []Intake{}
-		for _, intake := range drug.IntakeCycle.Intakes {
-			s, _ := parser.Parse(intake.Cron)
-			next := startOfDay
-			for range make([]int, p.PBPKModels.MaxDoses) {
-				next = s.Next(next)
-				timeStr := next.Format("2006-01-02 15:04")
-				schedule = append(schedule, Intake{
-					RawTimeStr:  timeStr,
-					Dosage:      intake.Dosage,
-					Formulation: intake.DosageUnit,
-				})
+		// combination products are split into one compound per substance
+		for _, substance := range drug.ActiveSubstances {
+			c := strings.ToLower(substance)
+			if err != nil {
+				resp.Message = appendMsg(resp.Message, fmt.Sprintf("Schedule of %s: %s", c, err))
+				return NewError("building intake schedule", false, err)
+			}
+			if drug.IntakeCycle.OnDemand() {
+				resp.Message = appendMsg(resp.Message, fmt.Sprintf(
+					"Schedule of %s: Taken on demand, maximum daily dose assumed.", c))
 			}
-		}
 
-		compounds[c] = Compound{
-			Name:       c,
-			Adjust:     adjust,
-			DoseAmount: amount,
-			DoseUnit:   unit,
-			Schedule:   schedule,
+			amount, unit := drug.Strength(substance)
+			compounds[c] = Compound{
+				Name:       c,
+				Adjust:     drug.Adjusts(substance),
+				OnDemand:   drug.IntakeCycle.OnDemand(),
+				DoseAmount: amount,
+				DoseUnit:   unit,
+				Schedule:   schedule,
+			}
 		}
 	}
 
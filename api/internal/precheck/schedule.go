@@ -0,0 +1,190 @@
+package precheck
+
+import (
+	"fmt"
+	"math"
+	"precisiondosing-api-go/internal/model"
+	"sort"
+	"strings"
+	"time"
+
+	cron "github.com/robfig/cron"
+)
+
+const (
+	daysPerWeek    = 7
+	cronTimeFields = 2 // minute and hour
+
+	onDemandFirstIntake = 8 * time.Hour
+	onDemandEpsilon     = 1e-6 // ignore floating point remainders of the daily dose
+)
+
+// MaxOnDemandDosesPerDay caps the intakes of an on-demand drug per day (hourly).
+const MaxOnDemandDosesPerDay = 24
+
+type dose struct {
+	at     time.Time
+	intake *model.Intake
+}
+
+// startDay is the day of `starting_at` of the cycle, today if not set.
+func startDay(cycle *model.IntakeCycle, now time.Time) time.Time {
+	if cycle.StartingAt != nil {
+		s := cycle.StartingAt.Time
+		return time.Date(s.Year(), s.Month(), s.Day(), 0, 0, 0, 0, now.Location())
+	}
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+}
+
+// simulationStart is the first day on which all drugs are taken: the latest start day.
+// The schedules of all drugs begin on this day, so they overlap in the simulation.
+func simulationStart(drugs []model.Drug, now time.Time) time.Time {
+	var start time.Time
+	for i := range drugs {
+		if day := startDay(&drugs[i].IntakeCycle, now); day.After(start) {
+			start = day
+		}
+	}
+	return start
+}
+
+// buildSchedule expands the intakes of a drug into a chronological list of doses.
+// The days of intake follow the frequency of the cycle from the day of `starting_at`
+// (today if not set), while the minute and hour fields of the intake crons give the times
+// of intake on these days. Only doses from the window day on are listed, all intakes are
+// merged and capped at maxDoses.
+func buildSchedule(cycle *model.IntakeCycle, maxDoses int, window, now time.Time) ([]Intake, error) {
+	start := startDay(cycle, now)
+
+	dayOf, err := intakeDays(cycle.Frequency, max(cycle.FrequencyModifier, 1), start)
+	if err != nil {
+		return nil, err
+	}
+
+	parser := cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow)
+	daily := make([]cron.Schedule, len(cycle.Intakes))
+	for i, intake := range cycle.Intakes {
+		fields := strings.Fields(intake.Cron)
+		if len(fields) < cronTimeFields {
+			return nil, fmt.Errorf("invalid cron expression %q", intake.Cron)
+		}
+
+		// The day fields are superseded by the frequency of the cycle
+		daily[i], err = parser.Parse(fields[0] + " " + fields[1] + " * * *")
+		if err != nil {
+			return nil, fmt.Errorf("error parsing cron expression %q: %w", intake.Cron, err)
+		}
+	}
+
+	schedule := []Intake{}
+	if len(daily) == 0 {
+		return schedule, nil
+	}
+
+	for n := 0; len(schedule) < maxDoses; n++ {
+		day := dayOf(n)
+		nextDay := day.AddDate(0, 0, 1)
+		if !nextDay.After(window) {
+			continue
+		}
+
+		var doses []dose
+		for i, s := range daily {
+			for next := s.Next(day.Add(-time.Nanosecond)); next.Before(nextDay); next = s.Next(next) {
+				doses = append(doses, dose{at: next, intake: &cycle.Intakes[i]})
+			}
+		}
+		sort.SliceStable(doses, func(i, j int) bool { return doses[i].at.Before(doses[j].at) })
+
+		for _, d := range doses {
+			if len(schedule) == maxDoses {
+				break
+			}
+			schedule = append(schedule, Intake{
+				RawTimeStr:  d.at.Format("2006-01-02 15:04"),
+				Dosage:      d.intake.Dosage,
+				Formulation: d.intake.DosageUnit,
+			})
+		}
+	}
+
+	return schedule, nil
+}
+
+// CheckFrequency rejects intake frequencies no schedule can be built for.
+func CheckFrequency(frequency string) error {
+	_, err := intakeDays(frequency, 1, time.Time{})
+	return err
+}
+
+// intakeDays returns a function giving the n-th day of intake from the start day.
+// Without frequency the intakes are taken every day. Intakes taken as needed
+// are assumed to be taken every day (worst case, like on-demand drugs).
+func intakeDays(frequency string, modifier int, start time.Time) (func(n int) time.Time, error) {
+	switch frequency {
+	case "", "days", "daily", "as_needed":
+		return func(n int) time.Time { return start.AddDate(0, 0, n*modifier) }, nil
+	case "weeks", "weekly":
+		return func(n int) time.Time { return start.AddDate(0, 0, n*modifier*daysPerWeek) }, nil
+	case "months", "monthly":
+		return func(n int) time.Time { return addMonths(start, n*modifier) }, nil
+	default:
+		return nil, fmt.Errorf("unsupported intake frequency %q", frequency)
+	}
+}
+
+// addMonths adds months to a date, clamping the day to the end of shorter months
+// (e.g. Jan 31 + 1 month = Feb 28).
+func addMonths(t time.Time, months int) time.Time {
+	firstOfMonth := time.Date(t.Year(), t.Month()+time.Month(months), 1, 0, 0, 0, 0, t.Location())
+	lastDay := firstOfMonth.AddDate(0, 1, -1).Day()
+	return time.Date(firstOfMonth.Year(), firstOfMonth.Month(), min(t.Day(), lastDay),
+		t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+}
+
+// buildOnDemandSchedule assumes the worst case for a drug taken as needed: the patient
+// takes the maximum daily dose every day, split into typical doses evenly spread over
+// the day from 08:00. A remainder smaller than the typical dose is taken last.
+// At most MaxOnDemandDosesPerDay intakes are scheduled per day.
+// The schedule starts at the window day.
+func buildOnDemandSchedule(cycle *model.IntakeCycle, maxDoses int, window time.Time) []Intake {
+	day := window
+
+	typical := *cycle.TypicalDose
+	maxDaily := *cycle.MaxDailyDose
+
+	// more intakes than the cap: the daily dose is split into the max. intakes instead
+	if maxDaily/typical > MaxOnDemandDosesPerDay {
+		typical = maxDaily / MaxOnDemandDosesPerDay
+	}
+
+	nTypical := min(int(math.Floor(maxDaily/typical)), MaxOnDemandDosesPerDay)
+	remainder := maxDaily - float64(nTypical)*typical
+
+	dosages := make([]float64, nTypical, nTypical+1)
+	for i := range dosages {
+		dosages[i] = typical
+	}
+	if remainder > onDemandEpsilon*typical {
+		dosages = append(dosages, remainder)
+	}
+
+	interval := 24 * time.Hour / time.Duration(len(dosages))
+	schedule := []Intake{}
+	for len(schedule) < maxDoses {
+		first := day.Add(onDemandFirstIntake)
+		for i, dosage := range dosages {
+			if len(schedule) == maxDoses {
+				break
+			}
+			schedule = append(schedule, Intake{
+				RawTimeStr:  first.Add(time.Duration(i) * interval).Format("2006-01-02 15:04"),
+				Dosage:      dosage,
+				Formulation: cycle.DosageUnit,
+			})
+		}
+		day = day.AddDate(0, 0, 1)
+	}
+
+	return schedule
+}
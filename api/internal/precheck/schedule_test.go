@@ -0,0 +1,359 @@
+package precheck
+
+import (
+	"math"
+	"precisiondosing-api-go/internal/model"
+	"testing"
+	"time"
+)
+
+func TestCheckFrequency(t *testing.T) {
+	tests := []struct {
+		frequency string
+		valid     bool
+	}{
+		{"", true},
+		{"days", true},
+		{"daily", true},
+		{"as_needed", true},
+		{"weeks", true},
+		{"weekly", true},
+		{"months", true},
+		{"monthly", true},
+		{"hourly", false},
+		{"yearly", false},
+		{"Daily", false},
+	}
+
+	for _, tt := range tests {
+		if err := CheckFrequency(tt.frequency); (err == nil) != tt.valid {
+			t.Errorf("CheckFrequency(%q) = %v, want valid %v", tt.frequency, err, tt.valid)
+		}
+	}
+}
+
+func TestAddMonths(t *testing.T) {
+	tests := []struct {
+		from   time.Time
+		months int
+		want   time.Time
+	}{
+		{date(2025, 1, 15), 1, date(2025, 2, 15)},
+		{date(2025, 1, 31), 1, date(2025, 2, 28)},
+		{date(2024, 1, 31), 1, date(2024, 2, 29)},
+		{date(2025, 3, 31), 1, date(2025, 4, 30)},
+		{date(2025, 11, 30), 3, date(2026, 2, 28)},
+		{date(2025, 1, 31), 0, date(2025, 1, 31)},
+	}
+
+	for _, tt := range tests {
+		if got := addMonths(tt.from, tt.months); !got.Equal(tt.want) {
+			t.Errorf("addMonths(%s, %d) = %s, want %s", day(tt.from), tt.months, day(got), day(tt.want))
+		}
+	}
+}
+
+func TestSimulationStart(t *testing.T) {
+	now := time.Date(2025, 3, 10, 14, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		starts []*time.Time
+		want   time.Time
+	}{
+		{"without start dates", []*time.Time{nil, nil}, date(2025, 3, 10)},
+		{"past start dates", []*time.Time{ptr(date(2025, 1, 1)), ptr(date(2025, 2, 1))}, date(2025, 2, 1)},
+		{"drug without start date is taken from today", []*time.Time{ptr(date(2025, 2, 1)), nil}, date(2025, 3, 10)},
+		{"latest start date wins", []*time.Time{ptr(date(2025, 4, 1)), ptr(date(2025, 3, 20)), nil}, date(2025, 4, 1)},
+		{"time of day is ignored", []*time.Time{ptr(time.Date(2025, 4, 1, 18, 0, 0, 0, time.UTC))}, date(2025, 4, 1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			drugs := make([]model.Drug, len(tt.starts))
+			for i, start := range tt.starts {
+				if start != nil {
+					drugs[i].IntakeCycle.StartingAt = &model.CustomTime{Time: *start}
+				}
+			}
+
+			if got := simulationStart(drugs, now); !got.Equal(tt.want) {
+				t.Errorf("simulationStart = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildSchedule(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	twiceDaily := []model.Intake{
+		{Cron: "0 20 * * *", Dosage: 20},
+		{Cron: "0 8 * * *", Dosage: 10},
+	}
+
+	tests := []struct {
+		name     string
+		cycle    model.IntakeCycle
+		maxDoses int
+		window   time.Time
+		want     []string
+		dosages  []float64
+	}{
+		{
+			name:     "daily intakes are merged chronologically",
+			cycle:    model.IntakeCycle{Frequency: "daily", Intakes: twiceDaily},
+			maxDoses: 5,
+			window:   date(2025, 1, 1),
+			want: []string{
+				"2025-01-01 08:00", "2025-01-01 20:00", "2025-01-02 08:00", "2025-01-02 20:00", "2025-01-03 08:00",
+			},
+			dosages: []float64{10, 20, 10, 20, 10},
+		},
+		{
+			name:     "day fields of the cron are superseded",
+			cycle:    model.IntakeCycle{Intakes: []model.Intake{{Cron: "30 7 * * 1", Dosage: 5}}},
+			maxDoses: 3,
+			window:   date(2025, 1, 1),
+			want:     []string{"2025-01-01 07:30", "2025-01-02 07:30", "2025-01-03 07:30"},
+		},
+		{
+			name:     "frequency modifier",
+			cycle:    model.IntakeCycle{Frequency: "days", FrequencyModifier: 3, Intakes: twiceDaily[1:]},
+			maxDoses: 3,
+			window:   date(2025, 1, 1),
+			want:     []string{"2025-01-01 08:00", "2025-01-04 08:00", "2025-01-07 08:00"},
+		},
+		{
+			name: "as needed is taken every day",
+			cycle: model.IntakeCycle{
+				Frequency: "as_needed", StartingAt: at(date(2025, 1, 2)), Intakes: twiceDaily[1:],
+			},
+			maxDoses: 2,
+			window:   date(2025, 1, 2),
+			want:     []string{"2025-01-02 08:00", "2025-01-03 08:00"},
+		},
+		{
+			name: "weekly keeps its phase after the window",
+			cycle: model.IntakeCycle{
+				Frequency: "weekly", StartingAt: at(date(2025, 1, 1)), Intakes: twiceDaily[1:],
+			},
+			maxDoses: 2,
+			window:   date(2025, 1, 10),
+			want:     []string{"2025-01-15 08:00", "2025-01-22 08:00"},
+		},
+		{
+			name: "bi-weekly",
+			cycle: model.IntakeCycle{
+				Frequency: "weeks", FrequencyModifier: 2, StartingAt: at(date(2025, 1, 1)), Intakes: twiceDaily[1:],
+			},
+			maxDoses: 2,
+			window:   date(2025, 1, 1),
+			want:     []string{"2025-01-01 08:00", "2025-01-15 08:00"},
+		},
+		{
+			name: "monthly is clamped to the end of shorter months",
+			cycle: model.IntakeCycle{
+				Frequency: "monthly", StartingAt: at(date(2025, 1, 31)), Intakes: twiceDaily[1:],
+			},
+			maxDoses: 3,
+			window:   date(2025, 1, 31),
+			want:     []string{"2025-01-31 08:00", "2025-02-28 08:00", "2025-03-31 08:00"},
+		},
+		{
+			name: "doses before the window are skipped",
+			cycle: model.IntakeCycle{
+				Frequency: "daily", StartingAt: at(date(2024, 12, 30)), Intakes: twiceDaily,
+			},
+			maxDoses: 2,
+			window:   date(2025, 1, 1),
+			want:     []string{"2025-01-01 08:00", "2025-01-01 20:00"},
+		},
+		{
+			name: "start in the far past",
+			cycle: model.IntakeCycle{
+				Frequency: "daily", StartingAt: at(date(1900, 1, 1)), Intakes: twiceDaily[1:],
+			},
+			maxDoses: 1,
+			window:   date(2025, 1, 1),
+			want:     []string{"2025-01-01 08:00"},
+		},
+		{
+			name:     "without intakes",
+			cycle:    model.IntakeCycle{Frequency: "daily"},
+			maxDoses: 5,
+			window:   date(2025, 1, 1),
+			want:     []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule, err := buildSchedule(&tt.cycle, tt.maxDoses, tt.window, now)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			checkTimes(t, schedule, tt.want)
+			for i, dosage := range tt.dosages {
+				if schedule[i].Dosage != dosage {
+					t.Errorf("dose %d: dosage = %v, want %v", i, schedule[i].Dosage, dosage)
+				}
+			}
+		})
+	}
+}
+
+func TestBuildScheduleErrors(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		cycle model.IntakeCycle
+	}{
+		{"unsupported frequency", model.IntakeCycle{Frequency: "hourly", Intakes: []model.Intake{{Cron: "0 8 * * *"}}}},
+		{"cron without hour", model.IntakeCycle{Frequency: "daily", Intakes: []model.Intake{{Cron: "0"}}}},
+		{"invalid cron", model.IntakeCycle{Frequency: "daily", Intakes: []model.Intake{{Cron: "0 25 * * *"}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := buildSchedule(&tt.cycle, 1, date(2025, 1, 1), now); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestBuildOnDemandSchedule(t *testing.T) {
+	window := date(2025, 1, 1)
+
+	tests := []struct {
+		name       string
+		typical    float64
+		maxDaily   float64
+		maxDoses   int
+		want       []string
+		dosages    []float64
+		perDay     int
+		dailyTotal float64
+	}{
+		{
+			name:     "remainder is taken last",
+			typical:  2,
+			maxDaily: 5,
+			maxDoses: 4,
+			want:     []string{"2025-01-01 08:00", "2025-01-01 16:00", "2025-01-02 00:00", "2025-01-02 08:00"},
+			dosages:  []float64{2, 2, 1, 2},
+		},
+		{
+			name:     "even split",
+			typical:  1,
+			maxDaily: 2,
+			maxDoses: 3,
+			want:     []string{"2025-01-01 08:00", "2025-01-01 20:00", "2025-01-02 08:00"},
+			dosages:  []float64{1, 1, 1},
+		},
+		{
+			name:     "typical dose above the max. daily dose",
+			typical:  10,
+			maxDaily: 4,
+			maxDoses: 2,
+			want:     []string{"2025-01-01 08:00", "2025-01-02 08:00"},
+			dosages:  []float64{4, 4},
+		},
+		{
+			name:       "floating point remainder",
+			typical:    0.1,
+			maxDaily:   0.3,
+			maxDoses:   3,
+			perDay:     3,
+			dailyTotal: 0.3,
+		},
+		{
+			name:       "intakes are capped per day",
+			typical:    1e-9,
+			maxDaily:   1e9,
+			maxDoses:   2 * MaxOnDemandDosesPerDay,
+			perDay:     MaxOnDemandDosesPerDay,
+			dailyTotal: 1e9,
+		},
+		{
+			name:       "cap is reached exactly",
+			typical:    1,
+			maxDaily:   MaxOnDemandDosesPerDay,
+			maxDoses:   MaxOnDemandDosesPerDay,
+			perDay:     MaxOnDemandDosesPerDay,
+			dailyTotal: MaxOnDemandDosesPerDay,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cycle := model.IntakeCycle{
+				IntakeMode:   model.IntakeModeOnDemand,
+				TypicalDose:  &tt.typical,
+				MaxDailyDose: &tt.maxDaily,
+				DosageUnit:   "mg",
+			}
+			schedule := buildOnDemandSchedule(&cycle, tt.maxDoses, window)
+
+			if len(schedule) != tt.maxDoses {
+				t.Fatalf("got %d doses, want %d", len(schedule), tt.maxDoses)
+			}
+			if tt.want != nil {
+				checkTimes(t, schedule, tt.want)
+			}
+			for i, dosage := range tt.dosages {
+				if schedule[i].Dosage != dosage {
+					t.Errorf("dose %d: dosage = %v, want %v", i, schedule[i].Dosage, dosage)
+				}
+			}
+
+			if tt.perDay == 0 {
+				return
+			}
+			total := 0.0
+			for _, intake := range schedule[:tt.perDay] {
+				if intake.Formulation != "mg" {
+					t.Errorf("formulation = %q, want mg", intake.Formulation)
+				}
+				total += intake.Dosage
+			}
+			if math.Abs(total-tt.dailyTotal) > 1e-9*tt.dailyTotal {
+				t.Errorf("daily total = %v, want %v", total, tt.dailyTotal)
+			}
+			if len(schedule) > tt.perDay && schedule[tt.perDay].RawTimeStr != "2025-01-02 08:00" {
+				t.Errorf("second day starts at %s, want 2025-01-02 08:00", schedule[tt.perDay].RawTimeStr)
+			}
+		})
+	}
+}
+
+func checkTimes(t *testing.T, schedule []Intake, want []string) {
+	t.Helper()
+
+	if len(schedule) != len(want) {
+		t.Fatalf("got %d doses, want %d", len(schedule), len(want))
+	}
+	for i, intake := range schedule {
+		if intake.RawTimeStr != want[i] {
+			t.Errorf("dose %d at %s, want %s", i, intake.RawTimeStr, want[i])
+		}
+	}
+}
+
+func date(year int, month time.Month, d int) time.Time {
+	return time.Date(year, month, d, 0, 0, 0, 0, time.UTC)
+}
+
+func day(t time.Time) string {
+	return t.Format("2006-01-02")
+}
+
+func at(t time.Time) *model.CustomTime {
+	return &model.CustomTime{Time: t}
+}
+
+func ptr(t time.Time) *time.Time {
+	return &t
+}
@@ -11,7 +11,9 @@ import (
 	"precisiondosing-api-go/internal/controller/testcontroller"
 	"precisiondosing-api-go/internal/controller/usercontroller"
 	"precisiondosing-api-go/internal/handle"
+	"precisiondosing-api-go/internal/metrics"
 	"precisiondosing-api-go/internal/middleware"
+	"precisiondosing-api-go/internal/model"
 
 	"github.com/gin-gonic/gin"
 	swaggerFiles "github.com/swaggo/files"
@@ -28,13 +30,31 @@ func RegisterSysRoutes(r *gin.RouterGroup, resourceHandle *handle.ResourceHandle
 	}
 
 	server := r.Group("/sys/server")
-	server.Use(middleware.AuthHandler(&resourceHandle.AuthCfg), middleware.AdminAccessHandler())
+	server.Use(middleware.AuthHandler(resourceHandle), middleware.PermissionHandler(model.PermSysStats),
+		middleware.ScopeHandler(model.ScopeAdmin))
 	{
 		server.GET("/stats", c.GetServerStats)
 		server.GET("/procs", c.GetProcessStats)
 	}
 }
 
+// RegisterWellKnownRoutes registers the public discovery endpoints at the root.
+func RegisterWellKnownRoutes(r *gin.Engine, resourceHandle *handle.ResourceHandle) {
+	c := syscontroller.New(resourceHandle)
+	r.GET("/.well-known/jwks.json", c.GetJWKS)
+}
+
+func RegisterMetricsRoutes(r *gin.Engine, resourceHandle *handle.ResourceHandle) {
+	// scrape token or sys:stats permission
+	r.GET("/metrics",
+		metrics.ScrapeTokenHandler(resourceHandle.MetricsCfg.ScrapeToken),
+		middleware.AuthHandler(resourceHandle),
+		middleware.PermissionHandler(model.PermSysStats),
+		middleware.ScopeHandler(model.ScopeAdmin),
+		metrics.Handler(),
+	)
+}
+
 func RegisterUserRoutes(r *gin.RouterGroup, resourceHandle *handle.ResourceHandle) {
 	c := usercontroller.New(resourceHandle)
 
@@ -43,6 +63,38 @@ func RegisterUserRoutes(r *gin.RouterGroup, resourceHandle *handle.ResourceHandl
 	{
 		user.POST("/login", c.Login)
 		user.POST("/refresh-token", c.RefreshToken)
+		user.POST("/forgot-password", c.ForgotPassword)
+		user.POST("/reset-password", c.ResetPassword)
+	}
+
+	// login via the OIDC identity provider
+	if resourceHandle.SSO != nil {
+		oidc := user.Group("/oidc")
+		{
+			oidc.GET("/login", c.OIDCLogin)
+			oidc.GET("/callback", c.OIDCCallback)
+			if resourceHandle.SSO.ServiceLoginEnabled() {
+				oidc.POST("/token", c.OIDCServiceToken)
+			}
+		}
+	}
+
+	// logout ends the session of the access token
+	user.POST("/logout", middleware.AuthHandler(resourceHandle), c.Logout)
+
+	// own account
+	me := user.Group("/me")
+	me.Use(middleware.AuthHandler(resourceHandle), middleware.ScopeHandler(model.ScopeAccount))
+	{
+		me.GET("", c.GetMe)
+		me.PATCH("", c.UpdateMe)
+		me.POST("/password", c.ChangePassword)
+		me.GET("/api-keys", c.GetAPIKeys)
+		me.POST("/api-keys", c.CreateAPIKey)
+		me.DELETE("/api-keys/:prefix", c.RevokeAPIKey)
+		if resourceHandle.SSO != nil {
+			me.POST("/oidc/link", c.OIDCLink)
+		}
 	}
 }
 
@@ -50,22 +102,67 @@ func RegisterAdminRoutes(r *gin.RouterGroup, resourceHandle *handle.ResourceHand
 	c := admincontroller.New(resourceHandle)
 
 	admin := r.Group("/admin")
-	admin.Use(middleware.AuthHandler(&resourceHandle.AuthCfg), middleware.AdminAccessHandler())
+	admin.Use(middleware.AuthHandler(resourceHandle), middleware.ScopeHandler(model.ScopeAdmin))
+
+	// user endpoints, users without tenant:all manage the users of their organization
+	users := admin.Group("/users")
+	users.Use(middleware.PermissionHandler(model.PermUsersManage))
+	{
+		users.POST("/service", c.CreateServiceUser)
+		users.GET("", c.GetUsers)
+		users.GET("/:email", c.GetUserByEmail)
+		users.DELETE("/:email", c.DeleteUserByEmail)
+		users.PATCH("/:email", c.ChangeUserProfile)
+		users.POST("/:email/invite", c.ResendInvite)
+		users.DELETE("/:email/sessions", c.RevokeUserSessions)
+		users.GET("/:email/api-keys", c.GetAPIKeys)
+		users.POST("/:email/api-keys", c.CreateAPIKey)
+		users.DELETE("/:email/api-keys/:prefix", c.RevokeAPIKey)
+		users.GET("/:email/lockout", c.GetUserLockout)
+		users.DELETE("/:email/lockout", c.ClearUserLockout)
+	}
+
+	// role endpoints
+	roles := admin.Group("/roles")
+	roles.Use(middleware.PermissionHandler(model.PermRolesManage))
+	{
+		roles.GET("", c.GetRoles)
+		roles.POST("", c.CreateRole)
+		roles.GET("/:name", c.GetRole)
+		roles.PATCH("/:name", c.UpdateRole)
+		roles.DELETE("/:name", c.DeleteRole)
+	}
+
+	// organization endpoints
+	orgs := admin.Group("/organizations")
+	orgs.Use(middleware.PermissionHandler(model.PermOrgsManage))
+	{
+		orgs.GET("", c.GetOrganizations)
+		orgs.POST("", c.CreateOrganization)
+		orgs.GET("/:id", c.GetOrganization)
+		orgs.PATCH("/:id", c.UpdateOrganization)
+		orgs.DELETE("/:id", c.DeleteOrganization)
+	}
+
+	// audit log endpoints
+	admin.GET("/audit", middleware.PermissionHandler(model.PermAuditRead), c.GetAuditLogs)
+
+	// medinfo cache endpoints
+	medinfo := admin.Group("/medinfo")
+	medinfo.Use(middleware.PermissionHandler(model.PermMedInfoManage))
 	{
-		// user endpoints
-		admin.POST("/users/service", c.CreateServiceUser)
-		admin.GET("/users", c.GetUsers)
-		admin.GET("/users/:email", c.GetUserByEmail)
-		admin.DELETE("/users/:email", c.DeleteUserByEmail)
-		admin.PATCH("/users/:email", c.ChangeUserProfile)
+		medinfo.GET("/cache", c.GetMedInfoCache)
+		medinfo.DELETE("/cache", c.FlushMedInfoCache)
 	}
 }
 
 func RegisterDownloadRoutes(r *gin.RouterGroup, resourceHandle *handle.ResourceHandle) {
 	c := downloadcontroller.New(resourceHandle)
 
+	// users without tenant:all download the orders of their organization
 	download := r.Group("/download")
-	download.Use(middleware.AuthHandler(&resourceHandle.AuthCfg), middleware.AdminAccessHandler())
+	download.Use(middleware.AuthHandler(resourceHandle), middleware.PermissionHandler(model.PermPDFDownload),
+		middleware.ScopeHandler(model.ScopeAdmin))
 	{
 		// download endpoints
 		download.GET("/pdf/:order_id", c.DownloadPDF)
@@ -78,41 +175,72 @@ func RegisterOrderRoutes(r *gin.RouterGroup, resourceHandle *handle.ResourceHand
 	c := ordercontroller.New(resourceHandle)
 
 	order := r.Group("/orders")
-	order.Use(middleware.AuthHandler(&resourceHandle.AuthCfg), middleware.AdminAccessHandler())
+	order.Use(middleware.AuthHandler(resourceHandle), middleware.ScopeHandler(model.ScopeAdmin))
 	{
-		order.GET("/", c.GetOrders)
-		order.GET("/:order_id", c.GetOrderByID)
+		// users without tenant:all see the orders of their organization
+		order.GET("/", middleware.PermissionHandler(model.PermOrdersRead), c.GetOrders)
+		order.GET("/:order_id", middleware.PermissionHandler(model.PermOrdersRead), c.GetOrderByID)
+		order.GET("/:order_id/history", middleware.PermissionHandler(model.PermOrdersRead), c.GetOrderHistory)
 
-		order.PATCH("/send/failed", c.ResetFailedSends)
-		order.PATCH("/send/:order_id", c.ResendOrder)
+		requeue := middleware.PermissionHandler(model.PermOrdersRequeue)
+		order.PATCH("/send/failed", requeue, c.ResetFailedSends)
+		order.PATCH("/send/:order_id", requeue, c.ResendOrder)
 
 		// reset endpoints
-		order.PATCH("/requeue/errors", c.RequeueErrorOrders)
-		order.PATCH("/requeue/:order_id", c.RequeueOrderByID)
+		order.PATCH("/requeue/errors", requeue, c.RequeueErrorOrders)
+		order.PATCH("/requeue/:order_id", requeue, c.RequeueOrderByID)
 
 		// delete endpoints
-		order.DELETE("/delete/:order_id", c.DeleteOrderByID)
+		order.DELETE("/delete/:order_id", middleware.PermissionHandler(model.PermOrdersDelete), c.DeleteOrderByID)
 	}
 }
 
 func RegisterDSSRoutes(r *gin.RouterGroup, resourceHandle *handle.ResourceHandle) {
 	c := dsscontroller.New(resourceHandle)
 
+	batchBodySize := resourceHandle.ServerCfg.MaxBatchBodySize
+	if batchBodySize == 0 {
+		batchBodySize = resourceHandle.ServerCfg.MaxBodySize
+	}
+
 	dss := r.Group("/dose")
-	dss.Use(middleware.AuthHandler(&resourceHandle.AuthCfg))
+	dss.Use(middleware.AuthHandler(resourceHandle), middleware.ScopeHandler(model.ScopeDose))
 	{
 		dss.POST("/precheck/", c.PostPrecheck)
 		dss.POST("/adjust/", c.PostAdjust)
+		dss.POST("/batches",
+			middleware.BodySizeHandler(int64(batchBodySize)), c.PostAdjustBatch)
+		dss.GET("/batches/:batch_id", c.GetBatch)
 		dss.GET("/precheck/schema", c.GetSchema)
 		dss.GET("/adjust/schema", c.GetSchema)
 	}
 }
 
+func RegisterUserOrderRoutes(r *gin.RouterGroup, resourceHandle *handle.ResourceHandle) {
+	oc := ordercontroller.New(resourceHandle)
+	dc := downloadcontroller.New(resourceHandle)
+
+	// orders are scoped to the calling user
+	orders := r.Group("/dose/orders")
+	orders.Use(middleware.AuthHandler(resourceHandle), middleware.ScopeHandler(model.ScopeOrdersRead))
+	{
+		orders.GET("", oc.GetUserOrders)
+		orders.GET("/:order_id", oc.GetUserOrderByID)
+		orders.GET("/:order_id/pdf", dc.DownloadUserPDF)
+		orders.GET("/:order_id/precheck", dc.DownloadUserPrecheck)
+	}
+
+	// cancelling withdraws a submission, so it needs the submit scope
+	r.POST("/dose/orders/:order_id/cancel",
+		middleware.AuthHandler(resourceHandle), middleware.ScopeHandler(model.ScopeDose), oc.CancelUserOrder)
+}
+
 func RegisterModelRoutes(r *gin.RouterGroup, resourceHandle *handle.ResourceHandle) {
 	c := modelcontroller.New(resourceHandle.Prechecker.PBPKModels.Definitions)
 
 	models := r.Group("/models")
-	models.Use(middleware.AuthHandler(&resourceHandle.AuthCfg))
+	models.Use(middleware.AuthHandler(resourceHandle), middleware.PermissionHandler(model.PermModelsRead),
+		middleware.ScopeHandler(model.ScopeModelsRead))
 	{
 		models.GET("/", c.GetModels)
 	}
@@ -122,7 +250,7 @@ func RegisterTestRoutes(r *gin.RouterGroup, resourceHandle *handle.ResourceHandl
 	c := testcontroller.New()
 
 	test := r.Group("/test")
-	test.Use(middleware.AuthHandler(&resourceHandle.AuthCfg))
+	test.Use(middleware.AuthHandler(resourceHandle))
 	{
 		test.POST("/acceptresult/:orderId", c.AcceptResult)
 	}
@@ -7,16 +7,23 @@ import (
 	"os"
 	"os/signal"
 	"precisiondosing-api-go/cfg"
+	"precisiondosing-api-go/internal/blobstore"
 	"precisiondosing-api-go/internal/database"
 	"precisiondosing-api-go/internal/handle"
+	"precisiondosing-api-go/internal/jobs/cleaner"
 	"precisiondosing-api-go/internal/jobs/jobrunner"
 	"precisiondosing-api-go/internal/jobs/jobsender"
+	"precisiondosing-api-go/internal/jobs/webhooksender"
+	"precisiondosing-api-go/internal/metrics"
 	"precisiondosing-api-go/internal/middleware"
 	"precisiondosing-api-go/internal/pbpk"
 	"precisiondosing-api-go/internal/precheck"
 	"precisiondosing-api-go/internal/services/individualdb"
+	"precisiondosing-api-go/internal/services/mailer"
 	"precisiondosing-api-go/internal/services/medinfo"
+	"precisiondosing-api-go/internal/sso"
 	"precisiondosing-api-go/internal/utils/callr"
+	"precisiondosing-api-go/internal/utils/tokens"
 	"precisiondosing-api-go/internal/utils/validate"
 	"runtime"
 	"strings"
@@ -29,11 +36,13 @@ import (
 )
 
 type Server struct {
-	engine       *gin.Engine
-	serverConfig cfg.ServerConfig
-	jobRunner    *jobrunner.JobRunner
-	jobSender    *jobsender.JobSender
-	logger       log.Logger
+	engine        *gin.Engine
+	serverConfig  cfg.ServerConfig
+	jobRunner     *jobrunner.JobRunner
+	jobSender     *jobsender.JobSender
+	webhookSender *webhooksender.WebhookSender
+	cleaner       *cleaner.Cleaner
+	logger        log.Logger
 }
 
 func New(config *cfg.APIConfig, debug bool) (*Server, error) {
@@ -52,6 +61,9 @@ func New(config *cfg.APIConfig, debug bool) (*Server, error) {
 
 	// middleware
 	router.Use(gin.CustomRecovery(middleware.RecoveryHandler))
+	if config.Metrics.Enabled {
+		router.Use(metrics.HTTPHandler())
+	}
 	if debug {
 		router.Use(gin.Logger())
 	}
@@ -70,19 +82,33 @@ func New(config *cfg.APIConfig, debug bool) (*Server, error) {
 		config.JobRunner,
 		resourceHandle.Prechecker,
 		resourceHandle.CallR,
+		resourceHandle.BlobStore,
 		resourceHandle.Databases.GormDB,
 	)
 
+	if config.Metrics.Enabled {
+		metrics.RegisterQueueDepth(jobRunner.QueueDepth)
+		metrics.RegisterOrderCollector(resourceHandle.Databases.GormDB)
+	}
+
 	// init job sender
-	jobSender := jobsender.New(config.MMCAPI, resourceHandle.Databases.GormDB)
+	jobSender := jobsender.New(config.MMCAPI, resourceHandle.BlobStore, resourceHandle.Databases.GormDB)
+
+	// init webhook sender
+	webhookSender := webhooksender.New(config.Webhook, resourceHandle.Databases.GormDB)
+
+	// init cleanup of expired records
+	cleanupJob := cleaner.New(config.Cleanup, resourceHandle.Databases.GormDB)
 
 	// server
 	srv := &Server{
-		engine:       router,
-		serverConfig: config.Server,
-		jobRunner:    jobRunner,
-		jobSender:    jobSender,
-		logger:       log.WithComponent("server"),
+		engine:        router,
+		serverConfig:  config.Server,
+		jobRunner:     jobRunner,
+		jobSender:     jobSender,
+		webhookSender: webhookSender,
+		cleaner:       cleanupJob,
+		logger:        log.WithComponent("server"),
 	}
 
 	return srv, nil
@@ -99,6 +125,8 @@ func (s *Server) Run() {
 
 	s.jobRunner.Start()
 	s.jobSender.Start()
+	s.webhookSender.Start()
+	s.cleaner.Start()
 
 	// Graceful shutdown for the server
 	quit := make(chan os.Signal, 1)
@@ -113,6 +141,8 @@ func (s *Server) Run() {
 
 	s.jobRunner.Stop()
 	s.jobSender.Stop()
+	s.webhookSender.Stop()
+	s.cleaner.Stop()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -158,7 +188,32 @@ func initHandler(config *cfg.APIConfig, debug bool) (*handle.ResourceHandle, err
 		debug,
 	)
 
-	resourceHandle := handle.NewResourceHandle(config, databases, prechecker, callR, jsonValidators, debug)
+	// init blob store
+	blobStore, err := blobstore.New(config.BlobStore)
+	if err != nil {
+		return nil, fmt.Errorf("error initializing blob store: %w", err)
+	}
+
+	// init mailer
+	mailSender, err := mailer.New(config.Mail)
+	if err != nil {
+		return nil, fmt.Errorf("error initializing mailer: %w", err)
+	}
+
+	// init OIDC login
+	ssoProvider, err := sso.New(config.OIDC, databases.GormDB)
+	if err != nil {
+		return nil, fmt.Errorf("error initializing OIDC login: %w", err)
+	}
+
+	// load JWT signing keys
+	if err = tokens.InitKeys(&config.AuthToken); err != nil {
+		return nil, fmt.Errorf("error loading JWT signing keys: %w", err)
+	}
+
+	resourceHandle := handle.NewResourceHandle(
+		config, databases, prechecker, callR, blobStore, mailSender, ssoProvider, jsonValidators, debug,
+	)
 	return resourceHandle, nil
 }
 
@@ -167,12 +222,17 @@ func registerRoutes(r *gin.Engine, resourceHandle *handle.ResourceHandle) {
 	api.Use(middleware.MaxBodySizeHandler(int64(resourceHandle.ServerCfg.MaxBodySize)))
 
 	RegistgerSwaggerRoutes(r, api, resourceHandle)
+	if resourceHandle.MetricsCfg.Enabled {
+		RegisterMetricsRoutes(r, resourceHandle)
+	}
+	RegisterWellKnownRoutes(r, resourceHandle)
 	RegisterSysRoutes(api, resourceHandle)
 	RegisterUserRoutes(api, resourceHandle)
 	RegisterAdminRoutes(api, resourceHandle)
 	RegisterDownloadRoutes(api, resourceHandle)
 	RegisterOrderRoutes(api, resourceHandle)
 	RegisterDSSRoutes(api, resourceHandle)
+	RegisterUserOrderRoutes(api, resourceHandle)
 	RegisterModelRoutes(api, resourceHandle)
 	if resourceHandle.DebugMode {
 		RegisterTestRoutes(api, resourceHandle)
@@ -186,6 +246,34 @@ func parseTrustedProxies(proxies string) []string {
 	return strings.Split(proxies, ",")
 }
 
+// MigrateBlobs moves the result PDFs still stored in the database into the
+// blob store and returns. Used once after switching to the blob store.
+func MigrateBlobs(config *cfg.APIConfig, debug bool) error {
+	const batchSize = 50
+
+	db, err := database.New(config.Database, config.Log, debug)
+	if err != nil {
+		return fmt.Errorf("cannot create SQL database: %w", err)
+	}
+
+	if err = database.Migrate(db); err != nil {
+		return fmt.Errorf("cannot migrate SQL database: %w", err)
+	}
+
+	blobStore, err := blobstore.New(config.BlobStore)
+	if err != nil {
+		return fmt.Errorf("error initializing blob store: %w", err)
+	}
+
+	migrated, err := blobstore.MigrateOrders(context.Background(), blobStore, db, batchSize)
+	if err != nil {
+		return fmt.Errorf("cannot migrate PDFs: %w", err)
+	}
+
+	log.WithComponent("server").Info("migrated PDFs to blob store", log.Int("count", migrated))
+	return nil
+}
+
 func initDatabases(config *cfg.APIConfig, debug bool) (handle.Databases, error) {
 	dbs := handle.Databases{}
 	// init dbs
@@ -216,7 +304,8 @@ func initPrechecker(config *cfg.APIConfig, mongo *individualdb.IndividualDB) (*p
 
 	// init Abdata
 	aCfg := config.MedInfoAPI
-	medinfoAPI := medinfo.NewAPI(aCfg.URL, aCfg.Login, aCfg.Password, aCfg.ExpiryThreshold)
+	medinfoAPI := medinfo.NewAPI(aCfg.URL, aCfg.Login, aCfg.Password, aCfg.ExpiryThreshold,
+		medinfo.CacheConfig{Size: aCfg.CacheSize, TTL: aCfg.CacheTTL, StaleTTL: aCfg.StaleTTL})
 	if err := medinfoAPI.Refresh(); err != nil {
 		return nil, fmt.Errorf("cannot login to MedInfo: %w", err)
 	}
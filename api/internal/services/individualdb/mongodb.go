@@ -6,20 +6,58 @@ import (
 	"errors"
 	"fmt"
 	"precisiondosing-api-go/cfg"
+	"precisiondosing-api-go/internal/metrics"
 	"strings"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+const (
+	MatchExact   = "exact"
+	MatchNearest = "nearest"
+
+	SexAny = "any"
+
+	bmiHeightScale = 100.0 // cm -> m
+)
+
 type IndividualDB struct {
 	Client     *mongo.Client
 	Database   string
 	Collection string
+	Matching   cfg.MatchingConfig
+}
+
+// Match describes the virtual individual used for a patient and how far it deviates
+// from the patient's demographics (individual - patient).
+type Match struct {
+	ID        string          `json:"id"`
+	Mode      string          `json:"mode"`
+	Sex       string          `json:"sex"`
+	Age       int             `json:"age"`
+	Height    int             `json:"height"`
+	Weight    float64         `json:"weight"`
+	Deviation Deviation       `json:"deviation"`
+	Distance  float64         `json:"distance"`
+	Payload   json.RawMessage `json:"-"`
+}
+
+type Deviation struct {
+	Age    int     `json:"age"`
+	Height int     `json:"height"`
+	Weight float64 `json:"weight"`
+	BMI    float64 `json:"bmi"`
 }
 
 func New(dbConfig cfg.IndividualDBConfig) (*IndividualDB, error) {
+	if err := validateMatching(dbConfig.Matching); err != nil {
+		return nil, err
+	}
+
 	clientOptions := options.Client().ApplyURI(dbConfig.URI)
 	clientOptions.SetMaxPoolSize(dbConfig.MaxPoolSize)
 	clientOptions.SetMinPoolSize(dbConfig.MinPoolSize)
@@ -47,34 +85,66 @@ func New(dbConfig cfg.IndividualDBConfig) (*IndividualDB, error) {
 		Client:     client,
 		Database:   dbConfig.Database,
 		Collection: dbConfig.Collection,
+		Matching:   dbConfig.Matching,
 	}
 
 	return result, nil
 }
 
-// FetchIndividual fetches an individual from the database.
-// If no individual is found, nil is returned.
+func validateMatching(config cfg.MatchingConfig) error {
+	if config.Mode != MatchExact && config.Mode != MatchNearest {
+		return fmt.Errorf("unknown individual matching mode %q", config.Mode)
+	}
+
+	switch config.UnknownSex {
+	case "female", "male", SexAny:
+	default:
+		return fmt.Errorf("unknown strategy %q for unknown sex", config.UnknownSex)
+	}
+
+	if config.AgeTolerance < 0 || config.HeightTolerance < 0 || config.WeightTolerance < 0 {
+		return errors.New("individual matching tolerances must not be negative")
+	}
+
+	return nil
+}
+
+// FetchIndividual fetches the virtual individual for the demographics of a patient.
+// Depending on the matching mode, the individual must match exactly or is the closest
+// within the configured tolerances. If no individual is found, nil is returned.
 func (m *IndividualDB) FetchIndividual(
 	population *string,
 	gender string, age, height, weight int,
-) (json.RawMessage, error) {
+) (*Match, error) {
 	eth, err := mapEthnicity(population)
 	if err != nil {
 		return nil, fmt.Errorf("error mapping ethnicity: %w", err)
 	}
 
-	gender = strings.ToUpper(gender)
-	query := bson.D{
-		{Key: "population", Value: eth},
-		{Key: "age", Value: age},
-		{Key: "weight", Value: weight},
-		{Key: "height", Value: height},
-		{Key: "gender", Value: gender},
-	}
-
+	genders := m.mapGender(gender)
 	collection := m.Client.Database(m.Database).Collection(m.Collection)
+
 	var result bson.M
-	err = collection.FindOne(context.TODO(), query).Decode(&result)
+	start := time.Now()
+	if m.Matching.Mode == MatchExact {
+		query := bson.D{
+			{Key: "population", Value: eth},
+			{Key: "age", Value: age},
+			{Key: "weight", Value: weight},
+			{Key: "height", Value: height},
+			{Key: "gender", Value: bson.M{"$in": genders}},
+		}
+
+		err = collection.FindOne(context.TODO(), query).Decode(&result)
+	} else {
+		err = m.findNearest(collection, eth, genders, age, height, weight, &result)
+	}
+
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		metrics.ObserveExternal(metrics.ServiceMongo, "fetch_individual", start, nil)
+		return nil, nil
+	}
+	metrics.ObserveExternal(metrics.ServiceMongo, "fetch_individual", start, err)
 	if err != nil {
 		return nil, fmt.Errorf("error querying individual: %w", err)
 	}
@@ -83,6 +153,116 @@ func (m *IndividualDB) FetchIndividual(
 		return nil, nil
 	}
 
+	payload, err := individualPayload(result)
+	if err != nil {
+		return nil, err
+	}
+
+	match := &Match{
+		ID:      fmt.Sprint(result["_id"]),
+		Mode:    m.Matching.Mode,
+		Sex:     fmt.Sprint(result["gender"]),
+		Age:     int(number(result["age"])),
+		Height:  int(number(result["height"])),
+		Weight:  number(result["weight"]),
+		Payload: payload,
+	}
+	if id, ok := result["_id"].(primitive.ObjectID); ok {
+		match.ID = id.Hex()
+	}
+	if distance, ok := result["_distance"]; ok {
+		match.Distance = number(distance)
+	}
+
+	match.Deviation = Deviation{
+		Age:    match.Age - age,
+		Height: match.Height - height,
+		Weight: match.Weight - float64(weight),
+		BMI:    bmi(match.Weight, float64(match.Height)) - bmi(float64(weight), float64(height)),
+	}
+
+	return match, nil
+}
+
+// findNearest searches the individual with the smallest weighted distance within the
+// tolerances. Each deviation is scaled by its tolerance. The BMI deviation is scaled by
+// the BMI change of the weight tolerance, so individuals with a similar build are preferred.
+func (m *IndividualDB) findNearest(
+	collection *mongo.Collection,
+	population string, genders []string,
+	age, height, weight int,
+	result *bson.M,
+) error {
+	config := m.Matching
+	within := func(value, tolerance int) bson.M {
+		return bson.M{"$gte": value - tolerance, "$lte": value + tolerance}
+	}
+
+	filter := bson.D{
+		{Key: "population", Value: population},
+		{Key: "gender", Value: bson.M{"$in": genders}},
+		{Key: "age", Value: within(age, config.AgeTolerance)},
+		{Key: "height", Value: within(height, config.HeightTolerance)},
+		{Key: "weight", Value: within(weight, config.WeightTolerance)},
+	}
+
+	term := func(expr interface{}, target, scale, weight float64) bson.M {
+		deviation := bson.M{"$divide": bson.A{bson.M{"$subtract": bson.A{expr, target}}, scale}}
+		return bson.M{"$multiply": bson.A{weight, bson.M{"$pow": bson.A{deviation, 2}}}}
+	}
+
+	heightM := float64(height) / bmiHeightScale
+	bmiExpr := bson.M{"$divide": bson.A{
+		"$weight",
+		bson.M{"$pow": bson.A{bson.M{"$divide": bson.A{"$height", bmiHeightScale}}, 2}},
+	}}
+	weightScale := float64(max(config.WeightTolerance, 1))
+
+	distance := bson.M{"$add": bson.A{
+		term("$age", float64(age), float64(max(config.AgeTolerance, 1)), config.AgeWeight),
+		term("$height", float64(height), float64(max(config.HeightTolerance, 1)), config.HeightWeight),
+		term("$weight", float64(weight), weightScale, config.WeightWeight),
+		term(bmiExpr, bmi(float64(weight), float64(height)), weightScale/(heightM*heightM), config.BMIWeight),
+	}}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$addFields", Value: bson.M{"_distance": distance}}},
+		{{Key: "$sort", Value: bson.D{{Key: "_distance", Value: 1}, {Key: "_id", Value: 1}}}},
+		{{Key: "$limit", Value: 1}},
+	}
+
+	cursor, err := collection.Aggregate(context.TODO(), pipeline)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(context.TODO())
+
+	if !cursor.Next(context.TODO()) {
+		if err = cursor.Err(); err != nil {
+			return err
+		}
+		return mongo.ErrNoDocuments
+	}
+
+	return cursor.Decode(result)
+}
+
+// mapGender maps the sex of the patient to the genders of the individuals.
+// Unknown sex is handled by the configured strategy.
+func (m *IndividualDB) mapGender(sex string) []string {
+	sex = strings.ToLower(strings.TrimSpace(sex))
+	if sex != "female" && sex != "male" {
+		sex = m.Matching.UnknownSex
+	}
+
+	if sex == SexAny {
+		return []string{"FEMALE", "MALE"}
+	}
+	return []string{strings.ToUpper(sex)}
+}
+
+func individualPayload(result bson.M) (json.RawMessage, error) {
 	payload, ok := result["json"]
 	if !ok {
 		return nil, errors.New("error: 'json' key not found in result")
@@ -102,6 +282,26 @@ func (m *IndividualDB) FetchIndividual(
 	}
 }
 
+func bmi(weight, height float64) float64 {
+	heightM := height / bmiHeightScale
+	return weight / (heightM * heightM)
+}
+
+func number(v interface{}) float64 {
+	switch n := v.(type) {
+	case int32:
+		return float64(n)
+	case int64:
+		return float64(n)
+	case float64:
+		return n
+	case int:
+		return float64(n)
+	default:
+		return 0
+	}
+}
+
 func mapEthnicity(ethnicity *string) (string, error) {
 	// Default value if ethnicity is nil
 	defaultPopulation := "European_ICRP_2002"
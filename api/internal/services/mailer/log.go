@@ -0,0 +1,25 @@
+package mailer
+
+import (
+	"context"
+	"precisiondosing-api-go/internal/utils/log"
+)
+
+// Log only writes the mails to the log, e.g. for development.
+// Note that the log contains the links with the tokens.
+type Log struct {
+	logger log.Logger
+}
+
+func NewLog() *Log {
+	return &Log{logger: log.WithComponent("mailer")}
+}
+
+func (l *Log) Send(_ context.Context, msg *Message) error {
+	l.logger.Info("mail",
+		log.Str("to", msg.To),
+		log.Str("subject", msg.Subject),
+		log.Str("body", msg.Body),
+	)
+	return nil
+}
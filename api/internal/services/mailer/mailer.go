@@ -0,0 +1,33 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"precisiondosing-api-go/cfg"
+)
+
+const (
+	BackendLog  = "log"
+	BackendSMTP = "smtp"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string // plain text
+}
+
+type Mailer interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+func New(config cfg.MailConfig) (Mailer, error) {
+	switch config.Backend {
+	case BackendLog:
+		return NewLog(), nil
+	case BackendSMTP:
+		return NewSMTP(config), nil
+	default:
+		return nil, fmt.Errorf("unknown mail backend %q", config.Backend)
+	}
+}
@@ -0,0 +1,129 @@
+package mailer
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"precisiondosing-api-go/cfg"
+	"precisiondosing-api-go/internal/utils/log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sendTimeout bounds a delivery if the context has no deadline.
+const sendTimeout = time.Minute
+
+// SMTP sends mails via a SMTP server. STARTTLS is used if the server supports it,
+// credentials are only sent over TLS.
+type SMTP struct {
+	addr   string
+	host   string
+	from   string
+	auth   smtp.Auth
+	logger log.Logger
+}
+
+func NewSMTP(config cfg.MailConfig) *SMTP {
+	s := &SMTP{
+		addr:   net.JoinHostPort(config.Host, strconv.Itoa(config.Port)),
+		host:   config.Host,
+		from:   config.From,
+		logger: log.WithComponent("mailer"),
+	}
+
+	if config.Username != "" {
+		s.auth = smtp.PlainAuth("", config.Username, config.Password, config.Host)
+	}
+
+	return s
+}
+
+func (s *SMTP) Send(ctx context.Context, msg *Message) error {
+	header := []string{
+		"From: " + s.from,
+		"To: " + msg.To,
+		"Subject: " + msg.Subject,
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+	}
+
+	body := strings.Join(header, "\r\n") + "\r\n\r\n" +
+		strings.ReplaceAll(msg.Body, "\n", "\r\n")
+
+	if err := s.send(ctx, msg.To, []byte(body)); err != nil {
+		return fmt.Errorf("cannot send mail: %w", err)
+	}
+
+	s.logger.Info("mail sent", log.Str("to", msg.To), log.Str("subject", msg.Subject))
+	return nil
+}
+
+// send delivers the mail like smtp.SendMail, but the connection is bound to the
+// context: its deadline applies to the whole conversation and cancelling closes it.
+func (s *SMTP) send(ctx context.Context, to string, body []byte) error {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, sendTimeout)
+		defer cancel()
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	deadline, _ := ctx.Deadline()
+	if err = conn.SetDeadline(deadline); err != nil {
+		conn.Close()
+		return err
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	client, err := smtp.NewClient(conn, s.host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err = client.StartTLS(&tls.Config{ServerName: s.host, MinVersion: tls.VersionTLS12}); err != nil {
+			return err
+		}
+	}
+
+	if s.auth != nil {
+		if ok, _ := client.Extension("AUTH"); !ok {
+			return errors.New("server does not support AUTH")
+		}
+		if err = client.Auth(s.auth); err != nil {
+			return err
+		}
+	}
+
+	if err = client.Mail(s.from); err != nil {
+		return err
+	}
+	if err = client.Rcpt(to); err != nil {
+		return err
+	}
+
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = writer.Write(body); err != nil {
+		return err
+	}
+	if err = writer.Close(); err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
@@ -0,0 +1,34 @@
+package mailer
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// ResetMail builds the mail with the password reset link.
+func ResetMail(to, resetURL, token string, validFor time.Duration) *Message {
+	return &Message{
+		To:      to,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("A password reset was requested for your account.\n\n"+
+			"Set a new password here (valid for %s):\n%s\n\n"+
+			"If you did not request the reset, you can ignore this mail.\n",
+			validFor, tokenLink(resetURL, token)),
+	}
+}
+
+// InviteMail builds the mail with the account setup link of an invited user.
+func InviteMail(to, resetURL, token string, validFor time.Duration) *Message {
+	return &Message{
+		To:      to,
+		Subject: "Your account was created",
+		Body: fmt.Sprintf("An account was created for you.\n\n"+
+			"Choose your password here (valid for %s):\n%s\n",
+			validFor, tokenLink(resetURL, token)),
+	}
+}
+
+func tokenLink(baseURL, token string) string {
+	return baseURL + "?token=" + url.QueryEscape(token)
+}
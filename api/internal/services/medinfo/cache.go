@@ -0,0 +1,141 @@
+package medinfo
+
+import (
+	"container/list"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+type CacheConfig struct {
+	Size     int           // max. number of entries, 0 disables the cache
+	TTL      time.Duration // entries are fresh for TTL
+	StaleTTL time.Duration // expired entries are served for StaleTTL if MedInfo fails
+}
+
+type CacheStats struct {
+	Entries   int    `json:"entries"`
+	Size      int    `json:"size"`
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+	StaleHits uint64 `json:"stale_hits"`
+	Evictions uint64 `json:"evictions"`
+}
+
+type cacheEntry[T any] struct {
+	key      string
+	value    T
+	storedAt time.Time
+}
+
+// Cache is a LRU cache with expiring entries. Cached values are shared and must not be modified.
+type Cache[T any] struct {
+	config  CacheConfig
+	mutex   sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+	stats   CacheStats
+}
+
+func NewCache[T any](config CacheConfig) *Cache[T] {
+	return &Cache[T]{
+		config:  config,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// cacheKey builds the key of a compound set independent of order and case.
+func cacheKey(compounds []string) string {
+	keys := make([]string, len(compounds))
+	for i, c := range compounds {
+		keys[i] = strings.ToLower(strings.TrimSpace(c))
+	}
+	slices.Sort(keys)
+	return strings.Join(slices.Compact(keys), ",")
+}
+
+// Get returns a fresh entry and counts the hit or miss.
+func (c *Cache[T]) Get(key string) (T, bool) {
+	var zero T
+	if c.config.Size <= 0 {
+		return zero, false
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok || time.Since(elem.Value.(*cacheEntry[T]).storedAt) > c.config.TTL {
+		c.stats.Misses++
+		return zero, false
+	}
+
+	c.stats.Hits++
+	c.lru.MoveToFront(elem)
+	return elem.Value.(*cacheEntry[T]).value, true
+}
+
+// GetStale returns an expired entry within the stale period.
+// Used when MedInfo cannot be reached.
+func (c *Cache[T]) GetStale(key string) (T, bool) {
+	var zero T
+	if c.config.Size <= 0 {
+		return zero, false
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok || time.Since(elem.Value.(*cacheEntry[T]).storedAt) > c.config.TTL+c.config.StaleTTL {
+		return zero, false
+	}
+
+	c.stats.StaleHits++
+	return elem.Value.(*cacheEntry[T]).value, true
+}
+
+func (c *Cache[T]) Set(key string, value T) {
+	if c.config.Size <= 0 {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		entry := elem.Value.(*cacheEntry[T])
+		entry.value = value
+		entry.storedAt = time.Now()
+		c.lru.MoveToFront(elem)
+		return
+	}
+
+	c.entries[key] = c.lru.PushFront(&cacheEntry[T]{key: key, value: value, storedAt: time.Now()})
+	for c.lru.Len() > c.config.Size {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry[T]).key)
+		c.stats.Evictions++
+	}
+}
+
+func (c *Cache[T]) Flush() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.entries = make(map[string]*list.Element)
+	c.lru.Init()
+}
+
+func (c *Cache[T]) Stats() CacheStats {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	stats := c.stats
+	stats.Entries = c.lru.Len()
+	stats.Size = c.config.Size
+	return stats
+}
@@ -6,7 +6,9 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"precisiondosing-api-go/internal/metrics"
 	"strings"
+	"time"
 )
 
 type CompoundDose struct {
@@ -149,7 +151,13 @@ func extractJSendResponse[T any](body []byte) (*T, error) {
 	return &response.Data, nil
 }
 
+// GetCommpoundInteractions returns the interactions between the compounds.
+// Results are cached; if MedInfo fails, an expired result is served within the stale period.
 func (a *API) GetCommpoundInteractions(compounds []string) ([]CompoundInteraction, *Error) {
+	return cached(a.interactionCache, "interactions", compounds, a.fetchCompoundInteractions)
+}
+
+func (a *API) fetchCompoundInteractions(compounds []string) ([]CompoundInteraction, *Error) {
 	if !a.AccessValid() {
 		err := a.Refresh()
 		if err != nil {
@@ -193,7 +201,13 @@ type CompoundMatch struct {
 	Matches [][]CompoundResponse `json:"matches"`
 }
 
+// GetCommpoundSynonyms returns the synonyms of the compounds.
+// Results are cached like GetCommpoundInteractions.
 func (a *API) GetCommpoundSynonyms(compounds []string) ([]CompoundMatch, *Error) {
+	return cached(a.synonymCache, "synonyms", compounds, a.fetchCompoundSynonyms)
+}
+
+func (a *API) fetchCompoundSynonyms(compounds []string) ([]CompoundMatch, *Error) {
 	if !a.AccessValid() {
 		err := a.Refresh()
 		if err != nil {
@@ -240,3 +254,52 @@ func (a *API) GetCommpoundSynonyms(compounds []string) ([]CompoundMatch, *Error)
 
 	return d, nil
 }
+
+func cached[T any](
+	cache *Cache[T],
+	operation string,
+	compounds []string,
+	fetch func([]string) (T, *Error),
+) (T, *Error) {
+	key := cacheKey(compounds)
+	if value, ok := cache.Get(key); ok {
+		return value, nil
+	}
+
+	start := time.Now()
+	value, err := fetch(compounds)
+	var outage error // input errors are not counted as errors of MedInfo
+	if err != nil && !err.InputError {
+		outage = err
+	}
+	metrics.ObserveExternal(metrics.ServiceMedInfo, operation, start, outage)
+
+	if err != nil {
+		if outage != nil {
+			if stale, ok := cache.GetStale(key); ok {
+				return stale, nil
+			}
+		}
+		return value, err
+	}
+
+	cache.Set(key, value)
+	return value, nil
+}
+
+type CacheStatistics struct {
+	Synonyms     CacheStats `json:"synonyms"`
+	Interactions CacheStats `json:"interactions"`
+}
+
+func (a *API) CacheStats() CacheStatistics {
+	return CacheStatistics{
+		Synonyms:     a.synonymCache.Stats(),
+		Interactions: a.interactionCache.Stats(),
+	}
+}
+
+func (a *API) FlushCache() {
+	a.synonymCache.Flush()
+	a.interactionCache.Flush()
+}
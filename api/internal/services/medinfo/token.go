@@ -22,14 +22,19 @@ type API struct {
 	password        string        `json:"-"`
 	expiryThreshold time.Duration `json:"-"`
 	mutex           sync.Mutex    `json:"-"`
+
+	synonymCache     *Cache[[]CompoundMatch]       `json:"-"`
+	interactionCache *Cache[[]CompoundInteraction] `json:"-"`
 }
 
-func NewAPI(baseURL, login, password string, expiryThreshold time.Duration) *API {
+func NewAPI(baseURL, login, password string, expiryThreshold time.Duration, cacheConfig CacheConfig) *API {
 	return &API{
-		baseURL:         baseURL,
-		login:           login,
-		password:        password,
-		expiryThreshold: expiryThreshold,
+		baseURL:          baseURL,
+		login:            login,
+		password:         password,
+		expiryThreshold:  expiryThreshold,
+		synonymCache:     NewCache[[]CompoundMatch](cacheConfig),
+		interactionCache: NewCache[[]CompoundInteraction](cacheConfig),
 	}
 }
 
@@ -0,0 +1,204 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"precisiondosing-api-go/internal/model"
+	"precisiondosing-api-go/internal/utils/log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Revoke reasons
+const (
+	ReasonLogout       = "logout"
+	ReasonRefreshReuse = "refresh token reuse"
+	ReasonAdmin        = "revoked by admin"
+	ReasonUserDeleted  = "user deleted"
+	ReasonUserInactive = "user deactivated"
+	ReasonPasswordSet  = "password changed"
+	ReasonRoleChanged  = "role changed by identity provider"
+)
+
+// cached revocation states are pruned when the cache grows beyond this size
+const maxCacheEntries = 10000
+
+var (
+	ErrRevoked = errors.New("session revoked")
+	ErrReused  = errors.New("refresh token reused")
+)
+
+type cacheEntry struct {
+	revoked   bool
+	checkedAt time.Time
+}
+
+// Store keeps the sessions (token families) in the database. The revocation state
+// used for every authenticated request is cached for cacheTTL, which is the delay
+// until revocations by other instances apply. Revocations by this instance apply
+// immediately.
+type Store struct {
+	db       *gorm.DB
+	cacheTTL time.Duration
+	mutex    sync.Mutex
+	cache    map[string]cacheEntry
+	logger   log.Logger
+}
+
+func New(db *gorm.DB, cacheTTL time.Duration) *Store {
+	return &Store{
+		db:       db,
+		cacheTTL: cacheTTL,
+		cache:    make(map[string]cacheEntry),
+		logger:   log.WithComponent("session"),
+	}
+}
+
+// NewFamilyID returns the ID of a new session.
+func NewFamilyID() string {
+	return uuid.New().String()
+}
+
+// Start stores a new session after login. Expired sessions of the user are removed.
+func (s *Store) Start(ctx context.Context, familyID string, userID uint, refreshJTI string, expiresAt time.Time) error {
+	db := s.db.WithContext(ctx)
+	if err := db.Where("user_id = ? AND expires_at < ?", userID, time.Now()).
+		Delete(&model.Session{}).Error; err != nil {
+		s.logger.Warn("removing expired sessions", log.Err(err))
+	}
+
+	if err := db.Create(&model.Session{
+		FamilyID:          familyID,
+		UserID:            userID,
+		CurrentRefreshJTI: refreshJTI,
+		ExpiresAt:         expiresAt,
+	}).Error; err != nil {
+		return fmt.Errorf("cannot store session: %w", err)
+	}
+
+	return nil
+}
+
+// Rotate replaces the refresh token of a session. Presenting an outdated refresh token
+// revokes the session and returns ErrReused.
+func (s *Store) Rotate(ctx context.Context, familyID, oldJTI, newJTI string, expiresAt time.Time) error {
+	db := s.db.WithContext(ctx)
+
+	// conditional update, concurrent refreshes with the same token cannot both succeed
+	res := db.Model(&model.Session{}).
+		Where("family_id = ? AND current_refresh_jti = ? AND revoked_at IS NULL", familyID, oldJTI).
+		Updates(map[string]interface{}{
+			"current_refresh_jti": newJTI,
+			"expires_at":          expiresAt,
+		})
+	if res.Error != nil {
+		return fmt.Errorf("cannot rotate session: %w", res.Error)
+	}
+	if res.RowsAffected == 1 {
+		return nil
+	}
+
+	var session model.Session
+	if err := db.Where(&model.Session{FamilyID: familyID}).First(&session).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrRevoked
+		}
+		return err
+	}
+
+	if session.RevokedAt != nil {
+		return ErrRevoked
+	}
+
+	s.logger.Warn("refresh token reuse, revoking session",
+		log.Str("familyID", familyID), log.Int("userID", int(session.UserID)))
+	if err := s.Revoke(ctx, familyID, ReasonRefreshReuse); err != nil {
+		return err
+	}
+	return ErrReused
+}
+
+// IsRevoked returns true if the session is revoked or unknown.
+func (s *Store) IsRevoked(ctx context.Context, familyID string) (bool, error) {
+	now := time.Now()
+
+	s.mutex.Lock()
+	entry, ok := s.cache[familyID]
+	s.mutex.Unlock()
+	if ok && now.Sub(entry.checkedAt) < s.cacheTTL {
+		return entry.revoked, nil
+	}
+
+	var sessions []model.Session
+	if err := s.db.WithContext(ctx).Select("revoked_at").
+		Where(&model.Session{FamilyID: familyID}).Limit(1).Find(&sessions).Error; err != nil {
+		return false, err
+	}
+	revoked := len(sessions) == 0 || sessions[0].RevokedAt != nil
+
+	s.setCache(familyID, cacheEntry{revoked: revoked, checkedAt: now})
+	return revoked, nil
+}
+
+// Revoke ends a session.
+func (s *Store) Revoke(ctx context.Context, familyID string, reason string) error {
+	if err := s.db.WithContext(ctx).Model(&model.Session{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Updates(map[string]interface{}{"revoked_at": time.Now(), "revoke_reason": reason}).Error; err != nil {
+		return fmt.Errorf("cannot revoke session: %w", err)
+	}
+
+	s.markRevoked(familyID)
+	return nil
+}
+
+// RevokeUser ends all sessions of a user and returns their number.
+func (s *Store) RevokeUser(ctx context.Context, userID uint, reason string) (int, error) {
+	db := s.db.WithContext(ctx)
+
+	var familyIDs []string
+	if err := db.Model(&model.Session{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Pluck("family_id", &familyIDs).Error; err != nil {
+		return 0, fmt.Errorf("cannot fetch sessions: %w", err)
+	}
+
+	if len(familyIDs) == 0 {
+		return 0, nil
+	}
+
+	if err := db.Model(&model.Session{}).
+		Where("family_id IN ?", familyIDs).
+		Updates(map[string]interface{}{"revoked_at": time.Now(), "revoke_reason": reason}).Error; err != nil {
+		return 0, fmt.Errorf("cannot revoke sessions: %w", err)
+	}
+
+	for _, familyID := range familyIDs {
+		s.markRevoked(familyID)
+	}
+
+	return len(familyIDs), nil
+}
+
+func (s *Store) markRevoked(familyID string) {
+	s.setCache(familyID, cacheEntry{revoked: true, checkedAt: time.Now()})
+}
+
+func (s *Store) setCache(familyID string, entry cacheEntry) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if len(s.cache) >= maxCacheEntries {
+		for id, cached := range s.cache {
+			if entry.checkedAt.Sub(cached.checkedAt) >= s.cacheTTL {
+				delete(s.cache, id)
+			}
+		}
+	}
+
+	s.cache[familyID] = entry
+}
@@ -0,0 +1,120 @@
+package sso
+
+import (
+	"errors"
+	"precisiondosing-api-go/internal/model"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Identity is a user or service authenticated by the identity provider.
+type Identity struct {
+	Issuer        string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	FirstName     string
+	LastName      string
+	Organization  string
+	Roles         []string // IdP roles
+	ClientID      string   // service clients only
+	LinkUserID    uint     // local user to link the identity to, 0 for a login
+}
+
+func (p *Provider) mapClaims(issuer, subject string, claims map[string]interface{}) *Identity {
+	names := p.cfg.Claims
+	verified, _ := claims["email_verified"].(bool)
+
+	return &Identity{
+		Issuer:        issuer,
+		Subject:       subject,
+		Email:         claimString(claims, names.Email),
+		EmailVerified: verified,
+		FirstName:     claimString(claims, names.FirstName),
+		LastName:      claimString(claims, names.LastName),
+		Organization:  claimString(claims, names.Organization),
+		Roles:         claimStrings(claims, names.Roles),
+	}
+}
+
+// MappedRole returns the local role with the most permissions the IdP roles are
+// mapped to, or "" if none of them is mapped to an existing role.
+func (p *Provider) MappedRole(db *gorm.DB, identity *Identity) (string, error) {
+	var best *model.Role
+	for _, idpRole := range identity.Roles {
+		local, ok := p.cfg.RoleMapping[idpRole]
+		if !ok {
+			continue
+		}
+
+		// roles can be deleted at runtime
+		role, err := model.GetRole(db, local)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+
+		if best == nil || len(role.Permissions) > len(best.Permissions) {
+			best = role
+		}
+	}
+
+	if best == nil {
+		return "", nil
+	}
+	return best.Name, nil
+}
+
+// serviceClientID returns the client of a client credentials token.
+// Providers use different claims for it.
+func serviceClientID(claims map[string]interface{}) string {
+	for _, name := range []string{"client_id", "azp", "cid"} {
+		if id := claimString(claims, name); id != "" {
+			return id
+		}
+	}
+	return ""
+}
+
+// claim resolves a dotted path in nested claims, e.g. realm_access.roles.
+func claim(claims map[string]interface{}, path string) interface{} {
+	if path == "" {
+		return nil
+	}
+
+	var current interface{} = claims
+	for _, key := range strings.Split(path, ".") {
+		object, ok := current.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		current = object[key]
+	}
+	return current
+}
+
+func claimString(claims map[string]interface{}, path string) string {
+	value, _ := claim(claims, path).(string)
+	return value
+}
+
+// claimStrings accepts a list or a space separated string.
+func claimStrings(claims map[string]interface{}, path string) []string {
+	switch value := claim(claims, path).(type) {
+	case string:
+		return strings.Fields(value)
+	case []interface{}:
+		values := make([]string, 0, len(value))
+		for _, v := range value {
+			if s, ok := v.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,227 @@
+package sso
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"precisiondosing-api-go/cfg"
+	"precisiondosing-api-go/internal/model"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrIdentity      = errors.New("identity provider login failed")
+	ErrServiceClient = errors.New("unknown service client")
+)
+
+// Provider handles the login via an OpenID Connect identity provider:
+// the authorization code flow with PKCE for users and verified client credentials tokens for services.
+type Provider struct {
+	cfg cfg.OIDCConfig
+	db  *gorm.DB
+
+	// discovered on first use, so the API starts while the IdP is unreachable
+	mu       sync.Mutex
+	provider *oidc.Provider
+}
+
+// New returns the provider or nil if OIDC login is disabled.
+func New(oidcCfg cfg.OIDCConfig, db *gorm.DB) (*Provider, error) {
+	if !oidcCfg.Enabled {
+		return nil, nil //nolint:nilnil // disabled
+	}
+
+	if oidcCfg.IssuerURL == "" || oidcCfg.ClientID == "" || oidcCfg.RedirectURL == "" {
+		return nil, errors.New("issuer_url, client_id and redirect_url are required")
+	}
+
+	for idpRole, role := range oidcCfg.RoleMapping {
+		if _, err := model.GetRole(db, role); err != nil {
+			return nil, fmt.Errorf("invalid role %q mapped for %q: %w", role, idpRole, err)
+		}
+	}
+	if oidcCfg.DefaultRole != "" {
+		if _, err := model.GetRole(db, oidcCfg.DefaultRole); err != nil {
+			return nil, fmt.Errorf("invalid default role %q: %w", oidcCfg.DefaultRole, err)
+		}
+	}
+
+	return &Provider{cfg: oidcCfg, db: db}, nil
+}
+
+// ServiceLoginEnabled is true if client credentials tokens are accepted.
+func (p *Provider) ServiceLoginEnabled() bool {
+	return p.cfg.ServiceAudience != ""
+}
+
+// AuthCodeURL starts a login: it stores a new state, nonce and PKCE verifier
+// and returns the URL of the identity provider to redirect the user to.
+func (p *Provider) AuthCodeURL(ctx context.Context) (string, error) {
+	return p.authCodeURL(ctx, nil)
+}
+
+// LinkURL starts a login that links the identity to the local user instead of
+// logging in, so an existing account is only linked by its logged-in owner.
+func (p *Provider) LinkURL(ctx context.Context, userID uint) (string, error) {
+	return p.authCodeURL(ctx, &userID)
+}
+
+func (p *Provider) authCodeURL(ctx context.Context, linkUserID *uint) (string, error) {
+	provider, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	state, err := randomHex()
+	if err != nil {
+		return "", err
+	}
+	nonce, err := randomHex()
+	if err != nil {
+		return "", err
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	if err = model.SaveOIDCState(p.db.WithContext(ctx), &model.OIDCState{
+		State:      state,
+		Nonce:      nonce,
+		Verifier:   verifier,
+		LinkUserID: linkUserID,
+		ExpiresAt:  time.Now().Add(p.cfg.StateTTL),
+	}); err != nil {
+		return "", fmt.Errorf("cannot store login state: %w", err)
+	}
+
+	return p.oauth2Config(provider).AuthCodeURL(state,
+		oauth2.S256ChallengeOption(verifier),
+		oidc.Nonce(nonce),
+	), nil
+}
+
+// Exchange completes a login: it redeems the code of the callback and returns
+// the identity of the verified ID token. LinkUserID of the identity is set if the
+// login was started by LinkURL.
+func (p *Provider) Exchange(ctx context.Context, code, state string) (*Identity, error) {
+	provider, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	login, err := model.ConsumeOIDCState(p.db.WithContext(ctx), state)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := p.oauth2Config(provider).Exchange(ctx, code, oauth2.VerifierOption(login.Verifier))
+	if err != nil {
+		return nil, fmt.Errorf("%w: code exchange: %w", ErrIdentity, err)
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, fmt.Errorf("%w: no ID token", ErrIdentity)
+	}
+
+	idToken, err := provider.Verifier(&oidc.Config{ClientID: p.cfg.ClientID}).Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrIdentity, err)
+	}
+
+	if idToken.Nonce != login.Nonce {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrIdentity)
+	}
+
+	var claims map[string]interface{}
+	if err = idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrIdentity, err)
+	}
+
+	identity := p.mapClaims(idToken.Issuer, idToken.Subject, claims)
+	if login.LinkUserID != nil {
+		identity.LinkUserID = *login.LinkUserID
+	}
+	if identity.Subject == "" {
+		return nil, fmt.Errorf("%w: no subject", ErrIdentity)
+	}
+	if identity.Email == "" {
+		return nil, fmt.Errorf("%w: no email claim", ErrIdentity)
+	}
+	if p.cfg.RequireVerifiedEmail && !identity.EmailVerified {
+		return nil, fmt.Errorf("%w: email not verified", ErrIdentity)
+	}
+
+	return identity, nil
+}
+
+// VerifyServiceToken verifies an access token a service obtained from the
+// identity provider with the client credentials grant. The token has to be a JWT
+// signed by the provider for the configured service audience.
+func (p *Provider) VerifyServiceToken(ctx context.Context, rawToken string) (*Identity, error) {
+	if !p.ServiceLoginEnabled() {
+		return nil, ErrServiceClient
+	}
+
+	provider, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := provider.Verifier(&oidc.Config{ClientID: p.cfg.ServiceAudience}).Verify(ctx, rawToken)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrIdentity, err)
+	}
+
+	var claims map[string]interface{}
+	if err = token.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrIdentity, err)
+	}
+
+	identity := &Identity{Subject: token.Subject, ClientID: serviceClientID(claims)}
+	if identity.ClientID == "" {
+		return nil, fmt.Errorf("%w: no client ID claim", ErrIdentity)
+	}
+
+	return identity, nil
+}
+
+func (p *Provider) discover(ctx context.Context) (*oidc.Provider, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.provider != nil {
+		return p.provider, nil
+	}
+
+	provider, err := oidc.NewProvider(ctx, p.cfg.IssuerURL)
+	if err != nil {
+		return nil, fmt.Errorf("cannot discover identity provider: %w", err)
+	}
+
+	p.provider = provider
+	return provider, nil
+}
+
+func (p *Provider) oauth2Config(provider *oidc.Provider) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     p.cfg.ClientID,
+		ClientSecret: p.cfg.ClientSecret,
+		RedirectURL:  p.cfg.RedirectURL,
+		Endpoint:     provider.Endpoint(),
+		Scopes:       p.cfg.Scopes,
+	}
+}
+
+func randomHex() (string, error) {
+	b := make([]byte, 32) //nolint:mnd // 256 bit
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,133 @@
+package sso
+
+import (
+	"errors"
+	"fmt"
+	"precisiondosing-api-go/internal/model"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrNotProvisioned = errors.New("user does not exist")
+	ErrNoRole         = errors.New("no role mapped for user")
+	ErrNotLinked      = errors.New("account exists but is not linked to the identity")
+	ErrAlreadyLinked  = errors.New("identity is linked to another user")
+)
+
+// User returns the local user linked to the issuer and subject of an identity.
+// Unknown identities are provisioned with the role mapped from the IdP (MappedRole)
+// if just-in-time provisioning is enabled. An existing account with the same email
+// is not used, the email claim does not prove its ownership: the owner has to link
+// the identity first (LinkURL).
+func (p *Provider) User(db *gorm.DB, identity *Identity, role string) (*model.User, error) {
+	user, err := model.GetUserByOIDCIdentity(db, identity.Issuer, identity.Subject)
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return user, err
+	}
+
+	available, err := model.IsEmailAvailable(identity.Email, db, 0)
+	if err != nil {
+		return nil, err
+	}
+	if !available {
+		return nil, ErrNotLinked
+	}
+	return p.provision(db, identity, role)
+}
+
+// Link stores the issuer and subject of the identity on the local user that
+// started the link. An identity can only be linked to one user.
+func (p *Provider) Link(db *gorm.DB, identity *Identity) (*model.User, error) {
+	linked, err := model.GetUserByOIDCIdentity(db, identity.Issuer, identity.Subject)
+	if err == nil && linked.ID != identity.LinkUserID {
+		return nil, ErrAlreadyLinked
+	}
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	user, err := model.GetUserByID(db, identity.LinkUserID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotProvisioned
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err = db.Model(user).Updates(model.User{
+		OIDCIssuer:  &identity.Issuer,
+		OIDCSubject: &identity.Subject,
+	}).Error; err != nil {
+		return nil, fmt.Errorf("cannot link identity: %w", err)
+	}
+
+	return user, nil
+}
+
+// ServiceUser returns the local user configured for the client of a service token.
+func (p *Provider) ServiceUser(db *gorm.DB, identity *Identity) (*model.User, error) {
+	email, ok := p.cfg.ServiceClients[identity.ClientID]
+	if !ok {
+		return nil, ErrServiceClient
+	}
+
+	user, err := model.GetUserByEmail(db, email)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotProvisioned
+	}
+	return user, err
+}
+
+func (p *Provider) provision(db *gorm.DB, identity *Identity, role string) (*model.User, error) {
+	if !p.cfg.JITProvisioning {
+		return nil, ErrNotProvisioned
+	}
+
+	if role == "" {
+		role = p.cfg.DefaultRole
+	}
+	if role == "" {
+		return nil, ErrNoRole
+	}
+
+	// no password, the user logs in via the identity provider only
+	user := &model.User{
+		Email:       identity.Email,
+		FirstName:   identity.FirstName,
+		LastName:    identity.LastName,
+		Role:        role,
+		Status:      "active",
+		OIDCIssuer:  &identity.Issuer,
+		OIDCSubject: &identity.Subject,
+	}
+
+	// tenants are not created from claims, only existing organizations are assigned
+	if identity.Organization != "" {
+		var org model.Organization
+		err := db.Where(&model.Organization{Name: identity.Organization}).Limit(1).Find(&org).Error
+		if err != nil {
+			return nil, err
+		}
+		if org.ID != 0 {
+			user.OrganizationID = &org.ID
+			user.Org = org.Name
+		}
+	}
+
+	localRole, err := model.GetRole(db, role)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNoRole
+	}
+	if err != nil {
+		return nil, err
+	}
+	if localRole.NeedsOrganization() && user.OrganizationID == nil {
+		return nil, ErrNoRole
+	}
+	if err := db.Create(user).Error; err != nil {
+		return nil, fmt.Errorf("cannot provision user: %w", err)
+	}
+
+	return user, nil
+}
@@ -1,10 +1,12 @@
 package callr
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"github.com/cloudflare/ahocorasick"
 	"precisiondosing-api-go/cfg"
+	"precisiondosing-api-go/internal/metrics"
 	"precisiondosing-api-go/internal/utils/log"
 	"strings"
 	"time"
@@ -93,22 +95,40 @@ func newRError(err error, callStack []string) *RError {
 	}
 }
 
+// ErrCancelled is returned if the order was cancelled while R was running.
+var ErrCancelled = errors.New("adjustment cancelled")
+
 type CallRIDs struct {
 	JobID  uint
 	OderID string
 }
 
-// error is always a non-recoverable system error
-func (c *CallR) Adjust(ids CallRIDs, adjust bool, errorMsg string, maxExecutionTime time.Duration) (*Resp, *RError) {
-	bytes, err := c.run(ids, adjust, errorMsg, maxExecutionTime)
+// error is always a non-recoverable system error, except ErrCancelled:
+// cancelling ctx tears down the running script.
+func (c *CallR) Adjust(
+	ctx context.Context, ids CallRIDs, adjust bool, errorMsg string, maxExecutionTime time.Duration,
+) (*Resp, *RError) {
+	bytes, err := c.run(ctx, ids, adjust, errorMsg, maxExecutionTime)
 	if err != nil {
+		if err.Cancelled {
+			return nil, newRError(ErrCancelled, nil)
+		}
+
 		if err.Timeout {
 			// timeout error -> we will retry one time with and error message job
 			c.logger.Warn("script timed out", log.Str("OrderID", ids.OderID))
+			metrics.RTimeout()
+			metrics.RRetry()
 
 			errorMsg := "The adjustment timed out (took too long)"
-			retryBytes, retryErr := c.run(ids, false, errorMsg, maxExecutionTime)
+			retryBytes, retryErr := c.run(ctx, ids, false, errorMsg, maxExecutionTime)
 			if retryErr != nil {
+				if retryErr.Cancelled {
+					return nil, newRError(ErrCancelled, nil)
+				}
+				if retryErr.Timeout {
+					metrics.RTimeout()
+				}
 				return nil, newRError(retryErr, nil)
 			}
 			bytes = retryBytes
@@ -18,8 +18,9 @@ import (
 )
 
 type callError struct {
-	ErrorMsg string `json:"error_msg"`
-	Timeout  bool   `json:"timeout"`
+	ErrorMsg  string `json:"error_msg"`
+	Timeout   bool   `json:"timeout"`
+	Cancelled bool   `json:"cancelled"`
 }
 
 func (e *callError) Error() string {
@@ -42,7 +43,9 @@ type platform interface {
 	Teardown(cmd *exec.Cmd) error // kill group or parent
 }
 
-func (c *CallR) run(ids CallRIDs, adjust bool, errorMsg string, maxExecutionTime time.Duration) ([]byte, *callError) {
+func (c *CallR) run(
+	ctx context.Context, ids CallRIDs, adjust bool, errorMsg string, maxExecutionTime time.Duration,
+) ([]byte, *callError) {
 	// 1) prepare cmd & pipes
 	cmd, pipes, err := c.prepareCommand(ids.JobID, adjust, errorMsg)
 	if err != nil {
@@ -55,7 +58,7 @@ func (c *CallR) run(ids CallRIDs, adjust bool, errorMsg string, maxExecutionTime
 	}
 
 	// 3) start
-	ctx, cancel := context.WithTimeout(context.Background(), maxExecutionTime)
+	runCtx, cancel := context.WithTimeout(ctx, maxExecutionTime)
 	defer cancel()
 
 	if err = cmd.Start(); err != nil {
@@ -82,23 +85,30 @@ func (c *CallR) run(ids CallRIDs, adjust bool, errorMsg string, maxExecutionTime
 	go c.captureAndLogStderr(pipes.stderr, ids.OderID)
 	go func() { done <- cmd.Wait() }()
 
-	// 6) wait or timeout
-	var timedOut bool
+	// 6) wait, timeout or cancellation of the order
+	var timedOut, cancelled bool
 	select {
 	case err = <-done:
 		// finished normally
-	case <-ctx.Done():
-		timedOut = true
+	case <-runCtx.Done():
 		terr := plat.Teardown(cmd) // kill process/group
 		if terr != nil {
 			c.logger.Error("Teardown failed", log.Err(terr))
 		}
-		err = errors.New("timeout")
+		if ctx.Err() != nil {
+			cancelled = true
+			err = errors.New("cancelled")
+		} else {
+			timedOut = true
+			err = errors.New("timeout")
+		}
 	}
 	wg.Wait() // drain stdout
 
 	if err != nil {
-		return nil, newCallError(err.Error(), timedOut)
+		callErr := newCallError(err.Error(), timedOut)
+		callErr.Cancelled = cancelled
+		return nil, callErr
 	}
 	return stdoutBuf.Bytes(), nil
 }
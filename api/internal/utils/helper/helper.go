@@ -109,3 +109,22 @@ func FormatDuration(d time.Duration) string {
 		return fmt.Sprintf("%dms", d.Milliseconds())
 	}
 }
+
+// RetryBackoff returns the wait time before the next delivery attempt
+// after the given number of failed tries.
+func RetryBackoff(tries int) time.Duration {
+	switch tries {
+	case 1:
+		return 1 * time.Minute
+	case 2:
+		return 2 * time.Minute
+	case 3:
+		return 5 * time.Minute
+	case 4:
+		return 15 * time.Minute
+	case 5:
+		return 30 * time.Minute
+	default:
+		return 1 * time.Hour // Cap backoff at 1 hour
+	}
+}
@@ -5,9 +5,11 @@ import (
 	"fmt"
 	"precisiondosing-api-go/cfg"
 	"precisiondosing-api-go/internal/utils/validate"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
 )
 
 type AuthTokens struct {
@@ -16,21 +18,27 @@ type AuthTokens struct {
 	TokenType        string    `json:"token_type"`
 	AccessExpiresIn  time.Time `json:"access_expires_in"`
 	RefreshExpiresIn time.Time `json:"refresh_expires_in"`
+	RefreshJTI       string    `json:"-"` // ID of the refresh token, stored to detect reuse
 }
 
 type CustomClaims struct {
-	Email string `json:"email"`
-	Role  string `json:"role"`
-	ID    uint   `json:"id"`
+	Email       string   `json:"email"`
+	Role        string   `json:"role"`
+	ID          uint     `json:"id"`
+	OrgID       uint     `json:"-"` // organization (tenant) of the user, 0 if none
+	Permissions []string `json:"-"` // permissions of the role at issue, carried as scope claim
+	FamilyID    string   `json:"-"` // session (token family) the token belongs to
+	JTI         string   `json:"-"` // ID of the token itself
 }
 
+// CreateAuthTokens creates an access and a refresh token of the session user.FamilyID.
 func CreateAuthTokens(user *CustomClaims, authCfg *cfg.AuthTokenConfig) (*AuthTokens, error) {
-	accessToken, accessExpirationTime, err := createToken(user.ID, user.Email, user.Role, "access", authCfg)
+	accessToken, _, accessExpirationTime, err := createToken(user, "access", authCfg)
 	if err != nil {
 		return nil, fmt.Errorf("cannot create access token: %w", err)
 	}
 
-	refreshToken, refreshExpirationTime, err := createToken(user.ID, user.Email, user.Role, "refresh", authCfg)
+	refreshToken, refreshJTI, refreshExpirationTime, err := createToken(user, "refresh", authCfg)
 	if err != nil {
 		return nil, fmt.Errorf("cannot create refresh token: %w", err)
 	}
@@ -41,6 +49,7 @@ func CreateAuthTokens(user *CustomClaims, authCfg *cfg.AuthTokenConfig) (*AuthTo
 		TokenType:        "Bearer",
 		AccessExpiresIn:  accessExpirationTime,
 		RefreshExpiresIn: refreshExpirationTime,
+		RefreshJTI:       refreshJTI,
 	}
 
 	return res, nil
@@ -69,14 +78,15 @@ type claims struct {
 	UserEmail string
 	UserRole  string
 	UserID    uint
+	OrgID     uint   `json:"org,omitempty"`
+	Scope     string `json:"scope,omitempty"` // space separated permissions
+	FamilyID  string `json:"fid"`
 	jwt.RegisteredClaims
 }
 
 func checkToken(tokenString string, jwtKey *cfg.Bytes, issuer string, tokenType string) (*CustomClaims, error) {
 	claims := &claims{}
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(_ *jwt.Token) (interface{}, error) {
-		return []byte(*jwtKey), nil
-	})
+	token, err := jwt.ParseWithClaims(tokenString, claims, verificationKeyFunc(*jwtKey))
 
 	if err != nil || !token.Valid {
 		return nil, errors.New("could not parse JWT")
@@ -100,16 +110,25 @@ func checkToken(tokenString string, jwtKey *cfg.Bytes, issuer string, tokenType
 		return nil, errors.New("invalid token type")
 	}
 
+	// tokens issued before sessions were introduced cannot be revoked
+	if claims.FamilyID == "" || claims.ID == "" {
+		return nil, errors.New("token without session")
+	}
+
 	jwtUser := &CustomClaims{
-		Email: claims.UserEmail,
-		Role:  claims.UserRole,
-		ID:    claims.UserID,
+		Email:       claims.UserEmail,
+		Role:        claims.UserRole,
+		ID:          claims.UserID,
+		OrgID:       claims.OrgID,
+		Permissions: strings.Fields(claims.Scope),
+		FamilyID:    claims.FamilyID,
+		JTI:         claims.ID,
 	}
 
 	return jwtUser, nil
 }
 
-func createToken(id uint, email, role, tokenType string, jwtConfig *cfg.AuthTokenConfig) (string, time.Time, error) {
+func createToken(user *CustomClaims, tokenType string, jwtConfig *cfg.AuthTokenConfig) (string, string, time.Time, error) {
 	now := time.Now()
 	var expirationTime time.Time
 	if tokenType == "refresh" {
@@ -118,23 +137,27 @@ func createToken(id uint, email, role, tokenType string, jwtConfig *cfg.AuthToke
 		expirationTime = now.Add(jwtConfig.AccessExpirationTime)
 	}
 
+	jti := uuid.New().String()
 	claims := &claims{
 		TokenType: tokenType,
-		UserEmail: email,
-		UserRole:  role,
-		UserID:    id,
+		UserEmail: user.Email,
+		UserRole:  user.Role,
+		UserID:    user.ID,
+		OrgID:     user.OrgID,
+		Scope:     strings.Join(user.Permissions, " "),
+		FamilyID:  user.FamilyID,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 			IssuedAt:  jwt.NewNumericDate(now),
 			Issuer:    jwtConfig.Issuer,
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte(jwtConfig.Secret))
+	tokenString, err := sign(claims, jwtConfig.Secret)
 	if err != nil {
-		return "", time.Time{}, fmt.Errorf("cannot sign token: %w", err)
+		return "", "", time.Time{}, fmt.Errorf("cannot sign token: %w", err)
 	}
 
-	return tokenString, expirationTime, nil
+	return tokenString, jti, expirationTime, nil
 }
@@ -0,0 +1,274 @@
+package tokens
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"precisiondosing-api-go/cfg"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// Signing methods
+const (
+	MethodHS256 = "HS256"
+	MethodRS256 = "RS256"
+	MethodEdDSA = "EdDSA"
+)
+
+type verificationKey struct {
+	method jwt.SigningMethod
+	public crypto.PublicKey
+	jwk    JWK
+}
+
+// KeySet holds the asymmetric signing key and all keys accepted for verification
+// (the signing key and previous keys during a rotation), identified by their kid.
+type KeySet struct {
+	kid     string
+	method  jwt.SigningMethod
+	private crypto.PrivateKey
+	verify  map[string]verificationKey
+}
+
+// JWK is a public key in the JSON Web Key format (RFC 7517).
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n,omitempty"`   // RSA
+	E   string `json:"e,omitempty"`   // RSA
+	Crv string `json:"crv,omitempty"` // OKP
+	X   string `json:"x,omitempty"`   // OKP
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+//nolint:gochecknoglobals // key set is loaded once on startup
+var (
+	keySet   *KeySet
+	keyMutex sync.RWMutex
+)
+
+// InitKeys loads the signing keys of the configured method.
+// HS256 (the default) uses the shared JWT_SECRET and needs no keys.
+func InitKeys(authCfg *cfg.AuthTokenConfig) error {
+	method := authCfg.SigningMethod
+	if method == "" || method == MethodHS256 {
+		setKeySet(nil)
+		return nil
+	}
+
+	if method != MethodRS256 && method != MethodEdDSA {
+		return fmt.Errorf("unsupported signing method %q", method)
+	}
+
+	if authCfg.SigningKey == "" {
+		return fmt.Errorf("signing method %s requires a signing key", method)
+	}
+
+	private, err := readPrivateKey(authCfg.SigningKey)
+	if err != nil {
+		return err
+	}
+
+	signer, ok := private.(crypto.Signer)
+	if !ok {
+		return errors.New("signing key cannot sign")
+	}
+
+	signing, err := newVerificationKey(signer.Public())
+	if err != nil {
+		return err
+	}
+	if signing.method.Alg() != method {
+		return fmt.Errorf("signing key does not match signing method %s", method)
+	}
+
+	set := &KeySet{
+		kid:     signing.jwk.Kid,
+		method:  signing.method,
+		private: private,
+		verify:  map[string]verificationKey{signing.jwk.Kid: signing},
+	}
+
+	for _, file := range authCfg.VerificationKeys {
+		public, readErr := readPublicKey(file)
+		if readErr != nil {
+			return readErr
+		}
+
+		key, keyErr := newVerificationKey(public)
+		if keyErr != nil {
+			return fmt.Errorf("verification key %s: %w", file, keyErr)
+		}
+		set.verify[key.jwk.Kid] = key
+	}
+
+	setKeySet(set)
+	return nil
+}
+
+// PublicJWKS returns the verification keys. It is empty for HS256.
+func PublicJWKS() JWKS {
+	set := currentKeySet()
+	jwks := JWKS{Keys: []JWK{}}
+	if set == nil {
+		return jwks
+	}
+
+	// signing key first
+	jwks.Keys = append(jwks.Keys, set.verify[set.kid].jwk)
+	for kid, key := range set.verify {
+		if kid != set.kid {
+			jwks.Keys = append(jwks.Keys, key.jwk)
+		}
+	}
+	return jwks
+}
+
+func setKeySet(set *KeySet) {
+	keyMutex.Lock()
+	defer keyMutex.Unlock()
+	keySet = set
+}
+
+func currentKeySet() *KeySet {
+	keyMutex.RLock()
+	defer keyMutex.RUnlock()
+	return keySet
+}
+
+// sign signs the claims with the signing key or the shared secret (HS256).
+func sign(claims jwt.Claims, secret cfg.Bytes) (string, error) {
+	set := currentKeySet()
+	if set == nil {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+	}
+
+	token := jwt.NewWithClaims(set.method, claims)
+	token.Header["kid"] = set.kid
+	return token.SignedString(set.private)
+}
+
+// verificationKeyFunc selects the key by kid. The algorithm has to match the key,
+// HS256 tokens are only accepted in HS256 mode.
+func verificationKeyFunc(secret cfg.Bytes) jwt.Keyfunc {
+	set := currentKeySet()
+	return func(token *jwt.Token) (interface{}, error) {
+		if set == nil {
+			if token.Method != jwt.SigningMethodHS256 {
+				return nil, errors.New("unexpected signing method")
+			}
+			return []byte(secret), nil
+		}
+
+		kid, _ := token.Header["kid"].(string)
+		key, ok := set.verify[kid]
+		if !ok {
+			return nil, errors.New("unknown key id")
+		}
+
+		if token.Method.Alg() != key.method.Alg() {
+			return nil, errors.New("unexpected signing method")
+		}
+		return key.public, nil
+	}
+}
+
+func newVerificationKey(public crypto.PublicKey) (verificationKey, error) {
+	switch key := public.(type) {
+	case *rsa.PublicKey:
+		jwk := JWK{
+			Kty: "RSA", Use: "sig", Alg: MethodRS256,
+			N: b64(key.N.Bytes()),
+			E: b64(big.NewInt(int64(key.E)).Bytes()),
+		}
+		jwk.Kid = thumbprint(map[string]string{"e": jwk.E, "kty": jwk.Kty, "n": jwk.N})
+		return verificationKey{method: jwt.SigningMethodRS256, public: key, jwk: jwk}, nil
+	case ed25519.PublicKey:
+		jwk := JWK{Kty: "OKP", Use: "sig", Alg: MethodEdDSA, Crv: "Ed25519", X: b64(key)}
+		jwk.Kid = thumbprint(map[string]string{"crv": jwk.Crv, "kty": jwk.Kty, "x": jwk.X})
+		return verificationKey{method: jwt.SigningMethodEdDSA, public: key, jwk: jwk}, nil
+	default:
+		return verificationKey{}, fmt.Errorf("unsupported key type %T", public)
+	}
+}
+
+// thumbprint is the JWK thumbprint (RFC 7638), used as kid.
+// json.Marshal sorts the map keys as required.
+func thumbprint(members map[string]string) string {
+	data, _ := json.Marshal(members)
+	sum := sha256.Sum256(data)
+	return b64(sum[:])
+}
+
+func b64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func readPEM(file string) (*pem.Block, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read key file: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data in %s", file)
+	}
+	return block, nil
+}
+
+func readPrivateKey(file string) (crypto.PrivateKey, error) {
+	block, err := readPEM(file)
+	if err != nil {
+		return nil, err
+	}
+
+	if key, pkcs8Err := x509.ParsePKCS8PrivateKey(block.Bytes); pkcs8Err == nil {
+		return key, nil
+	}
+	if key, pkcs1Err := x509.ParsePKCS1PrivateKey(block.Bytes); pkcs1Err == nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("cannot parse private key %s", file)
+}
+
+// readPublicKey also accepts private keys, the public part is used.
+func readPublicKey(file string) (crypto.PublicKey, error) {
+	block, err := readPEM(file)
+	if err != nil {
+		return nil, err
+	}
+
+	if key, pkixErr := x509.ParsePKIXPublicKey(block.Bytes); pkixErr == nil {
+		return key, nil
+	}
+	if key, pkcs1Err := x509.ParsePKCS1PublicKey(block.Bytes); pkcs1Err == nil {
+		return key, nil
+	}
+
+	private, err := readPrivateKey(file)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse public key %s", file)
+	}
+	signer, ok := private.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("cannot parse public key %s", file)
+	}
+	return signer.Public(), nil
+}
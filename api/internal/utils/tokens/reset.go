@@ -2,32 +2,127 @@ package tokens
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"precisiondosing-api-go/internal/utils/hash"
+	"strings"
 )
 
+// ResetTokenPair holds a single-use token (e.g. password reset) as handed out
+// and its hash to store. The token has the form <selector>.<secret>, the selector
+// finds the stored token, only the secret is hashed.
 type ResetTokenPair struct {
 	Token     string `json:"token"`
+	Selector  string `json:"selector"`
 	TokenHash string `json:"token_hash"`
 }
 
 func CreateResetTokens() (*ResetTokenPair, error) {
-	const nBytes = 32
-	token := make([]byte, nBytes)
+	const (
+		nSelectorBytes = 12
+		nBytes         = 32
+	)
 
-	if _, err := rand.Read(token); err != nil {
+	selector, err := randomString(nSelectorBytes)
+	if err != nil {
+		return nil, fmt.Errorf("cannot generate reset token: %w", err)
+	}
+
+	secret, err := randomString(nBytes)
+	if err != nil {
 		return nil, fmt.Errorf("cannot generate reset token: %w", err)
 	}
 
-	tokenString := base64.URLEncoding.EncodeToString(token)
-	tokenHash, err := hash.Create(tokenString)
+	tokenHash, err := hash.Create(secret)
 	if err != nil {
 		return nil, fmt.Errorf("cannot hash reset token: %w", err)
 	}
 
 	return &ResetTokenPair{
-		Token:     tokenString,
+		Token:     selector + "." + secret,
+		Selector:  selector,
 		TokenHash: tokenHash,
 	}, nil
 }
+
+// SplitResetToken returns the selector and secret of a token.
+func SplitResetToken(token string) (string, string, error) {
+	selector, secret, found := strings.Cut(token, ".")
+	if !found || selector == "" || secret == "" {
+		return "", "", errors.New("malformed token")
+	}
+	return selector, secret, nil
+}
+
+func randomString(nBytes int) (string, error) {
+	b := make([]byte, nBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// APIKey holds a new API key as handed out and its hash to store.
+// The key has the form pdk_<prefix>_<secret>, the prefix finds the stored key.
+type APIKey struct {
+	Key     string
+	Prefix  string
+	KeyHash string
+}
+
+const apiKeyTag = "pdk"
+
+func CreateAPIKey() (*APIKey, error) {
+	const (
+		nPrefixBytes = 6
+		nBytes       = 32
+	)
+
+	// hex prefix, the base64 alphabet contains the separator
+	prefixBytes := make([]byte, nPrefixBytes)
+	if _, err := rand.Read(prefixBytes); err != nil {
+		return nil, fmt.Errorf("cannot generate API key: %w", err)
+	}
+	prefix := hex.EncodeToString(prefixBytes)
+
+	secret, err := randomString(nBytes)
+	if err != nil {
+		return nil, fmt.Errorf("cannot generate API key: %w", err)
+	}
+
+	return &APIKey{
+		Key:     apiKeyTag + "_" + prefix + "_" + secret,
+		Prefix:  prefix,
+		KeyHash: HashAPIKeySecret(secret),
+	}, nil
+}
+
+// HashAPIKeySecret returns the SHA-256 hash of the secret of an API key. The secret
+// is random with 256 bits, so a fast hash suffices and failed checks cost no CPU.
+func HashAPIKeySecret(secret string) string {
+	digest := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(digest[:])
+}
+
+// CheckAPIKeySecret compares the secret with the stored hash in constant time.
+func CheckAPIKeySecret(keyHash, secret string) bool {
+	return subtle.ConstantTimeCompare([]byte(keyHash), []byte(HashAPIKeySecret(secret))) == 1
+}
+
+// SplitAPIKey returns the prefix and secret of an API key.
+func SplitAPIKey(key string) (string, string, error) {
+	tag, rest, found := strings.Cut(key, "_")
+	if !found || tag != apiKeyTag {
+		return "", "", errors.New("malformed API key")
+	}
+
+	prefix, secret, found := strings.Cut(rest, "_")
+	if !found || prefix == "" || secret == "" {
+		return "", "", errors.New("malformed API key")
+	}
+	return prefix, secret, nil
+}
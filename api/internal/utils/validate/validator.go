@@ -1,9 +1,13 @@
 package validate
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"net"
 	"net/mail"
+	"net/netip"
+	"net/url"
 	"strings"
 	"time"
 	"unicode"
@@ -16,6 +20,12 @@ const (
 	MinNameLength = int(2)
 	MaxNameLength = int(255)
 
+	MaxRoleNameLength = int(50)
+
+	MaxURLLength = int(2048)
+
+	hostLookupTimeout = 2 * time.Second
+
 	ServerTimeSkew = 5 * time.Minute
 )
 
@@ -89,25 +99,100 @@ func Organization(orgName string) error {
 	return nil
 }
 
-func Access(requiredRole, userRole string) error {
-	return CanSwitchToRole(requiredRole, userRole)
+func CallbackURL(rawURL string) error {
+	if len(rawURL) > MaxURLLength {
+		return fmt.Errorf("callback URL must be at most %d characters long", MaxURLLength)
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil || !u.IsAbs() || u.Host == "" {
+		return errors.New("callback URL must be an absolute URL")
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return errors.New("callback URL must use http or https")
+	}
+
+	return publicHost(u.Hostname())
 }
 
-func CanSwitchToRole(requestRole string, dbRole string) error {
-	var roleMap = map[string]int{
-		"admin": 3,
-		"debug": 2,
-		"user":  1,
+// publicHost rejects hosts that are or resolve to private or reserved addresses,
+// callbacks must not reach the internal network of the service.
+func publicHost(host string) error {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return errors.New("callback URL must not point to a private or reserved address")
+	}
+
+	if addr, err := netip.ParseAddr(host); err == nil {
+		if !PublicAddr(addr) {
+			return errors.New("callback URL must not point to a private or reserved address")
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), hostLookupTimeout)
+	defer cancel()
+
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil || len(addrs) == 0 {
+		return errors.New("callback URL host cannot be resolved")
 	}
 
-	reqRoleValue := roleMap[requestRole]
-	dbRoleValue := roleMap[dbRole]
-	if reqRoleValue == 0 || dbRoleValue == 0 {
-		return errors.New("invalid role")
+	for _, addr := range addrs {
+		if !PublicAddr(addr) {
+			return errors.New("callback URL must not point to a private or reserved address")
+		}
 	}
 
-	if dbRoleValue < reqRoleValue {
-		return errors.New("user role not sufficient")
+	return nil
+}
+
+//nolint:gochecknoglobals // fixed list of special-purpose ranges
+var reservedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),       // "this" network
+	netip.MustParsePrefix("100.64.0.0/10"),   // carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),    // IETF protocol assignments
+	netip.MustParsePrefix("192.0.2.0/24"),    // documentation
+	netip.MustParsePrefix("198.18.0.0/15"),   // benchmarking
+	netip.MustParsePrefix("198.51.100.0/24"), // documentation
+	netip.MustParsePrefix("203.0.113.0/24"),  // documentation
+	netip.MustParsePrefix("240.0.0.0/4"),     // reserved, incl. broadcast
+	netip.MustParsePrefix("64:ff9b::/96"),    // NAT64
+	netip.MustParsePrefix("2001:db8::/32"),   // documentation
+}
+
+// PublicAddr reports whether the address is publicly routable: not loopback,
+// private (RFC 1918, unique local), link-local (incl. cloud metadata 169.254.169.254),
+// multicast, unspecified or otherwise reserved.
+func PublicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsValid() || addr.IsLoopback() || addr.IsPrivate() || addr.IsUnspecified() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsMulticast() {
+		return false
+	}
+
+	for _, prefix := range reservedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// RoleName allows lowercase letters, digits, '-' and '_', starting with a letter.
+func RoleName(name string) error {
+	if len(name) < MinNameLength || len(name) > MaxRoleNameLength {
+		return fmt.Errorf("role name must be between %d and %d characters long", MinNameLength, MaxRoleNameLength)
+	}
+
+	for i, r := range name {
+		valid := (r >= 'a' && r <= 'z') || (i > 0 && ((r >= '0' && r <= '9') || r == '-' || r == '_'))
+		if !valid {
+			return errors.New("role name must start with a lowercase letter and contain only a-z, 0-9, '-' and '_'")
+		}
 	}
 
 	return nil
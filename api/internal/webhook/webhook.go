@@ -0,0 +1,122 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"precisiondosing-api-go/internal/model"
+	"precisiondosing-api-go/internal/utils/validate"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	EventStatusChanged = "order.status_changed"
+
+	SignatureHeader = "X-Webhook-Signature"
+	EventIDHeader   = "X-Webhook-Event-ID"
+	EventTypeHeader = "X-Webhook-Event"
+)
+
+var ErrPrivateAddress = errors.New("webhook target is a private or reserved address")
+
+type Event struct {
+	EventID      string    `json:"event_id"`
+	Type         string    `json:"type"`
+	OrderID      string    `json:"order_id"`
+	FromStatus   string    `json:"from_status,omitempty"`
+	ToStatus     string    `json:"to_status"`
+	DoseAdjusted bool      `json:"dose_adjusted"`
+	OccurredAt   time.Time `json:"occurred_at"`
+}
+
+// Enqueue stores a status change event for later delivery by the webhook sender.
+// Orders without a callback URL are ignored.
+// Pass a transaction to make the event part of the status update.
+func Enqueue(db *gorm.DB, order *model.Order, from, to string) error {
+	if order.CallbackURL == nil || *order.CallbackURL == "" {
+		return nil
+	}
+
+	event := Event{
+		EventID:      uuid.New().String(),
+		Type:         EventStatusChanged,
+		OrderID:      order.OrderID,
+		FromStatus:   from,
+		ToStatus:     to,
+		DoseAdjusted: order.DoseAdjusted,
+		OccurredAt:   time.Now().UTC(),
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("cannot marshal webhook event: %w", err)
+	}
+
+	delivery := model.WebhookDelivery{
+		EventID: event.EventID,
+		OrderID: order.OrderID,
+		URL:     *order.CallbackURL,
+		Payload: payload,
+		Status:  model.DeliveryPending,
+	}
+
+	if err = db.Create(&delivery).Error; err != nil {
+		return fmt.Errorf("cannot store webhook event: %w", err)
+	}
+
+	return nil
+}
+
+// EnqueueAll stores the same status change for several orders.
+func EnqueueAll(db *gorm.DB, orders []model.Order, to string) error {
+	for i := range orders {
+		if err := Enqueue(db, &orders[i], orders[i].Status, to); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NewClient returns the HTTP client for deliveries. It refuses to connect to
+// private or reserved addresses, checked on the resolved address of every
+// connection (incl. redirects), as DNS may change after the URL was validated.
+// Proxies are not used, the check has to see the final address.
+func NewClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(_, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return fmt.Errorf("invalid webhook address %q: %w", address, err)
+			}
+			if !validate.PublicAddr(addrPort.Addr()) {
+				return fmt.Errorf("%w: %s", ErrPrivateAddress, addrPort.Addr())
+			}
+			return nil
+		},
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
+
+// Sign returns the signature header value for a webhook body:
+// "sha256=" followed by the hex encoded HMAC-SHA256 of the body.
+func Sign(secret []byte, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
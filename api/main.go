@@ -24,6 +24,14 @@ func main() {
 	log.MustInit(config.Log, args.DebugMode)
 	logger := log.WithComponent("server")
 
+	// one-off migration of result PDFs
+	if args.MigrateBlobs {
+		if err := server.MigrateBlobs(config, args.DebugMode); err != nil {
+			logger.Panic("cannot migrate PDFs", log.Err(err))
+		}
+		return
+	}
+
 	// server
 	srv, err := server.New(config, args.DebugMode)
 	if err != nil {